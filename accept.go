@@ -0,0 +1,119 @@
+package grok
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAccept responds 406 to requests whose Accept header is satisfied by none of types.
+// Requests without Accept or accepting */* pass.
+func RequireAccept(types ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if Negotiate(c, types...) == "" {
+			notAcceptable(c, types)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// WithRequiredAccept applies RequireAccept to every controller route.
+// Routes producing other types are declared with WithRouteAccept.
+func WithRequiredAccept(types ...string) APIOption {
+	return func(server *API) {
+		server.acceptTypes = types
+	}
+}
+
+// WithRouteAccept overrides the types produced by the route registered with method
+// and path, e.g. "/files/:id". No types disables the check for the route.
+func WithRouteAccept(method, path string, types ...string) APIOption {
+	return func(server *API) {
+		if server.routeAcceptTypes == nil {
+			server.routeAcceptTypes = make(map[string][]string)
+		}
+
+		server.routeAcceptTypes[method+" "+path] = types
+	}
+}
+
+// Negotiate returns the type of offered preferred by the Accept header, honoring
+// quality values and wildcards such as application/*. It returns the first offered
+// type when there is no Accept header, and "" when none is acceptable.
+func Negotiate(c *gin.Context, offered ...string) string {
+	header := c.GetHeader("Accept")
+
+	if strings.TrimSpace(header) == "" && len(offered) > 0 {
+		return offered[0]
+	}
+
+	best, bestQ := "", 0.0
+
+	for _, part := range strings.Split(header, ",") {
+		accepted, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		if q <= bestQ {
+			continue
+		}
+
+		for _, t := range offered {
+			if mediaTypeMatches(accepted, t) {
+				best, bestQ = t, q
+				break
+			}
+		}
+	}
+
+	return best
+}
+
+func mediaTypeMatches(accepted, offered string) bool {
+	if accepted == "*/*" || strings.EqualFold(accepted, offered) {
+		return true
+	}
+
+	if strings.HasSuffix(accepted, "/*") {
+		return strings.HasPrefix(strings.ToLower(offered), strings.ToLower(strings.TrimSuffix(accepted, "*")))
+	}
+
+	return false
+}
+
+func acceptMiddleware(types []string, routes map[string][]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		offered, ok := routes[c.Request.Method+" "+c.FullPath()]
+
+		if !ok {
+			offered = types
+		}
+
+		if len(offered) > 0 && Negotiate(c, offered...) == "" {
+			notAcceptable(c, offered)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func notAcceptable(c *gin.Context, types []string) {
+	c.AbortWithStatusJSON(http.StatusNotAcceptable, NewError(http.StatusNotAcceptable,
+		"not acceptable, available types are "+strings.Join(types, ", ")))
+}
@@ -0,0 +1,42 @@
+package grok
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultAPIKeyHeader ...
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// APIKeyAuth accepts requests whose header matches one of keys.
+// Several keys can be valid at once to allow rotation.
+func APIKeyAuth(keys []string, header string) gin.HandlerFunc {
+	if header == "" {
+		header = DefaultAPIKeyHeader
+	}
+
+	return func(c *gin.Context) {
+		if !validAPIKey(keys, c.GetHeader(header)) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, NewError(http.StatusUnauthorized, "invalid api key"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func validAPIKey(keys []string, key string) bool {
+	valid := 0
+
+	if key == "" {
+		return false
+	}
+
+	for _, k := range keys {
+		valid |= subtle.ConstantTimeCompare([]byte(k), []byte(key))
+	}
+
+	return valid == 1
+}
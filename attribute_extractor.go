@@ -0,0 +1,41 @@
+package grok
+
+// AttributeExtractor returns the attributes derived from a published body, e.g. its event type.
+type AttributeExtractor func(body interface{}) map[string]string
+
+// WithAttributeExtractor sets attributes derived from the body on every publish. Explicit
+// attributes take precedence over extracted ones. PublishCloudEvent extracts from the event data.
+func WithAttributeExtractor(extractor AttributeExtractor) PubSubProducerOption {
+	return func(p *PubSubProducer) {
+		p.extractor = extractor
+	}
+}
+
+// extractAttributes merges the attributes extracted from body under attributes.
+func (p *PubSubProducer) extractAttributes(body interface{}, attributes map[string]string) map[string]string {
+	if p.extractor == nil {
+		return attributes
+	}
+
+	if _, ok := body.(cloudEventEnvelope); ok {
+		return attributes
+	}
+
+	extracted := p.extractor(body)
+
+	if len(extracted) == 0 {
+		return attributes
+	}
+
+	merged := make(map[string]string, len(extracted)+len(attributes))
+
+	for k, v := range extracted {
+		merged[k] = v
+	}
+
+	for k, v := range attributes {
+		merged[k] = v
+	}
+
+	return merged
+}
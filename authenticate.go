@@ -25,7 +25,7 @@ type Authenticate interface {
 
 // Auth0Authenticate ...
 type Auth0Authenticate struct {
-	memoryCache    *cache.Cache
+	principals     *PrincipalCache
 	auth           *APIAuth
 	auth0Validator *auth0.JWTValidator
 }
@@ -44,7 +44,12 @@ func CreateAuthenticate(auth *APIAuth, cache *cache.Cache) Authenticate {
 
 // NewAuthenticate ...
 func NewAuthenticate(auth *APIAuth, cache *cache.Cache) Authenticate {
-	a := &Auth0Authenticate{auth: auth, memoryCache: cache}
+	return NewAuthenticateWithCache(auth, NewPrincipalCache(cache, 0))
+}
+
+// NewAuthenticateWithCache ...
+func NewAuthenticateWithCache(auth *APIAuth, principals *PrincipalCache) Authenticate {
+	a := &Auth0Authenticate{auth: auth, principals: principals}
 
 	a.auth0Validator = auth0.NewValidator(
 		auth0.NewConfiguration(
@@ -68,8 +73,8 @@ func (a *Auth0Authenticate) Middleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		jwt := c.Request.Header.Get("authorization")
 
-		if claims, found := a.memoryCache.Get(jwt); found {
-			a.setKeys(c, claims.(map[string]interface{}))
+		if claims, found := a.principals.GetPrincipal(jwt); found {
+			a.setKeys(c, claims)
 			c.Next()
 			return
 		}
@@ -79,19 +84,20 @@ func (a *Auth0Authenticate) Middleware() gin.HandlerFunc {
 		if err != nil {
 			c.Error(err)
 			c.AbortWithStatus(http.StatusUnauthorized)
+			return
 		}
 
 		claims := make(map[string]interface{})
 		if err := a.auth0Validator.Claims(c.Request, token, &claims); err != nil {
 			c.Error(err)
 			c.AbortWithStatus(http.StatusUnauthorized)
+			return
 		}
 
 		a.setKeys(c, claims)
 
-		if exp, ok := claims["exp"]; ok {
-			float := exp.(float64)
-			a.memoryCache.Set(jwt, claims, time.Second*time.Duration(int64(float)))
+		if exp, ok := claims["exp"].(float64); ok {
+			a.principals.SetPrincipal(jwt, claims, time.Unix(int64(exp), 0))
 		}
 
 		c.Next()
@@ -0,0 +1,141 @@
+package grok_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/patrickmn/go-cache"
+	"github.com/recoli-tech/grok"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const authTenant = "https://tenant.auth0.com/"
+
+type authFixture struct {
+	jwks    *httptest.Server
+	cache   *cache.Cache
+	engine  *gin.Engine
+	signer  jose.Signer
+	handled int
+}
+
+func newAuthFixture(t *testing.T) *authFixture {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: key, KeyID: "test"}},
+		(&jose.SignerOptions{}).WithType("JWT"))
+	assert.NoError(t, err)
+
+	f := &authFixture{cache: cache.New(time.Hour, time.Hour), signer: signer}
+
+	f.jwks = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+		}})
+	}))
+
+	authenticate := grok.NewAuthenticate(&grok.APIAuth{
+		Tenant:   authTenant,
+		JWKS:     f.jwks.URL,
+		Audience: []string{"api"},
+	}, f.cache)
+
+	f.engine = gin.New()
+	f.engine.GET("/", authenticate.Middleware(), func(c *gin.Context) {
+		f.handled++
+		c.Status(http.StatusOK)
+	})
+
+	return f
+}
+
+func (f *authFixture) token(t *testing.T, expiry time.Time) string {
+	token, err := jwt.Signed(f.signer).Claims(jwt.Claims{
+		Issuer:   authTenant,
+		Subject:  "auth0|user",
+		Audience: jwt.Audience{"api"},
+		Expiry:   jwt.NewNumericDate(expiry),
+	}).CompactSerialize()
+	assert.NoError(t, err)
+
+	return token
+}
+
+func (f *authFixture) get(token string) int {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	f.engine.ServeHTTP(w, req)
+
+	return w.Code
+}
+
+func TestAuthenticateRejectsMissingToken(t *testing.T) {
+	f := newAuthFixture(t)
+	defer f.jwks.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, f.get(""))
+	assert.Equal(t, 0, f.handled)
+}
+
+func TestAuthenticateDoesNotCacheExpiredTokens(t *testing.T) {
+	f := newAuthFixture(t)
+	defer f.jwks.Close()
+
+	expired := f.token(t, time.Now().Add(-time.Hour))
+
+	assert.Equal(t, http.StatusUnauthorized, f.get(expired))
+	assert.Equal(t, http.StatusUnauthorized, f.get(expired))
+	assert.Equal(t, 0, f.handled)
+	assert.Equal(t, 0, f.cache.ItemCount())
+}
+
+func TestAuthenticateCachesUntilTokenExpiry(t *testing.T) {
+	f := newAuthFixture(t)
+	defer f.jwks.Close()
+
+	expiry := time.Now().Add(time.Minute)
+
+	assert.Equal(t, http.StatusOK, f.get(f.token(t, expiry)))
+	assert.Equal(t, 1, f.handled)
+
+	for _, item := range f.cache.Items() {
+		assert.WithinDuration(t, expiry, time.Unix(0, item.Expiration), 2*time.Second)
+	}
+
+	assert.Equal(t, 1, f.cache.ItemCount())
+}
+
+func TestPrincipalCacheTTL(t *testing.T) {
+	c := cache.New(time.Hour, time.Hour)
+	principals := grok.NewPrincipalCache(c, time.Second)
+
+	principals.SetPrincipal("token", map[string]interface{}{"sub": "user"}, time.Now().Add(time.Hour))
+	principals.SetPrincipal("expired", map[string]interface{}{"sub": "user"}, time.Now().Add(-time.Hour))
+
+	claims, found := principals.GetPrincipal("token")
+	assert.True(t, found)
+	assert.Equal(t, "user", claims["sub"])
+
+	_, found = principals.GetPrincipal("expired")
+	assert.False(t, found)
+
+	for _, item := range c.Items() {
+		assert.WithinDuration(t, time.Now().Add(time.Second), time.Unix(0, item.Expiration), time.Second)
+	}
+}
@@ -0,0 +1,109 @@
+// Package avro decodes messages in the Confluent Avro wire format, a zero magic
+// byte and a big endian schema id followed by the Avro binary payload, fetching
+// the writer schemas from a schema registry:
+//
+//	registry := avro.NewRegistry(url, avro.WithBasicAuth(key, secret))
+//	subscriber := grok.NewPubSubSubscriber(grok.WithCodec(avro.NewCodec(registry)), ...)
+package avro
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// MagicByte starts every message in the wire format.
+const MagicByte = 0
+
+var (
+	// ErrInvalidFrame is returned for data not in the wire format.
+	ErrInvalidFrame = errors.New("avro: invalid wire format")
+)
+
+// Codec implements grok.Codec for the Confluent Avro wire format.
+type Codec struct {
+	registry *Registry
+
+	mu     sync.RWMutex
+	codecs map[int32]*goavro.Codec
+}
+
+// NewCodec ...
+func NewCodec(registry *Registry) *Codec {
+	return &Codec{registry: registry, codecs: map[int32]*goavro.Codec{}}
+}
+
+// Decode returns the native value when t is nil, such as map[string]interface{} for
+// records, or a pointer to a new t filled from the native value following its json tags.
+func (c *Codec) Decode(data []byte, t reflect.Type) (interface{}, error) {
+	id, payload, err := Unframe(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	codec, err := c.codec(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	native, _, err := codec.NativeFromBinary(payload)
+
+	if err != nil || t == nil {
+		return native, err
+	}
+
+	raw, err := json.Marshal(native)
+
+	if err != nil {
+		return nil, err
+	}
+
+	body := reflect.New(t).Interface()
+
+	return body, json.Unmarshal(raw, body)
+}
+
+// codec returns the codec of the schema registered with id.
+func (c *Codec) codec(id int32) (*goavro.Codec, error) {
+	c.mu.RLock()
+	codec, ok := c.codecs[id]
+	c.mu.RUnlock()
+
+	if ok {
+		return codec, nil
+	}
+
+	schema, err := c.registry.Schema(context.Background(), id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	codec, err = goavro.NewCodec(schema)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.codecs[id] = codec
+	c.mu.Unlock()
+
+	return codec, nil
+}
+
+// Unframe returns the schema id and the Avro payload of data.
+func Unframe(data []byte) (int32, []byte, error) {
+	if len(data) < 5 || data[0] != MagicByte {
+		return 0, nil, ErrInvalidFrame
+	}
+
+	return int32(binary.BigEndian.Uint32(data[1:5])), data[5:], nil
+}
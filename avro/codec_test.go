@@ -0,0 +1,61 @@
+package avro_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/recoli-tech/grok/avro"
+	"github.com/stretchr/testify/assert"
+)
+
+const orderSchema = `{"type":"record","name":"order","fields":[{"name":"id","type":"string"},{"name":"total","type":"double"}]}`
+
+type order struct {
+	ID    string  `json:"id"`
+	Total float64 `json:"total"`
+}
+
+func TestCodec(t *testing.T) {
+	requests := 0
+
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		user, password, _ := r.BasicAuth()
+		assert.Equal(t, "key", user)
+		assert.Equal(t, "secret", password)
+		assert.Equal(t, "/schemas/ids/258", r.URL.Path)
+
+		w.Write([]byte(`{"schema":` + strconv.Quote(orderSchema) + `}`))
+	}))
+	defer registry.Close()
+
+	writer, err := goavro.NewCodec(orderSchema)
+	assert.NoError(t, err)
+
+	payload, err := writer.BinaryFromNative(nil, map[string]interface{}{"id": "ab", "total": 10.5})
+	assert.NoError(t, err)
+
+	data := append([]byte{avro.MagicByte, 0, 0, 1, 2}, payload...)
+	codec := avro.NewCodec(avro.NewRegistry(registry.URL, avro.WithBasicAuth("key", "secret")))
+
+	native, err := codec.Decode(data, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": "ab", "total": 10.5}, native)
+
+	typed, err := codec.Decode(data, reflect.TypeOf(order{}))
+	assert.NoError(t, err)
+	assert.Equal(t, &order{ID: "ab", Total: 10.5}, typed)
+
+	assert.Equal(t, 1, requests)
+
+	_, err = codec.Decode([]byte(`{"id":"ab"}`), nil)
+	assert.Equal(t, avro.ErrInvalidFrame, err)
+
+	_, err = codec.Decode([]byte{avro.MagicByte, 0, 0, 1, 2, 0xff}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,106 @@
+package avro
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Registry fetches schemas by id from a Confluent compatible schema registry,
+// caching them since registered schemas never change.
+type Registry struct {
+	url      string
+	username string
+	password string
+	client   *http.Client
+
+	mu      sync.RWMutex
+	schemas map[int32]string
+}
+
+// RegistryOption ...
+type RegistryOption func(*Registry)
+
+// WithBasicAuth authenticates registry requests, e.g. with a Confluent Cloud
+// API key and secret as username and password.
+func WithBasicAuth(username, password string) RegistryOption {
+	return func(r *Registry) {
+		r.username = username
+		r.password = password
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts or mTLS.
+func WithHTTPClient(client *http.Client) RegistryOption {
+	return func(r *Registry) {
+		r.client = client
+	}
+}
+
+// NewRegistry creates a registry client for the registry at url.
+func NewRegistry(url string, opts ...RegistryOption) *Registry {
+	registry := &Registry{
+		url:     strings.TrimSuffix(url, "/"),
+		client:  http.DefaultClient,
+		schemas: map[int32]string{},
+	}
+
+	for _, opt := range opts {
+		opt(registry)
+	}
+
+	return registry
+}
+
+// Schema returns the schema registered with id.
+func (r *Registry) Schema(ctx context.Context, id int32) (string, error) {
+	r.mu.RLock()
+	schema, ok := r.schemas[id]
+	r.mu.RUnlock()
+
+	if ok {
+		return schema, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/schemas/ids/%d", r.url, id), nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	res, err := r.client.Do(req)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching schema %d: registry responded %d", id, res.StatusCode)
+	}
+
+	body := struct {
+		Schema string `json:"schema"`
+	}{}
+
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	r.schemas[id] = body.Schema
+	r.mu.Unlock()
+
+	return body.Schema, nil
+}
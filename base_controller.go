@@ -0,0 +1,117 @@
+package grok
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// BaseController can be embedded by controllers to get the common helpers
+// without repeating them in every controller.
+type BaseController struct{}
+
+// Bind ...
+func (BaseController) Bind(c *gin.Context, req interface{}) error {
+	return Bind(c, req)
+}
+
+// BindRequest ...
+func (BaseController) BindRequest(c *gin.Context, req interface{}) error {
+	return BindRequest(c, req)
+}
+
+// OK ...
+func (BaseController) OK(c *gin.Context, data interface{}) {
+	OK(c, data)
+}
+
+// Created ...
+func (BaseController) Created(c *gin.Context, data interface{}) {
+	Created(c, data)
+}
+
+// NoContent ...
+func (BaseController) NoContent(c *gin.Context) {
+	NoContent(c)
+}
+
+// Bind decodes the JSON body into req and validates it with the API validator.
+// When it fails the error response is already written, see WithBindErrorHandler,
+// and the error is returned.
+func Bind(c *gin.Context, req interface{}) error {
+	if err := c.ShouldBindJSON(req); err != nil {
+		bindError(c, err, BindingError)
+		return err
+	}
+
+	return validate(c, req)
+}
+
+// BindRequest fills req from the path params, query params, headers and JSON body,
+// following the uri, form, header and json tags, then validates it like Bind.
+// Fields without a tag are matched by their name. time.Time query params are parsed
+// with the time_format tag layout, RFC3339 by default, and time.Duration ones with
+// time.ParseDuration; invalid values respond 400 naming the param.
+func BindRequest(c *gin.Context, req interface{}) error {
+	if err := bindTimeQuery(c, req); err != nil {
+		bindError(c, err, func(c *gin.Context, err error) {
+			c.Error(err)
+			c.JSON(http.StatusBadRequest, err)
+		})
+		return err
+	}
+
+	binders := []func(interface{}) error{c.ShouldBindUri, c.ShouldBindQuery, c.ShouldBindHeader}
+
+	if c.Request.Body != nil && c.Request.ContentLength != 0 {
+		binders = append(binders, c.ShouldBindJSON)
+	}
+
+	for _, bind := range binders {
+		if err := bind(req); err != nil {
+			bindError(c, err, BindingError)
+			return err
+		}
+	}
+
+	return validate(c, req)
+}
+
+func validate(c *gin.Context, req interface{}) error {
+	if err := validatorFromContext(c).Struct(req); err != nil {
+		if _, ok := err.(*validator.InvalidValidationError); ok {
+			return nil
+		}
+
+		bindError(c, err, ValidationError)
+		return err
+	}
+
+	return nil
+}
+
+// ValidationError responds 400 with a message per invalid field.
+func ValidationError(c *gin.Context, err error) {
+	c.Error(err)
+
+	message := FromValidationErros(err)
+	message.Code = http.StatusBadRequest
+
+	c.JSON(message.Code, message)
+}
+
+// OK ...
+func OK(c *gin.Context, data interface{}) {
+	c.JSON(http.StatusOK, data)
+}
+
+// Created ...
+func Created(c *gin.Context, data interface{}) {
+	c.JSON(http.StatusCreated, data)
+}
+
+// NoContent ...
+func NoContent(c *gin.Context) {
+	c.Status(http.StatusNoContent)
+}
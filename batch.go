@@ -0,0 +1,65 @@
+package grok
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// WithRecordBatching decodes messages as JSON arrays of the handled type, calling the
+// handler once per record. The message is acked only when every record succeeds, a
+// failing record retries the whole message, reprocessing the records that succeeded,
+// so handlers must be idempotent.
+func WithRecordBatching() PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.recordBatching = true
+	}
+}
+
+// PublishRecords packs records in a single message for subscribers WithRecordBatching.
+func (p *PubSubProducer) PublishRecords(topicID string, records []interface{}) error {
+	return p.Publish(topicID, records)
+}
+
+func (s *PubSubSubscriber) decodeRecords(data []byte) ([]interface{}, error) {
+	raw := []json.RawMessage{}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	records := make([]interface{}, 0, len(raw))
+
+	for _, r := range raw {
+		if s.handleType == nil {
+			records = append(records, []byte(r))
+			continue
+		}
+
+		record := reflect.New(s.handleType).Interface()
+
+		if err := s.unmarshal(r, record); err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func (s *PubSubSubscriber) handleRecords(ctx context.Context, delivery *Delivery) error {
+	records, _ := delivery.Body.([]interface{})
+
+	for i, record := range records {
+		d := *delivery
+		d.Body = record
+
+		if err := s.handle(ctx, &d); err != nil {
+			return fmt.Errorf("record %d of %d: %w", i+1, len(records), err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package grok
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+const bindErrorHandlerKey = "grok.bind_error_handler"
+
+// BindErrorHandler writes the error response of Bind and BindRequest failures, both
+// binding and validation ones.
+type BindErrorHandler func(c *gin.Context, err error)
+
+// WithBindErrorHandler replaces how Bind and BindRequest respond to failures, e.g. with
+// SafeBindErrorHandler, so every controller responds alike.
+func WithBindErrorHandler(h BindErrorHandler) APIOption {
+	return func(server *API) {
+		server.bindErrorHandler = h
+	}
+}
+
+// SafeBindErrorHandler responds 422 to validation failures, naming the fields, and 400 to
+// malformed bodies, invalid values and other failures, without the parser details, such as offsets.
+func SafeBindErrorHandler(c *gin.Context, err error) {
+	var (
+		validationErrors validator.ValidationErrors
+		typeError        *json.UnmarshalTypeError
+		syntaxError      *json.SyntaxError
+		response         *Error
+	)
+
+	switch {
+	case errors.As(err, &validationErrors):
+		c.Error(err)
+		c.JSON(http.StatusUnprocessableEntity, FromValidationErros(validationErrors))
+		return
+	case errors.As(err, &response):
+		c.Error(err)
+		c.JSON(response.Code, response)
+		return
+	case errors.As(err, &typeError):
+		err = NewError(http.StatusBadRequest, "invalid value for "+typeError.Field)
+	case errors.As(err, &syntaxError), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		err = NewError(http.StatusBadRequest, "malformed JSON body")
+	default:
+		err = NewError(http.StatusBadRequest, "invalid request")
+	}
+
+	c.Error(err)
+	c.JSON(http.StatusBadRequest, err)
+}
+
+func bindErrorMiddleware(h BindErrorHandler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(bindErrorHandlerKey, h)
+		c.Next()
+	}
+}
+
+// bindError responds with the WithBindErrorHandler handler, or with fallback when none is set.
+func bindError(c *gin.Context, err error, fallback BindErrorHandler) {
+	if v, ok := c.Get(bindErrorHandlerKey); ok {
+		if h, ok := v.(BindErrorHandler); ok && h != nil {
+			h(c, err)
+			return
+		}
+	}
+
+	fallback(c, err)
+}
@@ -0,0 +1,104 @@
+package grok
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// bindTimeQuery checks the time.Time and time.Duration query params of req before
+// binding, so parse errors name the offending param. Times are parsed with the
+// time_format tag layout, RFC3339 by default, or as unix seconds with "unix" and
+// nanoseconds with "unixnano". Durations are parsed with time.ParseDuration.
+func bindTimeQuery(c *gin.Context, req interface{}) error {
+	t := reflect.TypeOf(req)
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	return checkTimeQuery(c, t)
+}
+
+func checkTimeQuery(c *gin.Context, t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldType := field.Type
+
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		if field.Anonymous && fieldType.Kind() == reflect.Struct {
+			if err := checkTimeQuery(c, fieldType); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("form"), ",")[0]
+
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		value := c.Query(name)
+
+		if value == "" {
+			continue
+		}
+
+		switch fieldType {
+		case timeType:
+			layout := field.Tag.Get("time_format")
+
+			if err := parseTime(value, layout); err != nil {
+				if layout == "" {
+					layout = time.RFC3339
+				}
+
+				return NewError(http.StatusBadRequest,
+					fmt.Sprintf("invalid time %q for %s, expected format %s", value, name, layout))
+			}
+		case durationType:
+			if _, err := time.ParseDuration(value); err != nil {
+				return NewError(http.StatusBadRequest,
+					fmt.Sprintf("invalid duration %q for %s, expected e.g. 1h30m", value, name))
+			}
+		}
+	}
+
+	return nil
+}
+
+func parseTime(value, layout string) error {
+	switch strings.ToLower(layout) {
+	case "unix", "unixnano":
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err
+	case "":
+		layout = time.RFC3339
+	}
+
+	_, err := time.Parse(layout, value)
+	return err
+}
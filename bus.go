@@ -0,0 +1,107 @@
+package grok
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// MessageBus is the messaging backend a subscriber receives from and publishes its
+// retries and dead letters to. The subscriber client is the default PubSub backend,
+// see WithMessageBus for others, e.g. the kafka package.
+type MessageBus interface {
+	Publisher
+
+	// Receive calls handler with the messages of the subscription on the topic until ctx
+	// is done, returning nil, or receiving fails.
+	Receive(ctx context.Context, subscriptionID, topicID string, handler BusHandler) error
+}
+
+// BusHandler handles a received message, acking or nacking it with ack before returning.
+// The message is the backend agnostic representation of what was received: only its ID,
+// Data, Attributes and PublishTime are set by other backends than PubSub.
+type BusHandler func(ctx context.Context, message *pubsub.Message, ack Acknowledger)
+
+// Acknowledger acks or nacks a received message, a nacked message is redelivered.
+// *pubsub.Message is the Acknowledger of PubSub messages.
+type Acknowledger interface {
+	Ack()
+	Nack()
+}
+
+// WithMessageBus receives from and publishes retries and dead letters to bus instead of
+// the PubSub client. The handler, retries, dlq and middlewares work as with PubSub, while
+// the PubSub specific options, e.g. receive settings, retry topic and dlq subscriptions or
+// Seek, do not apply. Topics are not created, the bus must have them or create them on
+// publish. The bus is not closed by Close.
+func WithMessageBus(bus MessageBus) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.bus = bus
+	}
+}
+
+// messageBus returns the bus Run receives from, the PubSub subscription by default.
+func (s *PubSubSubscriber) messageBus() MessageBus {
+	if s.bus != nil {
+		return s.bus
+	}
+
+	return &pubSubBus{subscriber: s}
+}
+
+// pubSubBus is the MessageBus of the subscriber client, receiving from the subscription
+// set up by the subscriber and publishing with its producer.
+type pubSubBus struct {
+	subscriber *PubSubSubscriber
+}
+
+func (b *pubSubBus) PublishWihAttribrutes(topicID string, data interface{}, attributes map[string]string) error {
+	return b.subscriber.producer.PublishWihAttribrutes(topicID, data, attributes)
+}
+
+func (b *pubSubBus) PublishRaw(topicID string, data []byte, attributes map[string]string) error {
+	return b.subscriber.producer.PublishRaw(topicID, data, attributes)
+}
+
+// Receive receives from the subscription set up by the subscriber, restarting it as
+// configured by WithAutoRestart.
+func (b *pubSubBus) Receive(ctx context.Context, subscriptionID, topicID string, handler BusHandler) error {
+	s := b.subscriber
+	subscription, err := s.setup(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	subscription.ReceiveSettings = s.receiveSettings()
+	s.logReceiveSettings()
+
+	backoff := s.restartBackoff
+
+	for attempt := 1; ; attempt++ {
+		err = subscription.Receive(ctx, func(ctx context.Context, message *pubsub.Message) {
+			handler(ctx, message, message)
+		})
+
+		if err == nil || ctx.Err() != nil {
+			return nil
+		}
+
+		if attempt > s.restartAttempts || !isRetryable(err) {
+			return permissionError(err, subscription.String(), "roles/pubsub.subscriber")
+		}
+
+		s.log.WithError(err).
+			WithField("attempt", attempt).
+			Warnf("restarting consumer %s in %s", s.subscriberID, backoff)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+
+		backoff = nextRestartBackoff(backoff)
+	}
+}
@@ -0,0 +1,89 @@
+package grok
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrClientCertWithoutTLS is returned by NewAPI when WithClientCertAuth is set without WithTLS.
+var ErrClientCertWithoutTLS = errors.New("client certificate authentication requires WithTLS")
+
+// WithTLS serves HTTPS using the given certificate and key files.
+func WithTLS(certFile, keyFile string) APIOption {
+	return func(server *API) {
+		server.tlsCert = certFile
+		server.tlsKey = keyFile
+	}
+}
+
+// WithClientCertAuth authenticates controller routes with client certificates signed
+// by caPool and accepted by verify, which may be nil. It requires WithTLS.
+// Certificates are verified during the handshake when given, but only required on
+// controller routes, so plain probes to healthz, health and swagger keep working.
+// See ClientCertPrincipal for the keys set in the context.
+func WithClientCertAuth(caPool *x509.CertPool, verify func(*x509.Certificate) error) APIOption {
+	return func(server *API) {
+		server.clientCertAuth = true
+		server.clientCAs = caPool
+		server.verifyClientCert = verify
+		server.handlers = append(server.handlers, ClientCertPrincipal())
+	}
+}
+
+// ClientCertPrincipal rejects requests without a verified client certificate and sets
+// the certificate CN as "sub", its SANs as "sans" and its organizational units as
+// "permissions", so Authorize can derive roles from the certificate.
+func ClientCertPrincipal() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, NewError(http.StatusUnauthorized, "client certificate required"))
+			return
+		}
+
+		cert := c.Request.TLS.VerifiedChains[0][0]
+
+		sans := []string{}
+		sans = append(sans, cert.DNSNames...)
+		sans = append(sans, cert.EmailAddresses...)
+
+		for _, uri := range cert.URIs {
+			sans = append(sans, uri.String())
+		}
+
+		permissions := []interface{}{}
+
+		for _, ou := range cert.Subject.OrganizationalUnit {
+			permissions = append(permissions, ou)
+		}
+
+		c.Set("sub", cert.Subject.CommonName)
+		c.Set("sans", sans)
+		c.Set("permissions", permissions)
+
+		c.Next()
+	}
+}
+
+func (server *API) tlsConfig() *tls.Config {
+	if server.clientCAs == nil {
+		return nil
+	}
+
+	verify := server.verifyClientCert
+
+	return &tls.Config{
+		ClientCAs:  server.clientCAs,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		VerifyPeerCertificate: func(raw [][]byte, chains [][]*x509.Certificate) error {
+			if verify == nil || len(chains) == 0 {
+				return nil
+			}
+
+			return verify(chains[0][0])
+		},
+	}
+}
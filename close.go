@@ -0,0 +1,172 @@
+package grok
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/pubsub"
+)
+
+var (
+	// ErrClosed is returned by Run after Close.
+	ErrClosed = errors.New("closed")
+)
+
+// WithOwnedClient is WithClient handing the client over to the subscriber, which closes
+// it on Close. Of the subscribers and producers sharing a client only one should own it.
+func WithOwnedClient(c *pubsub.Client) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.client = c
+		s.ownsClient = true
+	}
+}
+
+// WithProducerOwnedClient hands the client given to NewPubSubProducer over to the
+// producer, which closes it on Close.
+func WithProducerOwnedClient() PubSubProducerOption {
+	return func(p *PubSubProducer) {
+		p.ownsClient = true
+	}
+}
+
+type closer struct {
+	once sync.Once
+	err  error
+}
+
+type multiError []error
+
+func (e multiError) Error() string {
+	messages := make([]string, len(e))
+
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (e multiError) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+// Close flushes the messages being published, interrupting their retry backoffs, and
+// closes the client when owned by the producer, aggregating the errors. It is idempotent; publishing after Close fails.
+func (p *PubSubProducer) Close(ctx context.Context) error {
+	p.closer.once.Do(func() {
+		errs := multiError{}
+
+		close(p.closing)
+
+		if err := p.flush(ctx); err != nil {
+			errs = append(errs, err)
+		}
+
+		if p.ownsClient {
+			if err := p.client.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		p.closer.err = errs.err()
+	})
+
+	return p.closer.err
+}
+
+// flush stops the topics, waiting their pending publishes until ctx is done.
+func (p *PubSubProducer) flush(ctx context.Context) error {
+	p.mu.Lock()
+	topics := make([]*pubsub.Topic, 0, len(p.topics))
+
+	for _, topic := range p.topics {
+		topics = append(topics, topic)
+	}
+
+	p.mu.Unlock()
+
+	stopped := make(chan struct{})
+
+	go func() {
+		for _, topic := range topics {
+			topic.Stop()
+		}
+
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops receiving, waiting Run to return until ctx is done, flushes the retry
+// and dlq producer and closes the client when given by WithOwnedClient, aggregating
+// the errors. It is idempotent and can be called even if Run was never started.
+func (s *PubSubSubscriber) Close(ctx context.Context) error {
+	s.closer.once.Do(func() {
+		errs := multiError{}
+
+		s.lifecycleMu.Lock()
+		s.closed = true
+		cancel, done := s.cancel, s.done
+		s.lifecycleMu.Unlock()
+
+		if cancel != nil {
+			cancel()
+
+			select {
+			case <-done:
+			case <-ctx.Done():
+				errs = append(errs, ctx.Err())
+			}
+		}
+
+		if producer, ok := s.producer.(*PubSubProducer); ok {
+			if err := producer.flush(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		if s.ownsClient && s.client != nil {
+			if err := s.client.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		s.closer.err = errs.err()
+	})
+
+	return s.closer.err
+}
+
+// start registers a running Run, returning the context it receives with and
+// the func to call when it returns.
+func (s *PubSubSubscriber) start(ctx context.Context) (context.Context, func(), error) {
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+
+	if s.closed {
+		return nil, nil, ErrClosed
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	s.cancel = cancel
+	s.done = done
+
+	return ctx, func() {
+		cancel()
+		close(done)
+	}, nil
+}
@@ -0,0 +1,135 @@
+package grok
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CloudEventsSpecVersion is the CloudEvents version written by PublishCloudEvent.
+const CloudEventsSpecVersion = "1.0"
+
+var (
+	// ErrInvalidCloudEvent ...
+	ErrInvalidCloudEvent = errors.New("invalid cloud event")
+)
+
+// CloudEvent is the metadata of a CloudEvents JSON envelope.
+type CloudEvent struct {
+	ID              string     `json:"id"`
+	Source          string     `json:"source"`
+	SpecVersion     string     `json:"specversion"`
+	Type            string     `json:"type"`
+	Subject         string     `json:"subject,omitempty"`
+	DataContentType string     `json:"datacontenttype,omitempty"`
+	Time            *time.Time `json:"time,omitempty"`
+}
+
+type cloudEventEnvelope struct {
+	CloudEvent
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// WithCloudEvents decodes messages as CloudEvents JSON envelopes, unmarshaling data
+// into the handled type and exposing the event in Delivery.Event.
+// Malformed envelopes are sent to the dlq.
+func WithCloudEvents() PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.cloudEvents = true
+	}
+}
+
+// PublishCloudEvent publishes data wrapped in a CloudEvents envelope. Source and Type
+// are required, ID, SpecVersion, Time and DataContentType are filled when empty.
+func (p *PubSubProducer) PublishCloudEvent(ctx context.Context, topicID string, event CloudEvent, data interface{}) error {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+
+	if event.SpecVersion == "" {
+		event.SpecVersion = CloudEventsSpecVersion
+	}
+
+	if event.Time == nil {
+		now := time.Now().UTC()
+		event.Time = &now
+	}
+
+	if event.DataContentType == "" {
+		event.DataContentType = "application/json"
+	}
+
+	if err := event.validate(); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(data)
+
+	if err != nil {
+		return err
+	}
+
+	envelope := cloudEventEnvelope{CloudEvent: event, Data: body}
+
+	return p.PublishContext(ctx, topicID, envelope, p.extractAttributes(data, map[string]string{
+		"content-type": "application/cloudevents+json",
+	}))
+}
+
+func (e CloudEvent) validate() error {
+	missing := []string{}
+
+	if e.ID == "" {
+		missing = append(missing, "id")
+	}
+
+	if e.Source == "" {
+		missing = append(missing, "source")
+	}
+
+	if e.SpecVersion == "" {
+		missing = append(missing, "specversion")
+	}
+
+	if e.Type == "" {
+		missing = append(missing, "type")
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: missing %s", ErrInvalidCloudEvent, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+func (s *PubSubSubscriber) decodeCloudEvent(data []byte) (interface{}, *CloudEvent, error) {
+	envelope := cloudEventEnvelope{}
+
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidCloudEvent, err)
+	}
+
+	if err := envelope.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	if s.handleType == nil {
+		return []byte(envelope.Data), &envelope.CloudEvent, nil
+	}
+
+	body := reflect.New(s.handleType).Interface()
+
+	if len(envelope.Data) > 0 {
+		if err := s.unmarshal(envelope.Data, body); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return body, &envelope.CloudEvent, nil
+}
@@ -0,0 +1,131 @@
+package grok
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/sirupsen/logrus"
+	"go.opencensus.io/trace"
+)
+
+// CloudTraceAttribute carries the trace context in GCP's X-Cloud-Trace-Context format.
+const CloudTraceAttribute = "X-Cloud-Trace-Context"
+
+// WithCloudTrace starts a span for every message, continuing the trace found in
+// CloudTraceAttribute. Spans are exported by the exporter registered with opencensus.
+func WithCloudTrace(projectID string) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.traceProject = projectID
+	}
+}
+
+// WithTracePropagation makes PublishContext inject the span of the context into CloudTraceAttribute.
+func WithTracePropagation() PubSubProducerOption {
+	return func(p *PubSubProducer) {
+		p.propagateTrace = true
+	}
+}
+
+func (s *PubSubSubscriber) startSpan(ctx context.Context, message *pubsub.Message) (context.Context, *trace.Span) {
+	if s.traceProject == "" {
+		return ctx, nil
+	}
+
+	name := fmt.Sprintf("grok.subscriber/%s", s.subscriberID)
+
+	var span *trace.Span
+
+	if parent, ok := parseCloudTraceContext(message.Attributes[CloudTraceAttribute]); ok {
+		ctx, span = trace.StartSpanWithRemoteParent(ctx, name, parent)
+	} else {
+		ctx, span = trace.StartSpan(ctx, name)
+	}
+
+	span.AddAttributes(
+		trace.StringAttribute("subscription", s.subscriberID),
+		trace.StringAttribute("message_id", message.ID),
+		trace.Int64Attribute("retries", int64(s.getRetries(message))),
+	)
+
+	return ctx, span
+}
+
+// traceFields are the fields used by Cloud Logging to correlate log lines with traces.
+func (s *PubSubSubscriber) traceFields(span *trace.Span) logrus.Fields {
+	if span == nil {
+		return nil
+	}
+
+	return logrus.Fields{
+		"logging.googleapis.com/trace": fmt.Sprintf("projects/%s/traces/%s", s.traceProject, span.SpanContext().TraceID),
+	}
+}
+
+func injectCloudTrace(ctx context.Context, attributes map[string]string) map[string]string {
+	span := trace.FromContext(ctx)
+
+	if span == nil {
+		return attributes
+	}
+
+	injected := make(map[string]string, len(attributes)+1)
+
+	for k, v := range attributes {
+		injected[k] = v
+	}
+
+	injected[CloudTraceAttribute] = formatCloudTraceContext(span.SpanContext())
+
+	return injected
+}
+
+// parseCloudTraceContext parses TRACE_ID/SPAN_ID;o=OPTIONS
+func parseCloudTraceContext(value string) (trace.SpanContext, bool) {
+	sc := trace.SpanContext{}
+	slash := strings.Index(value, "/")
+
+	if slash < 0 {
+		return sc, false
+	}
+
+	traceID, err := hex.DecodeString(value[:slash])
+
+	if err != nil || len(traceID) != len(sc.TraceID) {
+		return sc, false
+	}
+
+	copy(sc.TraceID[:], traceID)
+
+	spanID, options := value[slash+1:], ""
+
+	if semicolon := strings.Index(spanID, ";"); semicolon >= 0 {
+		spanID, options = spanID[:semicolon], spanID[semicolon+1:]
+	}
+
+	id, err := strconv.ParseUint(spanID, 10, 64)
+
+	if err != nil {
+		return sc, false
+	}
+
+	binary.BigEndian.PutUint64(sc.SpanID[:], id)
+
+	if options == "o=1" {
+		sc.TraceOptions = trace.TraceOptions(1)
+	}
+
+	return sc, true
+}
+
+func formatCloudTraceContext(sc trace.SpanContext) string {
+	return fmt.Sprintf("%s/%d;o=%d",
+		hex.EncodeToString(sc.TraceID[:]),
+		binary.BigEndian.Uint64(sc.SpanID[:]),
+		sc.TraceOptions&1,
+	)
+}
@@ -0,0 +1,19 @@
+package grok
+
+import (
+	"reflect"
+)
+
+// Codec decodes message data into the handled type, or into its own representation
+// when t is nil. See the avro package for an Avro codec.
+type Codec interface {
+	Decode(data []byte, t reflect.Type) (interface{}, error)
+}
+
+// WithCodec decodes messages with codec instead of JSON.
+// It does not apply to CloudEvents nor batched records.
+func WithCodec(codec Codec) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.codec = codec
+	}
+}
@@ -0,0 +1,102 @@
+package grok
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// ContentEncodingAttribute tells the subscriber how the message data is compressed.
+const ContentEncodingAttribute = "content-encoding"
+
+// DefaultMaxDecompressedSize bounds decompressed message data unless WithMaxDecompressedSize is set.
+const DefaultMaxDecompressedSize = 64 << 20
+
+// ErrDecompressedTooLarge is returned when decompressed message data exceeds the configured maximum.
+var ErrDecompressedTooLarge = errors.New("decompressed message data exceeds the maximum size")
+
+// Compression ...
+type Compression string
+
+const (
+	// CompressionGzip ...
+	CompressionGzip Compression = "gzip"
+)
+
+// WithCompression compresses published bodies, setting ContentEncodingAttribute so
+// subscribers decompress them before decoding. It trades producer and subscriber CPU
+// for smaller messages, worth it for large JSON payloads but not for small ones.
+func WithCompression(c Compression) PubSubProducerOption {
+	return func(p *PubSubProducer) {
+		p.compression = c
+	}
+}
+
+// WithMaxDecompressedSize - default DefaultMaxDecompressedSize. It bounds how many bytes a
+// compressed message may expand to; larger messages fail with ErrDecompressedTooLarge.
+// A non-positive size disables the limit.
+func WithMaxDecompressedSize(size int64) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.maxDecompressedSize = size
+	}
+}
+
+func compress(c Compression, body []byte) ([]byte, error) {
+	switch c {
+	case CompressionGzip:
+		buf := new(bytes.Buffer)
+		w := gzip.NewWriter(buf)
+
+		if _, err := w.Write(body); err != nil {
+			return nil, err
+		}
+
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", c)
+	}
+}
+
+// messageData returns the message data, decompressed when ContentEncodingAttribute is set.
+// Decompressed data longer than limit fails with ErrDecompressedTooLarge unless limit is non-positive.
+func messageData(message *pubsub.Message, limit int64) ([]byte, error) {
+	switch encoding := message.Attributes[ContentEncodingAttribute]; encoding {
+	case "":
+		return message.Data, nil
+	case string(CompressionGzip):
+		r, err := gzip.NewReader(bytes.NewReader(message.Data))
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer r.Close()
+
+		if limit <= 0 {
+			return ioutil.ReadAll(r)
+		}
+
+		data, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if int64(len(data)) > limit {
+			return nil, ErrDecompressedTooLarge
+		}
+
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
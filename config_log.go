@@ -0,0 +1,81 @@
+package grok
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultConfigLogLevel is the default level of the "effective config" line logged when
+// a subscriber runs and when an API is created. Its fields are stable and secrets are
+// never logged.
+const DefaultConfigLogLevel = logrus.InfoLevel
+
+// WithConfigLogLevel sets the level of the API "effective config" line - default
+// DefaultConfigLogLevel.
+func WithConfigLogLevel(level logrus.Level) APIOption {
+	return func(server *API) {
+		server.configLogLevel = level
+	}
+}
+
+// WithSubscriberConfigLogLevel sets the level of the subscriber "effective config" line -
+// default DefaultConfigLogLevel.
+func WithSubscriberConfigLogLevel(level logrus.Level) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.configLogLevel = level
+	}
+}
+
+const effectiveConfigMessage = "effective config"
+
+func (s *PubSubSubscriber) logConfig() {
+	dlqTopic := s.DLQTopicID()
+
+	if s.noDLQ || s.noDLQTopic {
+		dlqTopic = ""
+	}
+
+	s.log.WithFields(logrus.Fields{
+		"ack_deadline":             s.ackDeadline.String(),
+		"handler_timeout":          s.handlerTimeout.String(),
+		"max_retries":              s.maxRetries,
+		"max_outstanding_messages": s.maxOutstandingMessages,
+		"max_extension":            s.maxExtension.String(),
+		"dlq":                      !s.noDLQ,
+		"dlq_topic":                dlqTopic,
+		"dlq_sink":                 s.deadLetterSink != nil,
+		"dlq_router":               s.dlqRouter != nil,
+		"retry_topic":              s.retryTopic,
+		"cloud_events":             s.cloudEvents,
+		"decryption":               s.decrypt != nil,
+		"record_batching":          s.recordBatching,
+		"serial":                   s.serial,
+		"paused":                   s.Paused(),
+		"grace_period":             s.gracePeriod.String(),
+		"existing_subscription":    s.existingSubscription != nil,
+	}).Log(s.configLogLevel, effectiveConfigMessage)
+}
+
+func (server *API) logConfig() {
+	fields := logrus.Fields{
+		"host":             server.settings.API.Host,
+		"tls":              server.tlsCert != "",
+		"client_certs":     server.clientCAs != nil,
+		"cors":             server.cors || server.corsConfig != nil,
+		"metrics":          server.metrics,
+		"api_key_auth":     server.apiKeyAuth,
+		"auth":             server.settings.API.Auth != nil,
+		"fake_auth":        server.settings.API.Auth != nil && server.settings.API.Auth.Fake,
+		"trusted_proxies":  server.trustedProxies,
+		"https_redirect":   server.httpsRedirect,
+		"readiness_gate":   server.readinessGate,
+		"content_types":    server.contentTypes,
+		"accept_types":     server.acceptTypes,
+		"containers":       len(server.containers),
+		"debug":            server.settings.API.Debug,
+		"log_redaction":    server.logRedaction,
+		"handlers":         len(server.handlers),
+		"response_headers": len(server.responseHeaders),
+	}
+
+	logrus.WithFields(fields).Log(server.configLogLevel, effectiveConfigMessage)
+}
@@ -1,7 +1,117 @@
 package grok
 
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrNoControllers is returned by NewAPI with WithRequireControllers when no controller is registered.
+var ErrNoControllers = errors.New("no controllers registered")
+
+// WithRequireControllers fails NewAPI with ErrNoControllers, and New panics, when the
+// containers register no controller, catching controllers missing from the container.
+func WithRequireControllers() APIOption {
+	return func(server *API) {
+		server.requireControllers = true
+	}
+}
+
 // Container ...
 type Container interface {
 	Close() error
 	Controllers() []APIController
 }
+
+// Starter is implemented by containers that start resources, such as connections,
+// before the API serves. Service calls Start of every container in order.
+type Starter interface {
+	Start() error
+}
+
+// containers composes the containers given to the API.
+type containers []Container
+
+func (cs containers) Controllers() []APIController {
+	controllers := []APIController{}
+
+	for _, c := range cs {
+		controllers = append(controllers, c.Controllers()...)
+	}
+
+	return controllers
+}
+
+// Start starts the containers in order, stopping at the first error.
+func (cs containers) Start() error {
+	for _, c := range cs {
+		if starter, ok := c.(Starter); ok {
+			if err := starter.Start(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Close closes every container in order, aggregating the errors.
+func (cs containers) Close() error {
+	errs := multiError{}
+
+	for _, c := range cs {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs.err()
+}
+
+// registerControllers registers the controllers of every container on router. The routes
+// of each container are planned on a scratch engine first, so a route registered twice is
+// returned as an error naming the container owning it, instead of gin panicking.
+func registerControllers(engine *gin.Engine, router *gin.RouterGroup, controllers [][]APIController) error {
+	owners := make(map[string]int)
+
+	for _, route := range engine.Routes() {
+		owners[route.Method+" "+route.Path] = -1
+	}
+
+	for i, ctrls := range controllers {
+		for _, route := range plannedRoutes(router.BasePath(), ctrls) {
+			key := route.Method + " " + route.Path
+
+			if owner, ok := owners[key]; ok {
+				if owner < 0 {
+					return fmt.Errorf("container %d: route %s is already registered by the API", i, key)
+				}
+
+				return fmt.Errorf("container %d: route %s is already registered by container %d", i, key, owner)
+			}
+
+			owners[key] = i
+		}
+	}
+
+	for _, ctrls := range controllers {
+		for _, ctrl := range ctrls {
+			ctrl.RegisterRoutes(router)
+		}
+	}
+
+	return nil
+}
+
+// plannedRoutes returns the routes controllers register under basePath.
+func plannedRoutes(basePath string, controllers []APIController) gin.RoutesInfo {
+	engine := gin.New()
+	router := engine.Group(basePath)
+
+	for _, ctrl := range controllers {
+		ctrl.RegisterRoutes(router)
+	}
+
+	return engine.Routes()
+}
@@ -0,0 +1,90 @@
+package grok
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireContentType responds 415 to POST, PUT, PATCH and DELETE requests with a body
+// whose content type is not one of types.
+func RequireContentType(types ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !acceptedContentType(c, types) {
+			unsupportedMediaType(c, types)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// WithRequiredContentType applies RequireContentType to every controller route.
+// Routes accepting other types are declared with WithRouteContentType.
+func WithRequiredContentType(types ...string) APIOption {
+	return func(server *API) {
+		server.contentTypes = types
+	}
+}
+
+// WithRouteContentType overrides the required content types of the route registered
+// with method and path, e.g. "/files/:id". No types disables the check for the route.
+func WithRouteContentType(method, path string, types ...string) APIOption {
+	return func(server *API) {
+		if server.routeContentTypes == nil {
+			server.routeContentTypes = make(map[string][]string)
+		}
+
+		server.routeContentTypes[method+" "+path] = types
+	}
+}
+
+func contentTypeMiddleware(types []string, routes map[string][]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accepted, ok := routes[c.Request.Method+" "+c.FullPath()]
+
+		if !ok {
+			accepted = types
+		}
+
+		if len(accepted) > 0 && !acceptedContentType(c, accepted) {
+			unsupportedMediaType(c, accepted)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func acceptedContentType(c *gin.Context, types []string) bool {
+	switch c.Request.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return true
+	}
+
+	if c.Request.Body == nil || c.Request.ContentLength == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+
+	if err != nil {
+		return false
+	}
+
+	for _, t := range types {
+		if strings.EqualFold(mediaType, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func unsupportedMediaType(c *gin.Context, types []string) {
+	c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, NewError(http.StatusUnsupportedMediaType,
+		"unsupported content type, expected "+strings.Join(types, ", ")))
+}
@@ -12,6 +12,36 @@ type APIController interface {
 	RegisterRoutes(*gin.RouterGroup)
 }
 
+// Route is a route declared by a RoutesController, served by Handler after Middlewares.
+type Route struct {
+	Method      string
+	Path        string
+	Middlewares []gin.HandlerFunc
+	Handler     gin.HandlerFunc
+}
+
+// RoutesController declares its routes instead of registering them on the router.
+type RoutesController interface {
+	Routes() []Route
+}
+
+// Routes adapts a RoutesController to an APIController, so it can be returned by
+// Container.Controllers along with the controllers registering their routes.
+func Routes(ctrl RoutesController) APIController {
+	return routesController{ctrl}
+}
+
+type routesController struct {
+	RoutesController
+}
+
+func (ctrl routesController) RegisterRoutes(r *gin.RouterGroup) {
+	for _, route := range ctrl.Routes() {
+		handlers := append(append([]gin.HandlerFunc{}, route.Middlewares...), route.Handler)
+		r.Handle(route.Method, route.Path, handlers...)
+	}
+}
+
 //BindingError ...
 func BindingError(context *gin.Context, err error) {
 	context.Error(err)
@@ -1,13 +1,40 @@
 package grok_test
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/patrickmn/go-cache"
 	"github.com/recoli-tech/grok"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
 )
 
 type APIControllerTestSuite struct {
@@ -17,22 +44,111 @@ type APIControllerTestSuite struct {
 	server   *grok.API
 }
 
-type testContainer struct{}
+type testContainer struct {
+	controllers []grok.APIController
+}
 
 func (c *testContainer) Controllers() []grok.APIController {
-	return nil
+	return c.controllers
 }
 
 func (c *testContainer) Close() error {
 	return nil
 }
 
+type testItem struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type testController struct {
+	grok.BaseController
+}
+
+func (ctrl *testController) RegisterRoutes(r *gin.RouterGroup) {
+	r.POST("/items", func(c *gin.Context) {
+		item := new(testItem)
+
+		if err := ctrl.Bind(c, item); err != nil {
+			return
+		}
+
+		ctrl.Created(c, item)
+	})
+}
+
+type testItemRequest struct {
+	ID      string `uri:"id" validate:"required"`
+	Tenant  string `header:"X-Tenant" validate:"required"`
+	Verbose bool   `form:"verbose"`
+	Name    string `json:"name" validate:"required"`
+}
+
+type testRequestController struct {
+	grok.BaseController
+}
+
+func (ctrl *testRequestController) RegisterRoutes(r *gin.RouterGroup) {
+	r.PUT("/items/:id", func(c *gin.Context) {
+		req := new(testItemRequest)
+
+		if err := ctrl.BindRequest(c, req); err != nil {
+			return
+		}
+
+		ctrl.OK(c, req)
+	})
+}
+
+type testCustomItem struct {
+	Name string `json:"name" validate:"grok"`
+}
+
+type testCustomController struct {
+	grok.BaseController
+}
+
+func (ctrl *testCustomController) RegisterRoutes(r *gin.RouterGroup) {
+	r.POST("/custom", func(c *gin.Context) {
+		item := new(testCustomItem)
+
+		if err := ctrl.Bind(c, item); err != nil {
+			return
+		}
+
+		ctrl.OK(c, item)
+	})
+}
+
+type testRoutesController struct {
+	grok.BaseController
+}
+
+func (ctrl *testRoutesController) Routes() []grok.Route {
+	return []grok.Route{
+		{
+			Method:  http.MethodGet,
+			Path:    "/public",
+			Handler: func(c *gin.Context) { ctrl.NoContent(c) },
+		},
+		{
+			Method: http.MethodGet,
+			Path:   "/admin",
+			Middlewares: []gin.HandlerFunc{func(c *gin.Context) {
+				c.AbortWithStatus(http.StatusForbidden)
+			}},
+			Handler: func(c *gin.Context) { ctrl.NoContent(c) },
+		},
+	}
+}
+
 func TestAPIControllerTestSuite(t *testing.T) {
 	suite.Run(t, new(APIControllerTestSuite))
 }
 
 func (s *APIControllerTestSuite) SetupTest() {
-	container := &testContainer{}
+	container := &testContainer{
+		controllers: []grok.APIController{&testController{}},
+	}
 	s.assert = assert.New(s.T())
 	s.settings = &grok.Settings{}
 	grok.FromYAML("tests/config.yaml", s.settings)
@@ -48,6 +164,24 @@ func (s *APIControllerTestSuite) TestNotFound() {
 	s.server.Engine.ServeHTTP(response, req)
 
 	s.assert.Equal(http.StatusNotFound, response.Code)
+	s.assert.JSONEq(`{"code":404,"messages":["resource not found"]}`, response.Body.String())
+}
+
+func (s *APIControllerTestSuite) TestCustomNotFound() {
+	server := grok.New(
+		grok.WithSettings(s.settings),
+		grok.WithContainer(&testContainer{}),
+		grok.WithNotFoundHandler(func(c *gin.Context) {
+			c.String(http.StatusOK, "index")
+		}))
+
+	req := httptest.NewRequest("GET", "/app/route", nil)
+	response := httptest.NewRecorder()
+
+	server.Engine.ServeHTTP(response, req)
+
+	s.assert.Equal(http.StatusOK, response.Code)
+	s.assert.Equal("index", response.Body.String())
 }
 
 func (s *APIControllerTestSuite) TestSwagger() {
@@ -58,3 +192,1078 @@ func (s *APIControllerTestSuite) TestSwagger() {
 
 	s.assert.Equal(http.StatusOK, response.Code)
 }
+
+func (s *APIControllerTestSuite) TestBind() {
+	req := httptest.NewRequest("POST", "/items", strings.NewReader(`{"name":"grok"}`))
+	response := httptest.NewRecorder()
+
+	s.server.Engine.ServeHTTP(response, req)
+
+	s.assert.Equal(http.StatusCreated, response.Code)
+}
+
+func (s *APIControllerTestSuite) TestBindValidationError() {
+	req := httptest.NewRequest("POST", "/items", strings.NewReader(`{}`))
+	response := httptest.NewRecorder()
+
+	s.server.Engine.ServeHTTP(response, req)
+
+	s.assert.Equal(http.StatusBadRequest, response.Code)
+}
+
+func (s *APIControllerTestSuite) TestBindMalformed() {
+	req := httptest.NewRequest("POST", "/items", strings.NewReader(`{`))
+	response := httptest.NewRecorder()
+
+	s.server.Engine.ServeHTTP(response, req)
+
+	s.assert.Equal(http.StatusBadRequest, response.Code)
+}
+
+func (s *APIControllerTestSuite) TestBindCustomValidator() {
+	validate := grok.NewValidator()
+	validate.RegisterValidation("grok", func(fl validator.FieldLevel) bool {
+		return fl.Field().String() == "grok"
+	})
+
+	server := grok.New(
+		grok.WithSettings(s.settings),
+		grok.WithValidator(validate),
+		grok.WithContainer(&testContainer{
+			controllers: []grok.APIController{&testCustomController{}},
+		}))
+
+	req := httptest.NewRequest("POST", "/custom", strings.NewReader(`{"name":"other"}`))
+	response := httptest.NewRecorder()
+
+	server.Engine.ServeHTTP(response, req)
+
+	s.assert.Equal(http.StatusBadRequest, response.Code)
+	s.assert.Contains(response.Body.String(), "validation failed for Name")
+}
+
+func (s *APIControllerTestSuite) TestAPIKeyAuth() {
+	server := grok.New(
+		grok.WithSettings(s.settings),
+		grok.WithAPIKeyAuth([]string{"old", "new"}, ""),
+		grok.WithContainer(&testContainer{
+			controllers: []grok.APIController{&testController{}},
+		}))
+
+	for key, status := range map[string]int{
+		"old":   http.StatusCreated,
+		"new":   http.StatusCreated,
+		"wrong": http.StatusUnauthorized,
+		"":      http.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest("POST", "/items", strings.NewReader(`{"name":"grok"}`))
+		req.Header.Set(grok.DefaultAPIKeyHeader, key)
+		response := httptest.NewRecorder()
+
+		server.Engine.ServeHTTP(response, req)
+
+		s.assert.Equal(status, response.Code, key)
+	}
+
+	req := httptest.NewRequest("GET", "/swagger", nil)
+	response := httptest.NewRecorder()
+
+	server.Engine.ServeHTTP(response, req)
+
+	s.assert.Equal(http.StatusOK, response.Code)
+}
+
+func (s *APIControllerTestSuite) TestTenant() {
+	server := grok.New(
+		grok.WithSettings(s.settings),
+		grok.WithBaseHandler(grok.Tenant(
+			grok.AllowTenants(grok.TenantFromHeader("X-Tenant"), "acme"))),
+		grok.WithContainer(&testContainer{
+			controllers: []grok.APIController{&testController{}},
+		}))
+
+	for tenant, status := range map[string]int{
+		"acme":  http.StatusCreated,
+		"other": http.StatusBadRequest,
+		"":      http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest("POST", "/items", strings.NewReader(`{"name":"grok"}`))
+		req.Header.Set("X-Tenant", tenant)
+		response := httptest.NewRecorder()
+
+		server.Engine.ServeHTTP(response, req)
+
+		s.assert.Equal(status, response.Code, tenant)
+	}
+}
+
+func (s *APIControllerTestSuite) TestRoutesController() {
+	server := grok.New(
+		grok.WithSettings(s.settings),
+		grok.WithContainer(&testContainer{
+			controllers: []grok.APIController{grok.Routes(&testRoutesController{})},
+		}))
+
+	for path, status := range map[string]int{
+		"/public": http.StatusNoContent,
+		"/admin":  http.StatusForbidden,
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		response := httptest.NewRecorder()
+
+		server.Engine.ServeHTTP(response, req)
+
+		s.assert.Equal(status, response.Code, path)
+	}
+}
+
+func (s *APIControllerTestSuite) TestBindRequest() {
+	server := grok.New(
+		grok.WithSettings(s.settings),
+		grok.WithContainer(&testContainer{
+			controllers: []grok.APIController{&testRequestController{}},
+		}))
+
+	req := httptest.NewRequest("PUT", "/items/42?verbose=true", strings.NewReader(`{"name":"grok"}`))
+	req.Header.Set("X-Tenant", "acme")
+	response := httptest.NewRecorder()
+
+	server.Engine.ServeHTTP(response, req)
+
+	s.assert.Equal(http.StatusOK, response.Code)
+	s.assert.JSONEq(`{"ID":"42","Tenant":"acme","Verbose":true,"name":"grok"}`, response.Body.String())
+
+	req = httptest.NewRequest("PUT", "/items/42", strings.NewReader(`{"name":"grok"}`))
+	response = httptest.NewRecorder()
+
+	server.Engine.ServeHTTP(response, req)
+
+	s.assert.Equal(http.StatusBadRequest, response.Code)
+}
+
+func (s *APIControllerTestSuite) TestTrustedProxies() {
+	for _, tc := range []struct {
+		proxies []string
+		remote  string
+		ip      string
+	}{
+		{nil, "10.0.0.1:1234", "10.0.0.1"},
+		{[]string{"10.0.0.0/8"}, "10.0.0.1:1234", "203.0.113.7"},
+		{[]string{"10.0.0.0/8"}, "198.51.100.1:1234", "198.51.100.1"},
+	} {
+		server := grok.New(
+			grok.WithSettings(s.settings),
+			grok.WithTrustedProxies(tc.proxies),
+			grok.WithContainer(&testContainer{}))
+
+		server.Engine.GET("/ip", func(c *gin.Context) {
+			c.String(http.StatusOK, c.ClientIP())
+		})
+
+		req := httptest.NewRequest("GET", "/ip", nil)
+		req.RemoteAddr = tc.remote
+		req.Header.Set("X-Forwarded-For", "192.0.2.1, 203.0.113.7, 10.0.0.2")
+		response := httptest.NewRecorder()
+
+		server.Engine.ServeHTTP(response, req)
+
+		s.assert.Equal(tc.ip, response.Body.String(), tc.remote)
+	}
+}
+
+func (s *APIControllerTestSuite) TestRequiredContentType() {
+	server := grok.New(
+		grok.WithSettings(s.settings),
+		grok.WithRequiredContentType("application/json"),
+		grok.WithRouteContentType(http.MethodPut, "/items/:id", "application/merge-patch+json"),
+		grok.WithContainer(&testContainer{
+			controllers: []grok.APIController{&testController{}, &testRequestController{}},
+		}))
+
+	for _, tc := range []struct {
+		method      string
+		path        string
+		contentType string
+		status      int
+	}{
+		{"POST", "/items", "application/json; charset=utf-8", http.StatusCreated},
+		{"POST", "/items", "text/plain", http.StatusUnsupportedMediaType},
+		{"POST", "/items", "", http.StatusUnsupportedMediaType},
+		{"PUT", "/items/42", "application/json", http.StatusUnsupportedMediaType},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(`{"name":"grok"}`))
+		req.Header.Set("Content-Type", tc.contentType)
+		response := httptest.NewRecorder()
+
+		server.Engine.ServeHTTP(response, req)
+
+		s.assert.Equal(tc.status, response.Code, tc.contentType)
+	}
+}
+
+func (s *APIControllerTestSuite) TestCORSConfig() {
+	server := grok.New(
+		grok.WithSettings(s.settings),
+		grok.WithCORSConfig(grok.CORSConfig{
+			AllowOrigins:       []string{"https://*.preview.example.com", "https://example.com"},
+			AllowOriginRegexps: []string{`https://pr-[0-9]+\.example\.dev`},
+			AllowCredentials:   true,
+		}),
+		grok.WithContainer(&testContainer{}))
+
+	for origin, allowed := range map[string]bool{
+		"https://feature.preview.example.com": true,
+		"https://example.com":                 true,
+		"https://pr-42.example.dev":           true,
+		"https://a.b.preview.example.com":     false,
+		"https://preview.example.com.evil.io": false,
+		"http://feature.preview.example.com":  false,
+		"https://pr-x.example.dev":            false,
+	} {
+		req := httptest.NewRequest("OPTIONS", "/items", nil)
+		req.Header.Set("Origin", origin)
+		response := httptest.NewRecorder()
+
+		server.Engine.ServeHTTP(response, req)
+
+		if allowed {
+			s.assert.Equal(http.StatusOK, response.Code, origin)
+			s.assert.Equal(origin, response.Header().Get("Access-Control-Allow-Origin"), origin)
+		} else {
+			s.assert.Equal(http.StatusForbidden, response.Code, origin)
+			s.assert.Empty(response.Header().Get("Access-Control-Allow-Origin"), origin)
+		}
+	}
+}
+
+func (s *APIControllerTestSuite) TestCORSConfigValidate() {
+	s.assert.Error(grok.CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true}.Validate())
+	s.assert.Error(grok.CORSConfig{AllowOrigins: []string{"https://*.com"}}.Validate())
+	s.assert.Error(grok.CORSConfig{AllowOriginRegexps: []string{"("}}.Validate())
+	s.assert.NoError(grok.CORSConfig{AllowOrigins: []string{"*"}}.Validate())
+}
+
+func (s *APIControllerTestSuite) TestRecovery() {
+	for _, debug := range []bool{false, true} {
+		settings := *s.settings
+		api := *settings.API
+		api.Debug = debug
+		settings.API = &api
+
+		server := grok.New(
+			grok.WithSettings(&settings),
+			grok.WithPanicMessage("something went wrong"),
+			grok.WithContainer(&testContainer{}))
+
+		server.Engine.GET("/panic", func(c *gin.Context) {
+			panic("database is gone")
+		})
+
+		response := httptest.NewRecorder()
+		server.Engine.ServeHTTP(response, httptest.NewRequest("GET", "/panic", nil))
+
+		body := new(grok.Error)
+		s.assert.NoError(json.Unmarshal(response.Body.Bytes(), body))
+
+		s.assert.Equal(http.StatusInternalServerError, response.Code)
+		s.assert.Equal(response.Header().Get("Request-Id"), body.RequestID)
+		s.assert.NotEmpty(body.RequestID)
+		s.assert.Equal("something went wrong", body.Messages[0])
+		s.assert.Equal(debug, len(body.Messages) == 2)
+	}
+}
+
+type testListRequest struct {
+	From   time.Time     `form:"from"`
+	Day    time.Time     `form:"day" time_format:"2006-01-02"`
+	Window time.Duration `form:"window"`
+}
+
+func (s *APIControllerTestSuite) TestBindRequestTimeQuery() {
+	s.server.Engine.GET("/events", func(c *gin.Context) {
+		req := new(testListRequest)
+
+		if err := grok.BindRequest(c, req); err != nil {
+			return
+		}
+
+		grok.OK(c, gin.H{"from": req.From.Unix(), "day": req.Day.Format("02/01"), "window": req.Window.Seconds()})
+	})
+
+	for _, tc := range []struct {
+		query  string
+		status int
+		body   string
+	}{
+		{"from=2020-01-02T03:04:05Z&day=2020-03-01&window=1m30s", http.StatusOK, `{"day":"01/03","from":1577934245,"window":90}`},
+		{"from=yesterday", http.StatusBadRequest, `{"code":400,"messages":["invalid time \"yesterday\" for from, expected format 2006-01-02T15:04:05Z07:00"]}`},
+		{"day=01/03", http.StatusBadRequest, `{"code":400,"messages":["invalid time \"01/03\" for day, expected format 2006-01-02"]}`},
+		{"window=90", http.StatusBadRequest, `{"code":400,"messages":["invalid duration \"90\" for window, expected e.g. 1h30m"]}`},
+	} {
+		response := httptest.NewRecorder()
+		s.server.Engine.ServeHTTP(response, httptest.NewRequest("GET", "/events?"+tc.query, nil))
+
+		s.assert.Equal(tc.status, response.Code, tc.query)
+		s.assert.JSONEq(tc.body, response.Body.String(), tc.query)
+	}
+}
+
+func (s *APIControllerTestSuite) TestPaginate() {
+	s.server.Engine.GET("/pages", func(c *gin.Context) {
+		pagination, err := grok.Paginate(c)
+
+		if err != nil {
+			return
+		}
+
+		grok.PaginatedResponse(c, []string{}, 45, pagination)
+	})
+
+	for _, tc := range []struct {
+		query  string
+		status int
+		body   string
+	}{
+		{"", http.StatusOK, `{"items":[],"pagination":{"total":45,"pages":3,"limit":20,"next":"/pages?offset=20"}}`},
+		{"limit=10&offset=20&sort=-name", http.StatusOK, `{"items":[],"pagination":{"total":45,"pages":5,"limit":10,"offset":20,` +
+			`"next":"/pages?limit=10&offset=30&sort=-name","prev":"/pages?limit=10&offset=10&sort=-name"}}`},
+		{"limit=500", http.StatusBadRequest, `{"code":400,"messages":["limit must be between 1 and 100"]}`},
+		{"offset=1&cursor=abc", http.StatusBadRequest, `{"code":400,"messages":["offset and cursor cannot be used together"]}`},
+	} {
+		response := httptest.NewRecorder()
+		s.server.Engine.ServeHTTP(response, httptest.NewRequest("GET", "/pages?"+tc.query, nil))
+
+		s.assert.Equal(tc.status, response.Code, tc.query)
+		s.assert.JSONEq(tc.body, response.Body.String(), tc.query)
+	}
+
+	s.server.Engine.GET("/small-pages", func(c *gin.Context) {
+		pagination, err := grok.Paginate(c, grok.WithDefaultPageLimit(5), grok.WithMaxPageLimit(10))
+
+		if err != nil {
+			return
+		}
+
+		grok.PaginatedResponse(c, []string{}, 45, pagination)
+	})
+
+	for _, tc := range []struct {
+		query  string
+		status int
+		body   string
+	}{
+		{"", http.StatusOK, `{"items":[],"pagination":{"total":45,"pages":9,"limit":5,"next":"/small-pages?offset=5"}}`},
+		{"limit=20", http.StatusBadRequest, `{"code":400,"messages":["limit must be between 1 and 10"]}`},
+	} {
+		response := httptest.NewRecorder()
+		s.server.Engine.ServeHTTP(response, httptest.NewRequest("GET", "/small-pages?"+tc.query, nil))
+
+		s.assert.Equal(tc.status, response.Code, tc.query)
+		s.assert.JSONEq(tc.body, response.Body.String(), tc.query)
+	}
+}
+
+func (s *APIControllerTestSuite) TestHTTPSRedirect() {
+	server := grok.New(
+		grok.WithSettings(s.settings),
+		grok.WithHTTPSRedirect(),
+		grok.WithHSTSMaxAge(time.Hour),
+		grok.WithTrustedProxies([]string{"10.0.0.0/8"}),
+		grok.WithHealthz(func(c *gin.Context) { c.Status(http.StatusOK) }),
+		grok.WithContainer(&testContainer{}))
+
+	server.Engine.Any("/test", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for _, tc := range []struct {
+		method   string
+		path     string
+		remote   string
+		proto    string
+		status   int
+		location string
+		hsts     string
+	}{
+		{"GET", "/test?a=1", "198.51.100.1:1234", "", http.StatusMovedPermanently, "https://example.com/test?a=1", ""},
+		{"POST", "/test", "198.51.100.1:1234", "", http.StatusPermanentRedirect, "https://example.com/test", ""},
+		{"GET", "/test", "198.51.100.1:1234", "https", http.StatusMovedPermanently, "https://example.com/test", ""},
+		{"GET", "/test", "10.0.0.1:1234", "https", http.StatusOK, "", "max-age=3600"},
+		{"GET", "/healthz", "198.51.100.1:1234", "", http.StatusOK, "", ""},
+	} {
+		req := httptest.NewRequest(tc.method, "http://example.com"+tc.path, nil)
+		req.RemoteAddr = tc.remote
+		req.Header.Set("X-Forwarded-Proto", tc.proto)
+		response := httptest.NewRecorder()
+
+		server.Engine.ServeHTTP(response, req)
+
+		s.assert.Equal(tc.status, response.Code, tc.method+tc.path)
+		s.assert.Equal(tc.location, response.Header().Get("Location"), tc.method+tc.path)
+		s.assert.Equal(tc.hsts, response.Header().Get("Strict-Transport-Security"), tc.method+tc.path)
+	}
+}
+
+func (s *APIControllerTestSuite) TestResponseHeaders() {
+	server := grok.New(
+		grok.WithSettings(s.settings),
+		grok.WithSecurityHeaders(grok.SecurityHeadersConfig{FrameOptions: "SAMEORIGIN"}),
+		grok.WithResponseHeaders(map[string]string{"X-Service": "grok"}),
+		grok.WithRouteResponseHeaders(http.MethodGet, "/embed", map[string]string{"X-Frame-Options": ""}),
+		grok.WithContainer(&testContainer{}))
+
+	server.Engine.GET("/embed", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for _, tc := range []struct {
+		path   string
+		status int
+		frame  string
+	}{
+		{"/embed", http.StatusOK, ""},
+		{"/missing", http.StatusNotFound, "SAMEORIGIN"},
+	} {
+		response := httptest.NewRecorder()
+		server.Engine.ServeHTTP(response, httptest.NewRequest("GET", tc.path, nil))
+
+		s.assert.Equal(tc.status, response.Code)
+		s.assert.Equal(tc.frame, response.Header().Get("X-Frame-Options"), tc.path)
+		s.assert.Equal("nosniff", response.Header().Get("X-Content-Type-Options"), tc.path)
+		s.assert.Equal("grok", response.Header().Get("X-Service"), tc.path)
+	}
+}
+
+func (s *APIControllerTestSuite) TestContainers() {
+	server, err := grok.NewAPI(
+		grok.WithSettings(s.settings),
+		grok.WithContainers(
+			&testContainer{controllers: []grok.APIController{&testController{}}},
+			&testContainer{controllers: []grok.APIController{&testRequestController{}}},
+		))
+
+	s.assert.NoError(err)
+
+	routes := []string{}
+
+	for _, route := range server.Engine.Routes() {
+		routes = append(routes, route.Method+" "+route.Path)
+	}
+
+	s.assert.Contains(routes, "POST /items")
+	s.assert.Contains(routes, "PUT /items/:id")
+
+	_, err = grok.NewAPI(
+		grok.WithSettings(s.settings),
+		grok.WithContainers(
+			&testContainer{controllers: []grok.APIController{&testController{}}},
+			&testContainer{controllers: []grok.APIController{&testController{}}},
+		))
+
+	s.assert.EqualError(err, "container 1: route POST /items is already registered by container 0")
+
+	_, err = grok.NewAPI(
+		grok.WithSettings(s.settings),
+		grok.WithContainer(&testContainer{controllers: []grok.APIController{&swaggerController{}}}))
+
+	s.assert.EqualError(err, "container 0: route GET /swagger is already registered by the API")
+
+	server, err = grok.NewAPI(
+		grok.WithSettings(s.settings),
+		grok.WithContainer(&testContainer{controllers: []grok.APIController{&testRequestController{}}}),
+		grok.WithContainer(&testContainer{controllers: []grok.APIController{&testController{}}}),
+	)
+
+	s.assert.NoError(err)
+
+	routes = []string{}
+
+	for _, route := range server.Engine.Routes() {
+		routes = append(routes, route.Method+" "+route.Path)
+	}
+
+	s.assert.Contains(routes, "POST /items")
+	s.assert.NotContains(routes, "PUT /items/:id")
+}
+
+func (s *APIControllerTestSuite) TestRequiredAccept() {
+	server := grok.New(
+		grok.WithSettings(s.settings),
+		grok.WithRequiredAccept("application/json"),
+		grok.WithContainer(&testContainer{
+			controllers: []grok.APIController{&testController{}},
+		}))
+
+	server.Engine.GET("/report", grok.RequireAccept("text/csv", "application/json"), func(c *gin.Context) {
+		c.String(http.StatusOK, grok.Negotiate(c, "text/csv", "application/json"))
+	})
+
+	for _, tc := range []struct {
+		method string
+		path   string
+		accept string
+		status int
+	}{
+		{"POST", "/items", "", http.StatusCreated},
+		{"POST", "/items", "*/*", http.StatusCreated},
+		{"POST", "/items", "application/*", http.StatusCreated},
+		{"POST", "/items", "text/html, application/json;q=0.8", http.StatusCreated},
+		{"POST", "/items", "application/xml", http.StatusNotAcceptable},
+		{"POST", "/items", "application/json;q=0", http.StatusNotAcceptable},
+		{"GET", "/report", "text/csv", http.StatusOK},
+		{"GET", "/report", "application/xml", http.StatusNotAcceptable},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(`{"name":"a"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", tc.accept)
+		response := httptest.NewRecorder()
+
+		server.Engine.ServeHTTP(response, req)
+
+		s.assert.Equal(tc.status, response.Code, tc.accept)
+	}
+
+	response := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/report", nil)
+	req.Header.Set("Accept", "application/json, text/csv;q=0.5")
+	server.Engine.ServeHTTP(response, req)
+
+	s.assert.Equal("application/json", response.Body.String())
+}
+
+func (s *APIControllerTestSuite) TestEffectiveConfig() {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	grok.New(
+		grok.WithSettings(s.settings),
+		grok.WithAPIKeyAuth([]string{"secret-key"}, "X-API-Key"))
+
+	var entry *logrus.Entry
+
+	for _, e := range hook.AllEntries() {
+		if e.Message == "effective config" {
+			entry = e
+		}
+	}
+
+	s.assert.NotNil(entry)
+	s.assert.Equal(grok.DefaultConfigLogLevel, entry.Level)
+	s.assert.Equal(true, entry.Data["api_key_auth"])
+	s.assert.Equal(s.settings.API.Host, entry.Data["host"])
+
+	for _, value := range entry.Data {
+		s.assert.NotContains(fmt.Sprint(value), "secret-key")
+	}
+}
+
+func (s *APIControllerTestSuite) TestConfigLogLevel() {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	grok.New(
+		grok.WithSettings(s.settings),
+		grok.WithConfigLogLevel(logrus.WarnLevel))
+
+	entry := hook.LastEntry()
+
+	s.assert.Equal("effective config", entry.Message)
+	s.assert.Equal(logrus.WarnLevel, entry.Level)
+}
+
+func (s *APIControllerTestSuite) TestPreStopHook() {
+	api := *s.settings.API
+	api.Host = "127.0.0.1:0"
+	settings := *s.settings
+	settings.API = &api
+
+	var phases []string
+
+	server := grok.New(
+		grok.WithSettings(&settings),
+		grok.WithPreStopHook(func(ctx context.Context) error {
+			phases = append(phases, "hook")
+			return errors.New("deregister failed")
+		}),
+		grok.WithPreStopHook(func(ctx context.Context) error {
+			phases = append(phases, "readiness")
+			return nil
+		}),
+		grok.WithPreStopDelay(100*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := grok.NewService(grok.WithServiceAPI(server)).Run(ctx)
+
+	s.assert.NoError(err)
+	s.assert.Equal([]string{"hook", "readiness"}, phases)
+	s.assert.True(time.Since(start) >= 150*time.Millisecond)
+}
+
+func (s *APIControllerTestSuite) TestCacheResponse() {
+	responses := cache.New(time.Minute, time.Minute)
+	calls := 0
+
+	server := grok.New(grok.WithSettings(s.settings))
+
+	server.Engine.GET("/cached", grok.CacheResponse(responses, time.Minute, nil), func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, gin.H{"calls": calls})
+	})
+
+	server.Engine.GET("/cookie", grok.CacheResponse(responses, time.Minute, nil), func(c *gin.Context) {
+		calls++
+		c.SetCookie("session", "1", 60, "/", "", false, true)
+		c.JSON(http.StatusOK, gin.H{"calls": calls})
+	})
+
+	server.Engine.POST("/cached", grok.InvalidateCache(responses, "/cached"), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	get := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+
+		response := httptest.NewRecorder()
+		server.Engine.ServeHTTP(response, req)
+
+		return response
+	}
+
+	s.Run("Miss", func() {
+		response := get("/cached?page=1", nil)
+		s.assert.Equal("MISS", response.Header().Get(grok.CacheStatusHeader))
+		s.assert.JSONEq(`{"calls":1}`, response.Body.String())
+	})
+
+	s.Run("Hit", func() {
+		response := get("/cached?page=1", nil)
+		s.assert.Equal(http.StatusOK, response.Code)
+		s.assert.Equal("HIT", response.Header().Get(grok.CacheStatusHeader))
+		s.assert.Equal("application/json; charset=utf-8", response.Header().Get("Content-Type"))
+		s.assert.JSONEq(`{"calls":1}`, response.Body.String())
+		s.assert.Equal(1, calls)
+	})
+
+	s.Run("Other Query", func() {
+		response := get("/cached?page=2", nil)
+		s.assert.Equal("MISS", response.Header().Get(grok.CacheStatusHeader))
+	})
+
+	s.Run("Bypass", func() {
+		response := get("/cached?page=1", map[string]string{"Cache-Control": "no-cache"})
+		s.assert.Equal("MISS", response.Header().Get(grok.CacheStatusHeader))
+		s.assert.JSONEq(`{"calls":3}`, response.Body.String())
+
+		response = get("/cached?page=1", nil)
+		s.assert.JSONEq(`{"calls":3}`, response.Body.String())
+	})
+
+	s.Run("Set-Cookie", func() {
+		get("/cookie", nil)
+		response := get("/cookie", nil)
+		s.assert.Equal("MISS", response.Header().Get(grok.CacheStatusHeader))
+	})
+
+	s.Run("Invalidate", func() {
+		req := httptest.NewRequest("POST", "/cached", nil)
+		server.Engine.ServeHTTP(httptest.NewRecorder(), req)
+
+		response := get("/cached?page=1", nil)
+		s.assert.Equal("MISS", response.Header().Get(grok.CacheStatusHeader))
+	})
+
+	s.Run("Authorization", func() {
+		before := calls
+
+		get("/cached?page=3", map[string]string{"Authorization": "Bearer a"})
+		response := get("/cached?page=3", map[string]string{"Authorization": "Bearer b"})
+
+		s.assert.Empty(response.Header().Get(grok.CacheStatusHeader))
+		s.assert.Equal(before+2, calls)
+	})
+}
+
+func (s *APIControllerTestSuite) TestCacheResponseKeys() {
+	responses := cache.New(time.Minute, time.Minute)
+
+	server := grok.New(grok.WithSettings(s.settings))
+
+	server.Engine.GET("/tenants",
+		func(c *gin.Context) {
+			c.Next()
+			c.Writer.Header()["X-Tenant"][0] = "mutated"
+		},
+		grok.Tenant(grok.TenantFromHeader("X-Tenant")),
+		grok.CacheResponse(responses, time.Minute, nil),
+		func(c *gin.Context) {
+			c.Header("X-Tenant", c.GetHeader("X-Tenant"))
+			c.String(http.StatusOK, c.GetHeader("X-Tenant"))
+		})
+
+	get := func(tenant string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/tenants", nil)
+		req.Header.Set("X-Tenant", tenant)
+
+		response := httptest.NewRecorder()
+		server.Engine.ServeHTTP(response, req)
+
+		return response
+	}
+
+	get("a")
+	get("b")
+
+	response := get("a")
+	s.assert.Equal("HIT", response.Header().Get(grok.CacheStatusHeader))
+	s.assert.Equal("a", response.Body.String())
+
+	response = get("b")
+	s.assert.Equal("HIT", response.Header().Get(grok.CacheStatusHeader))
+	s.assert.Equal("b", response.Body.String())
+
+	response = get("b")
+	s.assert.Equal("b", response.Result().Header.Get("X-Tenant"))
+}
+
+func (s *APIControllerTestSuite) TestReadinessGate() {
+	ready := int32(0)
+	checker := grok.NewHealthChecker(time.Second, 0)
+	checker.Register("db", func(ctx context.Context) error {
+		if atomic.LoadInt32(&ready) == 0 {
+			return errors.New("connecting")
+		}
+
+		return nil
+	})
+
+	_, err := grok.NewAPI(
+		grok.WithSettings(s.settings),
+		grok.WithReadinessGate(3*time.Second))
+
+	s.assert.Equal(grok.ErrReadinessGateWithoutHealthChecks, err)
+
+	server := grok.New(
+		grok.WithSettings(s.settings),
+		grok.WithHealthChecks(checker),
+		grok.WithReadinessGate(3*time.Second),
+		grok.WithContainer(&testContainer{
+			controllers: []grok.APIController{&testController{}},
+		}))
+
+	request := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"name":"a"}`))
+		req.Header.Set("Content-Type", "application/json")
+		response := httptest.NewRecorder()
+		server.Engine.ServeHTTP(response, req)
+		return response
+	}
+
+	response := request("POST", "/items")
+	s.assert.Equal(http.StatusServiceUnavailable, response.Code)
+	s.assert.Equal("3", response.Header().Get("Retry-After"))
+
+	s.assert.Equal(http.StatusServiceUnavailable, request("GET", "/health").Code)
+	s.assert.Empty(request("GET", "/health").Header().Get("Retry-After"))
+
+	atomic.StoreInt32(&ready, 1)
+
+	s.assert.Eventually(func() bool {
+		return request("POST", "/items").Code == http.StatusCreated
+	}, 3*time.Second, 50*time.Millisecond)
+	s.assert.Equal(http.StatusOK, request("GET", "/health").Code)
+}
+
+func (s *APIControllerTestSuite) TestErrorReporter() {
+	reporter := &recordingReporter{}
+
+	server := grok.New(
+		grok.WithSettings(s.settings),
+		grok.WithErrorReporter(reporter),
+		grok.WithContainer(&testContainer{}))
+
+	server.Engine.GET("/panic", func(c *gin.Context) {
+		panic("database is gone")
+	})
+
+	response := httptest.NewRecorder()
+	server.Engine.ServeHTTP(response, httptest.NewRequest("GET", "/panic", nil))
+
+	s.assert.Equal(http.StatusInternalServerError, response.Code)
+	s.assert.Len(reporter.errs, 1)
+	s.assert.EqualError(reporter.errs[0], "panic: database is gone")
+	s.assert.Equal(response.Header().Get("Request-Id"), reporter.fields[0]["request_id"])
+	s.assert.Equal("/panic", reporter.fields[0]["path"])
+}
+
+func (s *APIControllerTestSuite) TestMissingAPISettings() {
+	_, err := grok.NewAPI(grok.WithSettings(&grok.Settings{}))
+	s.assert.EqualError(err, "missing required settings: api")
+
+	_, err = grok.NewAPI()
+	s.assert.EqualError(err, "missing required settings: api")
+}
+
+func (s *APIControllerTestSuite) TestRequireControllers() {
+	_, err := grok.NewAPI(
+		grok.WithSettings(s.settings),
+		grok.WithRequireControllers(),
+		grok.WithContainer(&testContainer{}))
+
+	s.assert.Equal(grok.ErrNoControllers, err)
+
+	server, err := grok.NewAPI(
+		grok.WithSettings(s.settings),
+		grok.WithRequireControllers(),
+		grok.WithContainer(&testContainer{
+			controllers: []grok.APIController{&testController{}},
+		}))
+
+	s.assert.NoError(err)
+	s.assert.NotNil(server)
+
+	_, err = grok.NewAPI(grok.WithSettings(s.settings), grok.WithContainer(&testContainer{}))
+	s.assert.NoError(err)
+}
+
+func (s *APIControllerTestSuite) TestPushAuth() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	s.assert.NoError(err)
+
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "push", Algorithm: "RS256", Use: "sig"},
+		}})
+	}))
+	defer jwks.Close()
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "push"))
+	s.assert.NoError(err)
+
+	token := func(audience, email string) string {
+		raw, err := jwt.Signed(signer).
+			Claims(jwt.Claims{
+				Issuer:   grok.GoogleIssuer,
+				Audience: jwt.Audience{audience},
+				Expiry:   jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			}).
+			Claims(map[string]interface{}{"email": email, "email_verified": true}).
+			CompactSerialize()
+		s.assert.NoError(err)
+		return raw
+	}
+
+	handled := 0
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(grok.FakePubSubClient(s.settings.GCP.PubSub.Endpoint)),
+		grok.WithPubSubSubscriberID("subs-push"),
+		grok.WithTopicID("topic-push"),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			handled++
+			return nil
+		}),
+	)
+
+	server := grok.New(grok.WithSettings(s.settings))
+	server.Engine.POST("/push",
+		grok.PushAuth(
+			grok.WithPushJWKS(jwks.URL),
+			grok.WithPushAudience("https://orders.run.app/push"),
+			grok.WithPushServiceAccount("push@project.iam.gserviceaccount.com")),
+		grok.PushHandler(subscriber))
+
+	body := `{"message":{"messageId":"1","data":"e30=","attributes":{}},"subscription":"projects/p/subscriptions/subs-push"}`
+
+	for _, tc := range []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"Missing", "", http.StatusUnauthorized},
+		{"Valid", "Bearer " + token("https://orders.run.app/push", "push@project.iam.gserviceaccount.com"), http.StatusNoContent},
+		{"Audience", "Bearer " + token("https://other.run.app/push", "push@project.iam.gserviceaccount.com"), http.StatusUnauthorized},
+		{"Service Account", "Bearer " + token("https://orders.run.app/push", "other@project.iam.gserviceaccount.com"), http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("POST", "/push", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", tc.authorization)
+		response := httptest.NewRecorder()
+
+		server.Engine.ServeHTTP(response, req)
+
+		s.assert.Equal(tc.status, response.Code, tc.name)
+	}
+
+	s.assert.Equal(1, handled)
+
+	s.assert.Panics(func() { grok.PushAuth(grok.WithPushJWKS(jwks.URL)) })
+	s.assert.Panics(func() { grok.PushAuth(grok.WithPushAudience("https://orders.run.app/push")) })
+	s.assert.Panics(func() { grok.PushHandler(grok.NewPubSubSubscriber(grok.WithPubSubSubscriberID("subs-push"))) })
+}
+
+func (s *APIControllerTestSuite) TestBindErrorHandler() {
+	server := grok.New(
+		grok.WithSettings(s.settings),
+		grok.WithBindErrorHandler(grok.SafeBindErrorHandler),
+		grok.WithContainer(&testContainer{
+			controllers: []grok.APIController{&testController{}},
+		}))
+
+	for _, tc := range []struct {
+		name    string
+		body    string
+		status  int
+		message string
+	}{
+		{"Malformed", `{"name": "a",}`, http.StatusBadRequest, "malformed JSON body"},
+		{"Truncated", `{"name": `, http.StatusBadRequest, "malformed JSON body"},
+		{"Type", `{"name": 1}`, http.StatusBadRequest, "invalid value for name"},
+		{"Validation", `{"name": ""}`, http.StatusUnprocessableEntity, "validation failed for Name"},
+	} {
+		req := httptest.NewRequest("POST", "/items", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		response := httptest.NewRecorder()
+
+		server.Engine.ServeHTTP(response, req)
+
+		body := new(grok.Error)
+		s.assert.NoError(json.Unmarshal(response.Body.Bytes(), body), tc.name)
+		s.assert.Equal(tc.status, response.Code, tc.name)
+		s.assert.Equal([]string{tc.message}, body.Messages, tc.name)
+		s.assert.NotContains(response.Body.String(), "offset", tc.name)
+	}
+}
+
+type swaggerController struct{}
+
+func (swaggerController) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("/swagger", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+}
+
+type whoamiController struct{}
+
+func (whoamiController) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("/whoami", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("sub"))
+	})
+}
+
+func (s *APIControllerTestSuite) TestClientCertAuth() {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "grok-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	s.Require().NoError(err)
+	ca, _ = x509.ParseCertificate(caDER)
+
+	issue := func(template *x509.Certificate) tls.Certificate {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template.NotBefore = time.Now().Add(-time.Hour)
+		template.NotAfter = time.Now().Add(time.Hour)
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		s.Require().NoError(err)
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+
+	serverCert := issue(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	clientCert := issue(&x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "billing", OrganizationalUnit: []string{"orders:read"}},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	dir, err := ioutil.TempDir("", "grok-tls")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	keyDER, _ := x509.MarshalECPrivateKey(serverCert.PrivateKey.(*ecdsa.PrivateKey))
+	s.Require().NoError(ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverCert.Certificate[0]}), 0600))
+	s.Require().NoError(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	_, err = grok.NewAPI(grok.WithSettings(s.settings), grok.WithClientCertAuth(pool, nil))
+	s.assert.Equal(grok.ErrClientCertWithoutTLS, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().NoError(err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	api := *s.settings.API
+	api.Host = addr
+	settings := *s.settings
+	settings.API = &api
+
+	server, err := grok.NewAPI(
+		grok.WithSettings(&settings),
+		grok.WithTLS(certFile, keyFile),
+		grok.WithClientCertAuth(pool, nil),
+		grok.WithContainer(&testContainer{controllers: []grok.APIController{whoamiController{}}}))
+	s.Require().NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- grok.NewService(grok.WithServiceAPI(server)).Run(ctx) }()
+	defer func() { cancel(); <-done }()
+
+	get := func(certs ...tls.Certificate) (int, string, error) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certs},
+		}}
+
+		response, err := client.Get("https://" + addr + "/whoami")
+
+		if err != nil {
+			return 0, "", err
+		}
+
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(response.Body)
+
+		return response.StatusCode, string(body), nil
+	}
+
+	var code int
+	var body string
+
+	for i := 0; i < 50; i++ {
+		if code, body, err = get(clientCert); err == nil {
+			break
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	s.Require().NoError(err)
+	s.assert.Equal(http.StatusOK, code)
+	s.assert.Equal("billing", body)
+
+	code, _, err = get()
+	s.assert.NoError(err)
+	s.assert.Equal(http.StatusUnauthorized, code)
+}
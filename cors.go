@@ -1,25 +1,186 @@
-package grok
-
-import (
-	"net/http"
-
-	"github.com/gin-gonic/gin"
-)
-
-// CORS ...
-func CORS() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		origin := c.GetHeader("Origin")
-		c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Accept, *")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusOK)
-			return
-		}
-
-		c.Next()
-	}
-}
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSConfig configures CORSWithConfig.
+type CORSConfig struct {
+	// AllowOrigins are exact origins, "*" or wildcard subdomains such as
+	// "https://*.preview.example.com". Without a scheme any scheme is allowed.
+	AllowOrigins []string
+	// AllowOriginRegexps are matched against the whole origin.
+	AllowOriginRegexps []string
+	// AllowMethods - default "*"
+	AllowMethods []string
+	// AllowHeaders - default "Authorization, Content-Type, Accept, *"
+	AllowHeaders     []string
+	AllowCredentials bool
+}
+
+// CORS ...
+func CORS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "*")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Accept, *")
+		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(http.StatusOK)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// WithCORSConfig enables CORS restricted to the configured origins.
+// New panics when the config is invalid, see CORSConfig.Validate.
+func WithCORSConfig(config CORSConfig) APIOption {
+	return func(server *API) {
+		server.cors = true
+		server.corsConfig = &config
+	}
+}
+
+// Validate rejects malformed patterns and unsafe configurations, such as any
+// origin with credentials or wildcards over a top level domain.
+func (config CORSConfig) Validate() error {
+	_, err := config.matchers()
+	return err
+}
+
+// CORSWithConfig echoes back the request origin when it matches the config.
+// It panics when the config is invalid.
+func CORSWithConfig(config CORSConfig) gin.HandlerFunc {
+	matchers, err := config.matchers()
+
+	if err != nil {
+		panic(err)
+	}
+
+	methods := "*"
+	headers := "Authorization, Content-Type, Accept, *"
+
+	if len(config.AllowMethods) > 0 {
+		methods = strings.Join(config.AllowMethods, ", ")
+	}
+
+	if len(config.AllowHeaders) > 0 {
+		headers = strings.Join(config.AllowHeaders, ", ")
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Origin")
+
+		if !matchOrigin(matchers, origin) {
+			if c.Request.Method == "OPTIONS" {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+		c.Writer.Header().Set("Access-Control-Allow-Methods", methods)
+		c.Writer.Header().Set("Access-Control-Allow-Headers", headers)
+
+		if config.AllowCredentials {
+			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(http.StatusOK)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func matchOrigin(matchers []*regexp.Regexp, origin string) bool {
+	for _, m := range matchers {
+		if m.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (config CORSConfig) matchers() ([]*regexp.Regexp, error) {
+	matchers := []*regexp.Regexp{}
+
+	for _, origin := range config.AllowOrigins {
+		if origin == "*" {
+			if config.AllowCredentials {
+				return nil, errors.New("cors: any origin cannot be allowed with credentials")
+			}
+
+			matchers = append(matchers, regexp.MustCompile(`.*`))
+			continue
+		}
+
+		m, err := wildcardOrigin(origin)
+
+		if err != nil {
+			return nil, err
+		}
+
+		matchers = append(matchers, m)
+	}
+
+	for _, expr := range config.AllowOriginRegexps {
+		m, err := regexp.Compile("^(?:" + expr + ")$")
+
+		if err != nil {
+			return nil, fmt.Errorf("cors: invalid origin regexp %q: %v", expr, err)
+		}
+
+		matchers = append(matchers, m)
+	}
+
+	return matchers, nil
+}
+
+// wildcardOrigin compiles an origin whose first label may be "*", matching one label.
+func wildcardOrigin(origin string) (*regexp.Regexp, error) {
+	scheme := `[a-z][a-z0-9+.-]*://`
+	host := origin
+
+	if i := strings.Index(origin, "://"); i >= 0 {
+		scheme = regexp.QuoteMeta(origin[:i+3])
+		host = origin[i+3:]
+	}
+
+	expr := regexp.QuoteMeta(host)
+
+	if strings.Contains(host, "*") {
+		labels := strings.Split(host, ".")
+
+		if labels[0] != "*" || strings.Count(host, "*") > 1 || len(labels) < 3 {
+			return nil, fmt.Errorf("cors: unsafe origin pattern %q", origin)
+		}
+
+		expr = `[a-zA-Z0-9-]+` + regexp.QuoteMeta(host[1:])
+	}
+
+	return regexp.Compile("^" + scheme + expr + "$")
+}
@@ -0,0 +1,113 @@
+package grok
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/storage"
+)
+
+// DeadLetterSink persists dead letters for analysis, e.g. in GCS or BigQuery.
+type DeadLetterSink interface {
+	Store(ctx context.Context, message DeadLetterMessage) error
+}
+
+// WithDeadLetterSink stores dead letters in sink besides publishing them to the dlq topic.
+// Failing to store is retried like failing to publish, see WithDLQPublishRetries.
+func WithDeadLetterSink(sink DeadLetterSink) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.deadLetterSink = sink
+	}
+}
+
+// WithoutDLQTopic stores dead letters only in the WithDeadLetterSink sink.
+func WithoutDLQTopic() PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.noDLQTopic = true
+	}
+}
+
+// WithFallbackSink sets the last resort for messages that could neither be retried nor
+// sent to the dlq, e.g. writing them to local disk or stderr for manual recovery.
+// Messages stored by it are acked; when it fails too they are nacked. With it set, a
+// message whose retry publish fails is sent to the dlq, and then to the fallback,
+// instead of being nacked.
+func WithFallbackSink(fallback func(DeadLetterMessage) error) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.fallbackSink = fallback
+	}
+}
+
+func (s *PubSubSubscriber) storeDeadLetter(message *pubsub.Message, data []byte, attributes map[string]string, e error) error {
+	return s.deadLetterSink.Store(context.Background(), s.deadLetterMessage(message, data, attributes, e))
+}
+
+// fallback hands message to the fallback sink after the dlq failed with err.
+func (s *PubSubSubscriber) fallback(message *pubsub.Message, e, err error) Disposition {
+	data, attributes := s.deadLetterData(message, e)
+
+	if fallbackErr := s.fallbackSink(s.deadLetterMessage(message, data, attributes, e)); fallbackErr != nil {
+		s.log.WithError(fallbackErr).WithField("dlq_error", err.Error()).
+			Errorf("FALLBACK FAILED for message %s after dlq failure - nacking it", message.ID)
+		return DispositionNack
+	}
+
+	s.log.WithError(err).WithField("content", string(data)).
+		Errorf("FALLBACK USED for message %s - dlq failed, message must be recovered manually", message.ID)
+
+	return DispositionDrop
+}
+
+func (s *PubSubSubscriber) deadLetterMessage(message *pubsub.Message, data []byte, attributes map[string]string, e error) DeadLetterMessage {
+	merged := make(map[string]string, len(message.Attributes)+len(attributes))
+
+	for k, v := range message.Attributes {
+		merged[k] = v
+	}
+
+	for k, v := range attributes {
+		merged[k] = v
+	}
+
+	return DeadLetterMessage{
+		ID:           message.ID,
+		Subscription: s.subscriberID,
+		Topic:        s.topicID,
+		Data:         data,
+		Attributes:   merged,
+		Error:        e.Error(),
+		FailedAt:     time.Now().UTC(),
+	}
+}
+
+// GCSDeadLetterSink stores dead letters as JSON objects named
+// <prefix>/<topic>/<yyyy>/<mm>/<dd>/<message id>.json, so they can be listed by day
+// or loaded into BigQuery. Data is base64 encoded.
+type GCSDeadLetterSink struct {
+	bucket *storage.BucketHandle
+	prefix string
+}
+
+// NewGCSDeadLetterSink ...
+func NewGCSDeadLetterSink(client *storage.Client, bucket, prefix string) *GCSDeadLetterSink {
+	return &GCSDeadLetterSink{bucket: client.Bucket(bucket), prefix: prefix}
+}
+
+// Store writes the message object.
+func (g *GCSDeadLetterSink) Store(ctx context.Context, message DeadLetterMessage) error {
+	name := path.Join(g.prefix, message.Topic, message.FailedAt.Format("2006/01/02"), message.ID+".json")
+
+	w := g.bucket.Object(name).NewWriter(ctx)
+	w.ContentType = "application/json"
+
+	if err := json.NewEncoder(w).Encode(message); err != nil {
+		w.Close()
+		return fmt.Errorf("writing dead letter %s: %w", name, err)
+	}
+
+	return w.Close()
+}
@@ -0,0 +1,45 @@
+package grok
+
+import (
+	"reflect"
+	"sync"
+)
+
+// WithDecodePool reuses the bodies messages are decoded into, reducing allocations at
+// high throughput. Bodies are reset to the zero value before reuse, so handlers must
+// not retain references to Delivery.Body, nor to its fields, after returning.
+// It does not apply to CloudEvents, batched records nor codecs, and is disabled by
+// WithHandlerTimeout, since a timed out handler may still be using its body.
+func WithDecodePool() PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.decodePool = new(sync.Pool)
+	}
+}
+
+// newBody returns a pointer to a zero handle type value.
+func (s *PubSubSubscriber) newBody() interface{} {
+	if s.decodePool != nil {
+		if body := s.decodePool.Get(); body != nil {
+			return body
+		}
+	}
+
+	return reflect.New(s.handleType).Interface()
+}
+
+// pooled reports whether decoded bodies are returned to the pool after processing.
+func (s *PubSubSubscriber) pooled() bool {
+	return s.decodePool != nil && s.handlerTimeout <= 0 && !s.cloudEvents && !s.recordBatching && s.codec == nil
+}
+
+// releaseBody resets body and returns it to the pool.
+func (s *PubSubSubscriber) releaseBody(body interface{}) {
+	value := reflect.ValueOf(body)
+
+	if s.decodePool == nil || value.Kind() != reflect.Ptr || value.Type().Elem() != s.handleType {
+		return
+	}
+
+	value.Elem().Set(reflect.Zero(s.handleType))
+	s.decodePool.Put(body)
+}
@@ -0,0 +1,94 @@
+package grok
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+)
+
+type benchmarkOrder struct {
+	ID       string   `json:"id"`
+	Customer string   `json:"customer"`
+	Items    []string `json:"items"`
+	Total    float64  `json:"total"`
+}
+
+var benchmarkMessage = &pubsub.Message{
+	ID:   "1",
+	Data: []byte(`{"id":"o-1","customer":"c-1","items":["a","b"],"total":10.5}`),
+}
+
+func TestDecodePoolResetsBody(t *testing.T) {
+	subscriber := NewPubSubSubscriber(WithType(reflect.TypeOf(benchmarkOrder{})), WithDecodePool())
+
+	body, _, _ := subscriber.decode(context.Background(), benchmarkMessage)
+	subscriber.releaseBody(body)
+
+	body, _, _ = subscriber.decode(context.Background(), &pubsub.Message{ID: "2", Data: []byte(`{"id":"o-2"}`)})
+
+	if order := body.(*benchmarkOrder); order.Customer != "" || order.Items != nil {
+		t.Errorf("pooled body not reset: %+v", order)
+	}
+}
+
+type discardPublisher struct{}
+
+func (discardPublisher) PublishWihAttribrutes(topicID string, data interface{}, attributes map[string]string) error {
+	return nil
+}
+
+func (discardPublisher) PublishRaw(topicID string, data []byte, attributes map[string]string) error {
+	return nil
+}
+
+func TestDecodePoolWithHandlerTimeout(t *testing.T) {
+	customer := make(chan string, 1)
+
+	subscriber := NewPubSubSubscriber(
+		WithType(reflect.TypeOf(benchmarkOrder{})),
+		WithDecodePool(),
+		WithHandlerTimeout(10*time.Millisecond),
+		WithPublisher(discardPublisher{}),
+		WithMessageHandler(func(ctx context.Context, delivery *Delivery) error {
+			<-ctx.Done()
+			time.Sleep(20 * time.Millisecond)
+			customer <- delivery.Body.(*benchmarkOrder).Customer
+			return ctx.Err()
+		}),
+	)
+
+	if disposition := subscriber.ProcessMessage(context.Background(), benchmarkMessage); disposition != DispositionRetry {
+		t.Errorf("expected retry, got %s", disposition)
+	}
+
+	if c := <-customer; c != "c-1" {
+		t.Errorf("body of a timed out handler was reset: %q", c)
+	}
+}
+
+func benchmarkDecode(b *testing.B, opts ...PubSubSubscriberOption) {
+	subscriber := NewPubSubSubscriber(append(opts, WithType(reflect.TypeOf(benchmarkOrder{})))...)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		body, _, err := subscriber.decode(context.Background(), benchmarkMessage)
+
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		subscriber.releaseBody(body)
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	benchmarkDecode(b)
+}
+
+func BenchmarkDecodePool(b *testing.B) {
+	benchmarkDecode(b, WithDecodePool())
+}
@@ -0,0 +1,46 @@
+package grok
+
+import (
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/patrickmn/go-cache"
+)
+
+// WithDedup acks without handling messages whose keyAttr attribute was handled
+// successfully within ttl, as recorded in c. It is best effort: duplicates handled
+// concurrently, by other instances or after a restart with a new cache are not detected,
+// so it does not replace idempotent handlers. Messages without the attribute are always handled.
+func WithDedup(keyAttr string, c *cache.Cache, ttl time.Duration) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.dedupAttribute = keyAttr
+		s.dedupCache = c
+		s.dedupTTL = ttl
+	}
+}
+
+func (s *PubSubSubscriber) dedupKey(message *pubsub.Message) string {
+	if s.dedupCache == nil {
+		return ""
+	}
+
+	return message.Attributes[s.dedupAttribute]
+}
+
+func (s *PubSubSubscriber) duplicate(message *pubsub.Message) bool {
+	key := s.dedupKey(message)
+
+	if key == "" {
+		return false
+	}
+
+	_, found := s.dedupCache.Get(key)
+
+	return found
+}
+
+func (s *PubSubSubscriber) markHandled(message *pubsub.Message) {
+	if key := s.dedupKey(message); key != "" {
+		s.dedupCache.Set(key, true, s.dedupTTL)
+	}
+}
@@ -0,0 +1,386 @@
+package grok
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/sirupsen/logrus"
+)
+
+// maxAttributeSize is the pubsub limit for attribute values.
+const maxAttributeSize = 1024
+
+type errorDetail struct {
+	Message string          `json:"message"`
+	Type    string          `json:"type"`
+	Fields  json.RawMessage `json:"fields,omitempty"`
+}
+
+// DeadLetterMessage is a message in a dlq topic or stored in a DeadLetterSink.
+type DeadLetterMessage struct {
+	ID           string            `json:"id"`
+	Subscription string            `json:"subscription,omitempty"`
+	Topic        string            `json:"topic"`
+	Data         []byte            `json:"data"`
+	Error        string            `json:"error"`
+	Attributes   map[string]string `json:"attributes"`
+	PublishTime  time.Time         `json:"publish_time"`
+	FailedAt     time.Time         `json:"failed_at"`
+}
+
+// DLQMonitor calls alert for messages landing in a dlq topic.
+// It uses its own subscription, so it is run alongside the main subscriber:
+//
+//	go grok.NewDLQMonitor(client, "orders_dlq", alert, time.Minute).Run(ctx)
+type DLQMonitor struct {
+	alert      func(DeadLetterMessage)
+	topicID    string
+	interval   time.Duration
+	subscriber *PubSubSubscriber
+
+	mu         sync.Mutex
+	last       time.Time
+	suppressed int
+}
+
+// NewDLQMonitor creates a monitor calling alert at most once per interval. Dead letters
+// are acked even when alert panics, they are never sent to a dlq of the monitor.
+func NewDLQMonitor(client *pubsub.Client, dlqTopicID string, alert func(DeadLetterMessage), interval time.Duration) *DLQMonitor {
+	m := &DLQMonitor{
+		alert:    alert,
+		topicID:  dlqTopicID,
+		interval: interval,
+	}
+
+	m.subscriber = NewPubSubSubscriber(
+		WithClient(client),
+		WithTopicID(dlqTopicID),
+		WithPubSubSubscriberID(fmt.Sprintf("%s_monitor", dlqTopicID)),
+		WithMessageHandler(m.handle),
+		WithoutDLQ(),
+	)
+
+	return m
+}
+
+// Run ...
+func (m *DLQMonitor) Run(ctx context.Context) error {
+	return m.subscriber.Run(ctx)
+}
+
+func (m *DLQMonitor) handle(ctx context.Context, delivery *Delivery) error {
+	if !m.allow() {
+		return nil
+	}
+
+	m.alert(DeadLetterMessage{
+		ID:          delivery.Message.ID,
+		Topic:       m.topicID,
+		Data:        deadLetterPayload(delivery.Message),
+		Error:       delivery.Message.Attributes["error"],
+		Attributes:  delivery.Message.Attributes,
+		PublishTime: delivery.Message.PublishTime,
+	})
+
+	return nil
+}
+
+func (m *DLQMonitor) allow() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if time.Since(m.last) < m.interval {
+		m.suppressed++
+		return false
+	}
+
+	if m.suppressed > 0 {
+		logrus.Warnf("%d alerts suppressed for %s", m.suppressed, m.topicID)
+	}
+
+	m.last = time.Now()
+	m.suppressed = 0
+
+	return true
+}
+
+// marshalErrorChain serializes the errors.Unwrap chain of e, including the
+// JSON of errors implementing json.Marshaler. The chain is cut to fit an attribute.
+func marshalErrorChain(e error) string {
+	chain := []errorDetail{}
+
+	for err := e; err != nil; err = errors.Unwrap(err) {
+		detail := errorDetail{Message: err.Error(), Type: fmt.Sprintf("%T", err)}
+
+		if m, ok := err.(json.Marshaler); ok {
+			if fields, err := m.MarshalJSON(); err == nil && json.Valid(fields) {
+				detail.Fields = fields
+			}
+		}
+
+		chain = append(chain, detail)
+	}
+
+	for len(chain) > 0 {
+		data, err := json.Marshal(chain)
+
+		if err == nil && len(data) <= maxAttributeSize {
+			return string(data)
+		}
+
+		chain = chain[:len(chain)-1]
+	}
+
+	return ""
+}
+
+var (
+	// ErrMessageNotFound ...
+	ErrMessageNotFound = errors.New("message not found")
+)
+
+// DefaultReplayTimeout bounds ReplayMessage when its context has no deadline.
+const DefaultReplayTimeout = 30 * time.Second
+
+// DefaultReplayIdle ends ReplayDLQ when no new message is received for it.
+const DefaultReplayIdle = 10 * time.Second
+
+// SchemaVersionAttribute carries the payload schema version of dlq messages, see WithSchemaVersion.
+const SchemaVersionAttribute = "schema_version"
+
+// dlqAttributes are set by the subscriber when sending to the dlq and dropped on replay.
+var dlqAttributes = []string{"error", "error_json", "retries", SchemaVersionAttribute}
+
+// Migration upgrades the data of a dlq message stamped with version to the current schema.
+type Migration func(version string, data []byte) ([]byte, error)
+
+// ReplayReport ...
+type ReplayReport struct {
+	Replayed int
+	Skipped  []SkippedMessage
+}
+
+// SkippedMessage is a dlq message left in the dlq by ReplayDLQ.
+type SkippedMessage struct {
+	ID      string
+	Version string
+	Error   string
+}
+
+// ReplayMessage republishes the dlq message with messageID to targetTopic with its
+// retries reset, and acks it from the dlq. It pulls from the subscription named after
+// the dlq topic, which subscribers create along with the topic to retain dead letters,
+// returning ErrMessageNotFound when the message is not received before the context
+// deadline. Other messages are held while searching and nacked once it ends.
+func (p *PubSubProducer) ReplayMessage(ctx context.Context, dlqTopic, messageID, targetTopic string) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultReplayTimeout)
+		defer cancel()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	held := holdUntilDone(ctx)
+	subscription := replaySubscription(p.client, dlqTopic)
+
+	var (
+		mu        sync.Mutex
+		found     bool
+		replayErr error
+	)
+
+	err := subscription.Receive(ctx, func(c context.Context, message *pubsub.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if message.ID != messageID || found {
+			held.hold(message)
+			return
+		}
+
+		if replayErr = p.replay(c, message, targetTopic, nil); replayErr != nil {
+			message.Nack()
+		} else {
+			message.Ack()
+		}
+
+		found = true
+		cancel()
+	})
+
+	switch {
+	case replayErr != nil:
+		return replayErr
+	case found:
+		return nil
+	case err != nil:
+		return err
+	default:
+		return fmt.Errorf("%w: %s in %s", ErrMessageNotFound, messageID, dlqTopic)
+	}
+}
+
+// ReplayDLQ republishes every message of the dlq to targetTopic, upgrading their data
+// with migrate when it is set. Messages failing to migrate or publish are held until the
+// replay ends, then left in the dlq and reported. It stops when ctx is done or no message
+// arrives for DefaultReplayIdle.
+func (p *PubSubProducer) ReplayDLQ(ctx context.Context, dlqTopic, targetTopic string, migrate Migration) (*ReplayReport, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	idle := time.AfterFunc(DefaultReplayIdle, cancel)
+	defer idle.Stop()
+
+	held := holdUntilDone(ctx)
+	subscription := replaySubscription(p.client, dlqTopic)
+
+	var mu sync.Mutex
+
+	report := &ReplayReport{}
+
+	err := subscription.Receive(ctx, func(c context.Context, message *pubsub.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		idle.Reset(DefaultReplayIdle)
+
+		if err := p.replay(c, message, targetTopic, migrate); err != nil {
+			logrus.WithError(err).Warnf("skipping dlq message %s", message.ID)
+
+			report.Skipped = append(report.Skipped, SkippedMessage{
+				ID:      message.ID,
+				Version: message.Attributes[SchemaVersionAttribute],
+				Error:   err.Error(),
+			})
+
+			held.hold(message)
+			return
+		}
+
+		report.Replayed++
+		message.Ack()
+	})
+
+	return report, err
+}
+
+// createDLQTopic creates the dlq topic and the subscription named after it, retaining
+// the dead letters for ReplayMessage, ReplayDLQ and DLQDepth.
+func createDLQTopic(ctx context.Context, client *pubsub.Client, id string) error {
+	topic, err := createTopicIfNotExists(ctx, client, id)
+
+	if err != nil {
+		return err
+	}
+
+	return createTopicSubscription(ctx, client, topic)
+}
+
+func replaySubscription(client *pubsub.Client, dlqTopic string) *pubsub.Subscription {
+	subscription := client.Subscription(dlqTopic)
+	subscription.ReceiveSettings.NumGoroutines = 1
+	subscription.ReceiveSettings.MaxOutstandingMessages = -1
+
+	return subscription
+}
+
+// heldMessages keeps messages leased, so they are not redelivered to the same
+// replay, and nacks them when it ends.
+type heldMessages struct {
+	mu       sync.Mutex
+	messages []*pubsub.Message
+	released bool
+}
+
+func holdUntilDone(ctx context.Context) *heldMessages {
+	held := &heldMessages{}
+
+	go func() {
+		<-ctx.Done()
+		held.release()
+	}()
+
+	return held
+}
+
+func (h *heldMessages) hold(message *pubsub.Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.released {
+		message.Nack()
+		return
+	}
+
+	h.messages = append(h.messages, message)
+}
+
+func (h *heldMessages) release() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, message := range h.messages {
+		message.Nack()
+	}
+
+	h.messages = nil
+	h.released = true
+}
+
+// deadLetterPayload returns the data of a dlq message, which the dlq stores marshaled
+// as a JSON string.
+func deadLetterPayload(message *pubsub.Message) []byte {
+	var data []byte
+
+	if err := json.Unmarshal(message.Data, &data); err != nil {
+		return message.Data
+	}
+
+	return data
+}
+
+func (p *PubSubProducer) replay(ctx context.Context, message *pubsub.Message, targetTopic string, migrate Migration) error {
+	data := deadLetterPayload(message)
+	attributes := make(map[string]string)
+
+	for k, v := range message.Attributes {
+		attributes[k] = v
+	}
+
+	for _, attribute := range dlqAttributes {
+		delete(attributes, attribute)
+	}
+
+	// compressed data is decompressed for migrate, publishData compresses it as the producer is set
+	if _, ok := attributes[ContentEncodingAttribute]; ok && !encrypted(message) {
+		decompressed, err := messageData(&pubsub.Message{Data: data, Attributes: attributes}, DefaultMaxDecompressedSize)
+
+		if err != nil {
+			return fmt.Errorf("decompressing message %s: %w", message.ID, err)
+		}
+
+		delete(attributes, ContentEncodingAttribute)
+		data = decompressed
+	}
+
+	if migrate != nil {
+		migrated, err := migrate(message.Attributes[SchemaVersionAttribute], data)
+
+		if err != nil {
+			return fmt.Errorf("migrating message %s: %w", message.ID, err)
+		}
+
+		data = migrated
+	}
+
+	logrus.Infof("replaying message %s to %s", message.ID, targetTopic)
+
+	return p.publishData(ctx, targetTopic, data, attributes)
+}
@@ -0,0 +1,117 @@
+package grok
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/monitoring/v3"
+)
+
+// DLQDepthCacheTTL is how long DLQDepth reuses a depth, the metric being sampled every minute.
+const DLQDepthCacheTTL = time.Minute
+
+var (
+	// ErrDLQSubscriptionNotFound ...
+	ErrDLQSubscriptionNotFound = errors.New("dlq subscription not found")
+)
+
+type dlqDepth struct {
+	depth int64
+	at    time.Time
+}
+
+// WithMonitoringService sets the Cloud Monitoring service used by DLQDepth,
+// by default created with the application default credentials.
+func WithMonitoringService(svc *monitoring.Service) PubSubProducerOption {
+	return func(p *PubSubProducer) {
+		p.monitoring = svc
+	}
+}
+
+// DLQDepth returns the number of undelivered messages in the subscription named after
+// the dlq topic, created by subscribers along with the topic, as reported by Cloud Monitoring. Depths are cached for DLQDepthCacheTTL.
+func (p *PubSubProducer) DLQDepth(ctx context.Context, dlqTopic string) (int64, error) {
+	p.depthsMu.Lock()
+	cached, ok := p.depths[dlqTopic]
+	p.depthsMu.Unlock()
+
+	if ok && time.Since(cached.at) < DLQDepthCacheTTL {
+		return cached.depth, nil
+	}
+
+	exists, err := p.client.Subscription(dlqTopic).Exists(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if !exists {
+		return 0, fmt.Errorf("%w: %s", ErrDLQSubscriptionNotFound, dlqTopic)
+	}
+
+	depth, err := p.undeliveredMessages(ctx, dlqTopic)
+
+	if err != nil {
+		return 0, err
+	}
+
+	p.depthsMu.Lock()
+	p.depths[dlqTopic] = dlqDepth{depth: depth, at: time.Now()}
+	p.depthsMu.Unlock()
+
+	return depth, nil
+}
+
+func (p *PubSubProducer) undeliveredMessages(ctx context.Context, subscriptionID string) (int64, error) {
+	svc, err := p.monitoringService(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	// projects/PROJECT/topics/TOPIC
+	project := strings.Join(strings.Split(p.client.Topic(subscriptionID).String(), "/")[:2], "/")
+	now := time.Now().UTC()
+
+	response, err := svc.Projects.TimeSeries.List(project).
+		Filter(fmt.Sprintf(`metric.type = "pubsub.googleapis.com/subscription/num_undelivered_messages" AND resource.labels.subscription_id = "%s"`, subscriptionID)).
+		IntervalStartTime(now.Add(-5 * time.Minute).Format(time.RFC3339)).
+		IntervalEndTime(now.Format(time.RFC3339)).
+		Context(ctx).
+		Do()
+
+	if err != nil {
+		return 0, err
+	}
+
+	// points are returned newest first, no series means nothing was sampled yet
+	for _, series := range response.TimeSeries {
+		if len(series.Points) > 0 && series.Points[0].Value.Int64Value != nil {
+			return *series.Points[0].Value.Int64Value, nil
+		}
+	}
+
+	return 0, nil
+}
+
+func (p *PubSubProducer) monitoringService(ctx context.Context) (*monitoring.Service, error) {
+	p.depthsMu.Lock()
+	defer p.depthsMu.Unlock()
+
+	if p.monitoring != nil {
+		return p.monitoring, nil
+	}
+
+	svc, err := monitoring.NewService(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.monitoring = svc
+
+	return svc, nil
+}
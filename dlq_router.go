@@ -0,0 +1,29 @@
+package grok
+
+import (
+	"cloud.google.com/go/pubsub"
+)
+
+// DLQRouter returns the dlq topic of a message that failed with err, or an empty
+// string to use the default DLQTopicID.
+type DLQRouter func(message *pubsub.Message, err error) string
+
+// WithDLQRouter sends dead letters to the topic chosen by router, e.g. to separate
+// validation failures from transient ones. Routed topics and their subscriptions are
+// created like the default dlq.
+func WithDLQRouter(router DLQRouter) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.dlqRouter = router
+	}
+}
+
+// dlqTopicID returns the dlq topic of message, as routed by WithDLQRouter.
+func (s *PubSubSubscriber) dlqTopicID(message *pubsub.Message, err error) string {
+	if s.dlqRouter != nil {
+		if topicID := s.dlqRouter(message, err); topicID != "" {
+			return topicID
+		}
+	}
+
+	return s.DLQTopicID()
+}
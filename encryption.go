@@ -0,0 +1,61 @@
+package grok
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// EncryptedAttribute marks messages whose data was encrypted by WithEncryption.
+const EncryptedAttribute = "encrypted"
+
+// ErrNoDecryption is returned when an encrypted message reaches a subscriber without WithDecryption.
+var ErrNoDecryption = errors.New("encrypted message without decryption")
+
+// EncryptFunc encrypts a message body, ctx being the publish context.
+type EncryptFunc func(ctx context.Context, data []byte) ([]byte, error)
+
+// DecryptFunc decrypts a message body encrypted by the matching EncryptFunc, ctx being
+// the context of the message being processed.
+type DecryptFunc func(ctx context.Context, data []byte) ([]byte, error)
+
+// WithEncryption encrypts published bodies after marshaling and compressing them,
+// setting EncryptedAttribute so subscribers decrypt them before decoding.
+func WithEncryption(encrypt EncryptFunc) PubSubProducerOption {
+	return func(p *PubSubProducer) {
+		p.encrypt = encrypt
+	}
+}
+
+// WithDecryption decrypts messages marked with EncryptedAttribute before decompressing and
+// decoding them. Messages without the marker pass through, so a topic may mix both.
+func WithDecryption(decrypt DecryptFunc) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.decrypt = decrypt
+	}
+}
+
+func encrypted(message *pubsub.Message) bool {
+	return message.Attributes[EncryptedAttribute] == "true"
+}
+
+// messageData returns the message data, decrypted when EncryptedAttribute is set
+// and decompressed when ContentEncodingAttribute is set.
+func (s *PubSubSubscriber) messageData(ctx context.Context, message *pubsub.Message) ([]byte, error) {
+	if !encrypted(message) {
+		return messageData(message, s.maxDecompressedSize)
+	}
+
+	if s.decrypt == nil {
+		return nil, ErrNoDecryption
+	}
+
+	data, err := s.decrypt(ctx, message.Data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return messageData(&pubsub.Message{Data: data, Attributes: message.Attributes}, s.maxDecompressedSize)
+}
@@ -10,8 +10,9 @@ import (
 
 // Error ...
 type Error struct {
-	Code     int      `json:"code"`
-	Messages []string `json:"messages"`
+	Code      int      `json:"code"`
+	Messages  []string `json:"messages"`
+	RequestID string   `json:"request_id,omitempty"`
 }
 
 // NewError  ...
@@ -0,0 +1,43 @@
+package grok
+
+import (
+	"context"
+)
+
+// ErrorReporter sends errors to an error tracking service. The API reports handler panics
+// and the subscriber reports handler panics, before sending the message to the dlq, so both
+// may share one reporter. Report must not block for long, it runs on the failing request or message.
+type ErrorReporter interface {
+	Report(ctx context.Context, err error, fields map[string]interface{})
+}
+
+// ErrorReporterFunc adapts a function to an ErrorReporter, e.g. for Sentry:
+//
+//	reporter := grok.ErrorReporterFunc(func(ctx context.Context, err error, fields map[string]interface{}) {
+//		hub := sentry.CurrentHub().Clone()
+//		hub.Scope().SetExtras(fields)
+//		hub.CaptureException(err)
+//	})
+//
+//	api := grok.New(grok.WithErrorReporter(reporter))
+//	subscriber := grok.NewPubSubSubscriber(grok.WithSubscriberErrorReporter(reporter))
+type ErrorReporterFunc func(ctx context.Context, err error, fields map[string]interface{})
+
+// Report ...
+func (f ErrorReporterFunc) Report(ctx context.Context, err error, fields map[string]interface{}) {
+	f(ctx, err, fields)
+}
+
+// WithErrorReporter reports handler panics to reporter.
+func WithErrorReporter(reporter ErrorReporter) APIOption {
+	return func(server *API) {
+		server.errorReporter = reporter
+	}
+}
+
+// WithSubscriberErrorReporter reports handler panics to reporter.
+func WithSubscriberErrorReporter(reporter ErrorReporter) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.errorReporter = reporter
+	}
+}
@@ -0,0 +1,168 @@
+package grok
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+const (
+	// HealthUp ...
+	HealthUp = "up"
+	// HealthDown ...
+	HealthDown = "down"
+)
+
+// HealthCheck ...
+type HealthCheck func(ctx context.Context) error
+
+// HealthStatus ...
+type HealthStatus struct {
+	Name    string  `json:"name"`
+	Status  string  `json:"status"`
+	Error   string  `json:"error,omitempty"`
+	Latency float64 `json:"latency"`
+}
+
+// HealthReport ...
+type HealthReport struct {
+	Status string         `json:"status"`
+	Checks []HealthStatus `json:"checks"`
+}
+
+// HealthChecker runs registered dependency checks concurrently.
+// Reports are cached for ttl to avoid hammering dependencies.
+type HealthChecker struct {
+	timeout time.Duration
+	ttl     time.Duration
+
+	mu       sync.Mutex
+	names    []string
+	checks   map[string]HealthCheck
+	report   *HealthReport
+	reported time.Time
+}
+
+// NewHealthChecker ...
+func NewHealthChecker(timeout, ttl time.Duration) *HealthChecker {
+	return &HealthChecker{
+		timeout: timeout,
+		ttl:     ttl,
+		checks:  make(map[string]HealthCheck),
+	}
+}
+
+// Register ...
+func (h *HealthChecker) Register(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, exists := h.checks[name]; !exists {
+		h.names = append(h.names, name)
+	}
+
+	h.checks[name] = check
+	h.report = nil
+}
+
+// Check runs all checks, or returns the cached report if it is still fresh.
+func (h *HealthChecker) Check(ctx context.Context) *HealthReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.report != nil && time.Since(h.reported) < h.ttl {
+		return h.report
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	report := &HealthReport{Status: HealthUp, Checks: make([]HealthStatus, len(h.names))}
+	wg := new(sync.WaitGroup)
+
+	for i, name := range h.names {
+		wg.Add(1)
+		go func(i int, name string, check HealthCheck) {
+			defer wg.Done()
+			report.Checks[i] = runHealthCheck(ctx, name, check)
+		}(i, name, h.checks[name])
+	}
+
+	wg.Wait()
+
+	for _, c := range report.Checks {
+		if c.Status != HealthUp {
+			report.Status = HealthDown
+		}
+	}
+
+	h.report = report
+	h.reported = time.Now()
+
+	return report
+}
+
+// Handler responds 200 when all checks pass and 503 otherwise.
+func (h *HealthChecker) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := h.Check(c.Request.Context())
+
+		if report.Status != HealthUp {
+			c.JSON(http.StatusServiceUnavailable, report)
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+func runHealthCheck(ctx context.Context, name string, check HealthCheck) HealthStatus {
+	started := time.Now()
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- check(ctx)
+	}()
+
+	var err error
+
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	status := HealthStatus{
+		Name:    name,
+		Status:  HealthUp,
+		Latency: time.Since(started).Seconds(),
+	}
+
+	if err != nil {
+		status.Status = HealthDown
+		status.Error = err.Error()
+	}
+
+	return status
+}
+
+// MongoHealthCheck ...
+func MongoHealthCheck(client *mongo.Client) HealthCheck {
+	return func(ctx context.Context) error {
+		return client.Ping(ctx, readpref.Primary())
+	}
+}
+
+// PubSubHealthCheck ...
+func PubSubHealthCheck(client *pubsub.Client, topicID string) HealthCheck {
+	return func(ctx context.Context) error {
+		_, err := client.Topic(topicID).Exists(ctx)
+		return err
+	}
+}
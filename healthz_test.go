@@ -1,8 +1,14 @@
 package grok_test
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/recoli-tech/grok"
 	"github.com/stretchr/testify/assert"
 )
@@ -21,3 +27,42 @@ func TestHealthz(t *testing.T) {
 		assert.NoError(t, err)
 	})
 }
+
+func TestHealthChecker(t *testing.T) {
+	t.Run("All Up", func(t *testing.T) {
+		checker := grok.NewHealthChecker(time.Second, time.Second)
+		checker.Register("db", func(ctx context.Context) error { return nil })
+
+		report := checker.Check(context.Background())
+
+		assert.Equal(t, grok.HealthUp, report.Status)
+		assert.Len(t, report.Checks, 1)
+	})
+
+	t.Run("One Down", func(t *testing.T) {
+		checker := grok.NewHealthChecker(time.Second, time.Second)
+		checker.Register("db", func(ctx context.Context) error { return nil })
+		checker.Register("cache", func(ctx context.Context) error { return errors.New("down") })
+
+		response := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(response)
+		c.Request = httptest.NewRequest("GET", "/health", nil)
+
+		checker.Handler()(c)
+
+		assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+		assert.Contains(t, response.Body.String(), `"error":"down"`)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		checker := grok.NewHealthChecker(10*time.Millisecond, time.Second)
+		checker.Register("slow", func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		})
+
+		report := checker.Check(context.Background())
+
+		assert.Equal(t, grok.HealthDown, report.Status)
+	})
+}
@@ -0,0 +1,61 @@
+package grok
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// BeforeProcessHook is called before a message is decoded, the returned context is
+// passed to the handler.
+type BeforeProcessHook func(ctx context.Context, message *pubsub.Message) context.Context
+
+// AfterProcessHook is called with the disposition of every processed message and the
+// error that caused it, if any.
+type AfterProcessHook func(ctx context.Context, message *pubsub.Message, disposition Disposition, err error)
+
+// WithBeforeProcess sets a hook to enrich the handler context, e.g. with instrumentation.
+// Panics in the hook are logged and the original context is used.
+func WithBeforeProcess(hook BeforeProcessHook) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.beforeProcess = hook
+	}
+}
+
+// WithAfterProcess sets a hook called after every message is processed.
+// Panics in the hook are logged.
+func WithAfterProcess(hook AfterProcessHook) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.afterProcess = hook
+	}
+}
+
+func (s *PubSubSubscriber) before(c context.Context, message *pubsub.Message) (ctx context.Context) {
+	ctx = c
+
+	defer func() {
+		if r := recover(); r != nil {
+			ctx = c
+			s.log.WithField("error", fmt.Sprint(r)).
+				Errorf("before process hook panicked with message %s", message.ID)
+		}
+	}()
+
+	if enriched := s.beforeProcess(c, message); enriched != nil {
+		ctx = enriched
+	}
+
+	return ctx
+}
+
+func (s *PubSubSubscriber) after(c context.Context, message *pubsub.Message, disposition Disposition, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.log.WithField("error", fmt.Sprint(r)).
+				Errorf("after process hook panicked with message %s", message.ID)
+		}
+	}()
+
+	s.afterProcess(c, message, disposition, err)
+}
@@ -0,0 +1,67 @@
+package grok
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const trustedProxyKey = "grok.trusted_proxy"
+
+// DefaultHSTSMaxAge is the Strict-Transport-Security max-age set by WithHTTPSRedirect.
+const DefaultHSTSMaxAge = 365 * 24 * time.Hour
+
+// WithHTTPSRedirect redirects http requests to https, 301 for GET and HEAD and 308 for
+// the other methods to keep their body, and sets Strict-Transport-Security on https
+// responses. Healthz and health are never redirected, so plain http probes keep working.
+// Requests are https when served with TLS or, when they come from a proxy trusted by
+// WithTrustedProxies, when X-Forwarded-Proto is https. Behind a TLS terminating proxy
+// not trusted every request looks like http and is redirected forever.
+func WithHTTPSRedirect() APIOption {
+	return func(server *API) {
+		server.httpsRedirect = true
+	}
+}
+
+// WithHSTSMaxAge - default DefaultHSTSMaxAge. Max-age of the Strict-Transport-Security header.
+func WithHSTSMaxAge(d time.Duration) APIOption {
+	return func(server *API) {
+		server.hstsMaxAge = d
+	}
+}
+
+func httpsRedirect(maxAge time.Duration) gin.HandlerFunc {
+	hsts := fmt.Sprintf("max-age=%d", int64(maxAge/time.Second))
+
+	return func(c *gin.Context) {
+		if c.Request.URL.Path == "/healthz" || c.Request.URL.Path == "/health" {
+			c.Next()
+			return
+		}
+
+		if isHTTPS(c) {
+			c.Header("Strict-Transport-Security", hsts)
+			c.Next()
+			return
+		}
+
+		status := http.StatusPermanentRedirect
+
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+
+		c.Redirect(status, "https://"+c.Request.Host+c.Request.URL.RequestURI())
+		c.Abort()
+	}
+}
+
+func isHTTPS(c *gin.Context) bool {
+	if c.Request.TLS != nil {
+		return true
+	}
+
+	return c.GetBool(trustedProxyKey) && c.GetHeader("X-Forwarded-Proto") == "https"
+}
@@ -0,0 +1,53 @@
+package grok
+
+import (
+	"context"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// IdempotencyKeyAttribute carries the key resolved by WithIdempotencyKey across retries.
+const IdempotencyKeyAttribute = "idempotency_key"
+
+type idempotencyKeyContextKey struct{}
+
+// WithIdempotencyKey resolves a stable key per message with keyFunc, e.g. from a business
+// attribute, falling back to the message ID when it returns an empty string. The key is kept
+// in IdempotencyKeyAttribute, so retries, which republish with new IDs, resolve the same key.
+// Handlers read it with IdempotencyKey.
+func WithIdempotencyKey(keyFunc func(*pubsub.Message) string) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.idempotencyKey = keyFunc
+	}
+}
+
+// IdempotencyKey returns the key resolved by WithIdempotencyKey for the message being handled,
+// or an empty string.
+func IdempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyContextKey{}).(string)
+	return key
+}
+
+func (s *PubSubSubscriber) withIdempotencyKey(ctx context.Context, message *pubsub.Message) context.Context {
+	if s.idempotencyKey == nil {
+		return ctx
+	}
+
+	key := message.Attributes[IdempotencyKeyAttribute]
+
+	if key == "" {
+		key = s.idempotencyKey(message)
+	}
+
+	if key == "" {
+		key = message.ID
+	}
+
+	if message.Attributes == nil {
+		message.Attributes = make(map[string]string)
+	}
+
+	message.Attributes[IdempotencyKeyAttribute] = key
+
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
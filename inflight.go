@@ -0,0 +1,76 @@
+package grok
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.opencensus.io/stats"
+)
+
+// inflightRequests tracks the requests being served, so shutdown can report them.
+type inflightRequests struct {
+	mu       sync.Mutex
+	next     uint64
+	requests map[uint64]*http.Request
+	metrics  bool
+}
+
+func newInflightRequests(metrics bool) *inflightRequests {
+	return &inflightRequests{requests: make(map[uint64]*http.Request), metrics: metrics}
+}
+
+func (r *inflightRequests) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := r.add(c.Request)
+		defer r.done(id)
+
+		c.Next()
+	}
+}
+
+func (r *inflightRequests) add(req *http.Request) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.next++
+	r.requests[r.next] = req
+	r.record()
+
+	return r.next
+}
+
+func (r *inflightRequests) done(id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.requests, id)
+	r.record()
+}
+
+func (r *inflightRequests) record() {
+	if r.metrics {
+		stats.Record(context.Background(), HTTPInflightRequests.M(int64(len(r.requests))))
+	}
+}
+
+func (r *inflightRequests) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.requests)
+}
+
+func (r *inflightRequests) paths() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	paths := make([]string, 0, len(r.requests))
+
+	for _, req := range r.requests {
+		paths = append(paths, req.Method+" "+req.URL.Path)
+	}
+
+	return paths
+}
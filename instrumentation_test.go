@@ -0,0 +1,83 @@
+package grok
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+func disabledInstrumentation() (*PubSubSubscriber, *inflightRequests, *pubsub.Message) {
+	subscriber := NewPubSubSubscriber(WithPubSubSubscriberID("subs"), WithTopicID("topic"))
+	message := &pubsub.Message{ID: "1", Attributes: map[string]string{}}
+
+	return subscriber, newInflightRequests(false), message
+}
+
+func TestDisabledInstrumentationDoesNotAllocate(t *testing.T) {
+	subscriber, inflight, message := disabledInstrumentation()
+	req := httptest.NewRequest("GET", "/", nil)
+	ctx := context.Background()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_, span := subscriber.startSpan(ctx, message)
+		subscriber.traceFields(span)
+		subscriber.record(ctx, RecoveredMessages.M(1))
+		inflight.done(inflight.add(req))
+	})
+
+	if allocs > 0 {
+		t.Errorf("disabled instrumentation allocates %v times", allocs)
+	}
+}
+
+func TestSubscriberMetrics(t *testing.T) {
+	recorded := NewPubSubSubscriber(WithPubSubSubscriberID("subs-metrics"), WithSubscriberMetrics())
+	NewPubSubSubscriber(WithSubscriberMetrics())
+	disabled := NewPubSubSubscriber(WithPubSubSubscriberID("subs-no-metrics"))
+
+	recorded.record(context.Background(), RecoveredMessages.M(1), tag.Upsert(KeyRetries, retriesBucket(1)))
+	disabled.record(context.Background(), RecoveredMessages.M(1), tag.Upsert(KeyRetries, retriesBucket(1)))
+
+	rows, err := view.RetrieveData(RecoveredMessagesView.Name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subscriptions := map[string]bool{}
+
+	for _, row := range rows {
+		for _, tag := range row.Tags {
+			if tag.Key == KeySubscription {
+				subscriptions[tag.Value] = true
+			}
+		}
+	}
+
+	if !subscriptions["subs-metrics"] {
+		t.Errorf("recovered message not recorded: %v", rows)
+	}
+
+	if subscriptions["subs-no-metrics"] {
+		t.Errorf("recovered message recorded without WithSubscriberMetrics: %v", rows)
+	}
+}
+
+func BenchmarkDisabledInstrumentation(b *testing.B) {
+	subscriber, inflight, message := disabledInstrumentation()
+	req := httptest.NewRequest("GET", "/", nil)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		_, span := subscriber.startSpan(ctx, message)
+		subscriber.traceFields(span)
+		subscriber.record(ctx, RecoveredMessages.M(1))
+		inflight.done(inflight.add(req))
+	}
+}
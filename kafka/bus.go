@@ -0,0 +1,248 @@
+// Package kafka is a grok.MessageBus over Kafka, so subscribers keep their handler,
+// retries, dlq and middlewares when consuming Kafka topics:
+//
+//	bus := kafka.NewBus([]string{"localhost:9092"})
+//	subscriber := grok.NewPubSubSubscriber(grok.WithMessageBus(bus), ...)
+//
+// Subscriptions are consumer groups and attributes are message headers. Messages are
+// handled one at a time in offset order and committed once acked; a nacked message is
+// handled again after the nack backoff, holding back its partition meanwhile.
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/recoli-tech/grok"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// DefaultNackBackoff is how long a nacked message waits before it is handled again.
+const DefaultNackBackoff = time.Second
+
+type reader interface {
+	FetchMessage(ctx context.Context) (kafkago.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafkago.Message) error
+	Close() error
+}
+
+type writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafkago.Message) error
+	Close() error
+}
+
+// Bus implements grok.MessageBus for the Kafka cluster of its brokers.
+type Bus struct {
+	brokers      []string
+	dialer       *kafkago.Dialer
+	nackBackoff  time.Duration
+	writeTimeout time.Duration
+	newReader    func(kafkago.ReaderConfig) reader
+	newWriter    func(kafkago.WriterConfig) writer
+
+	mu      sync.Mutex
+	writers map[string]writer
+}
+
+// BusOption ...
+type BusOption func(*Bus)
+
+// WithDialer sets the dialer of readers and writers, e.g. for TLS or SASL.
+func WithDialer(dialer *kafkago.Dialer) BusOption {
+	return func(b *Bus) {
+		b.dialer = dialer
+	}
+}
+
+// WithNackBackoff - default DefaultNackBackoff.
+func WithNackBackoff(d time.Duration) BusOption {
+	return func(b *Bus) {
+		b.nackBackoff = d
+	}
+}
+
+// WithWriteTimeout bounds each publish - default 10s.
+func WithWriteTimeout(d time.Duration) BusOption {
+	return func(b *Bus) {
+		b.writeTimeout = d
+	}
+}
+
+// NewBus creates a bus of the cluster of brokers.
+func NewBus(brokers []string, opts ...BusOption) *Bus {
+	bus := &Bus{
+		brokers:      brokers,
+		nackBackoff:  DefaultNackBackoff,
+		writeTimeout: 10 * time.Second,
+		writers:      map[string]writer{},
+		newReader: func(config kafkago.ReaderConfig) reader {
+			return kafkago.NewReader(config)
+		},
+		newWriter: func(config kafkago.WriterConfig) writer {
+			return kafkago.NewWriter(config)
+		},
+	}
+
+	for _, opt := range opts {
+		opt(bus)
+	}
+
+	return bus
+}
+
+// PublishWihAttribrutes publishes data encoded as JSON.
+func (b *Bus) PublishWihAttribrutes(topicID string, data interface{}, attributes map[string]string) error {
+	payload, err := json.Marshal(data)
+
+	if err != nil {
+		return err
+	}
+
+	return b.PublishRaw(topicID, payload, attributes)
+}
+
+// PublishRaw publishes data as is, with the attributes as headers.
+func (b *Bus) PublishRaw(topicID string, data []byte, attributes map[string]string) error {
+	message := kafkago.Message{Value: data}
+
+	for key, value := range attributes {
+		message.Headers = append(message.Headers, kafkago.Header{Key: key, Value: []byte(value)})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.writeTimeout)
+	defer cancel()
+
+	if err := b.writer(topicID).WriteMessages(ctx, message); err != nil {
+		return fmt.Errorf("publishing to %s: %w", topicID, err)
+	}
+
+	return nil
+}
+
+// Receive consumes topicID in the subscriptionID consumer group, committing each message
+// once handler acks it.
+func (b *Bus) Receive(ctx context.Context, subscriptionID, topicID string, handler grok.BusHandler) error {
+	r := b.newReader(kafkago.ReaderConfig{
+		Brokers: b.brokers,
+		GroupID: subscriptionID,
+		Topic:   topicID,
+		Dialer:  b.dialer,
+	})
+
+	defer r.Close()
+
+	for {
+		message, err := r.FetchMessage(ctx)
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("receiving from %s: %w", topicID, err)
+		}
+
+		if !b.handle(ctx, message, handler) {
+			return nil
+		}
+
+		if err := r.CommitMessages(ctx, message); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("committing %s: %w", messageID(message), err)
+		}
+	}
+}
+
+// Close closes the writers of the topics published to.
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var first error
+
+	for topicID, w := range b.writers {
+		if err := w.Close(); err != nil && first == nil {
+			first = err
+		}
+
+		delete(b.writers, topicID)
+	}
+
+	return first
+}
+
+// handle calls handler until it acks message, returning false when ctx is done first.
+func (b *Bus) handle(ctx context.Context, message kafkago.Message, handler grok.BusHandler) bool {
+	for {
+		ack := new(acknowledger)
+		handler(ctx, toMessage(message), ack)
+
+		if ack.acked {
+			return true
+		}
+
+		timer := time.NewTimer(b.nackBackoff)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+}
+
+func (b *Bus) writer(topicID string) writer {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	w, ok := b.writers[topicID]
+
+	if !ok {
+		w = b.newWriter(kafkago.WriterConfig{
+			Brokers: b.brokers,
+			Topic:   topicID,
+			Dialer:  b.dialer,
+		})
+
+		b.writers[topicID] = w
+	}
+
+	return w
+}
+
+// acknowledger records whether the handler acked the message, a message neither acked
+// nor nacked is nacked.
+type acknowledger struct {
+	acked bool
+}
+
+func (a *acknowledger) Ack()  { a.acked = true }
+func (a *acknowledger) Nack() { a.acked = false }
+
+func toMessage(message kafkago.Message) *pubsub.Message {
+	attributes := make(map[string]string, len(message.Headers))
+
+	for _, header := range message.Headers {
+		attributes[header.Key] = string(header.Value)
+	}
+
+	return &pubsub.Message{
+		ID:          messageID(message),
+		Data:        message.Value,
+		Attributes:  attributes,
+		PublishTime: message.Time,
+	}
+}
+
+// messageID identifies a message by its topic, partition and offset.
+func messageID(message kafkago.Message) string {
+	return fmt.Sprintf("%s/%d/%d", message.Topic, message.Partition, message.Offset)
+}
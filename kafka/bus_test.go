@@ -0,0 +1,195 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/recoli-tech/grok"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// broker is an in memory cluster, a buffered channel per topic.
+type broker struct {
+	mu      sync.Mutex
+	topics  map[string]chan kafkago.Message
+	offsets map[string]int64
+	commits chan kafkago.Message
+}
+
+func newBroker() *broker {
+	return &broker{
+		topics:  map[string]chan kafkago.Message{},
+		offsets: map[string]int64{},
+		commits: make(chan kafkago.Message, 100),
+	}
+}
+
+func (b *broker) topic(id string) chan kafkago.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.topics[id]; !ok {
+		b.topics[id] = make(chan kafkago.Message, 100)
+	}
+
+	return b.topics[id]
+}
+
+func (b *broker) bus(opts ...BusOption) *Bus {
+	bus := NewBus([]string{"localhost:9092"}, opts...)
+
+	bus.newReader = func(config kafkago.ReaderConfig) reader {
+		return &fakeReader{broker: b, topic: config.Topic}
+	}
+
+	bus.newWriter = func(config kafkago.WriterConfig) writer {
+		return &fakeWriter{broker: b, topic: config.Topic}
+	}
+
+	return bus
+}
+
+type fakeWriter struct {
+	broker *broker
+	topic  string
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	for _, msg := range msgs {
+		w.broker.mu.Lock()
+		msg.Topic = w.topic
+		msg.Offset = w.broker.offsets[w.topic]
+		msg.Time = time.Now()
+		w.broker.offsets[w.topic]++
+		w.broker.mu.Unlock()
+
+		w.broker.topic(w.topic) <- msg
+	}
+
+	return nil
+}
+
+func (w *fakeWriter) Close() error { return nil }
+
+type fakeReader struct {
+	broker *broker
+	topic  string
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafkago.Message, error) {
+	select {
+	case msg := <-r.broker.topic(r.topic):
+		return msg, nil
+	case <-ctx.Done():
+		return kafkago.Message{}, ctx.Err()
+	}
+}
+
+func (r *fakeReader) CommitMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	for _, msg := range msgs {
+		r.broker.commits <- msg
+	}
+
+	return nil
+}
+
+func (r *fakeReader) Close() error { return nil }
+
+func TestSubscriberRetriesAndDeadLetters(t *testing.T) {
+	broker := newBroker()
+	bus := broker.bus()
+	retries := make(chan string, 10)
+
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithMessageBus(bus),
+		grok.WithTopicID("orders"),
+		grok.WithPubSubSubscriberID("orders-sub"),
+		grok.WithMaxRetries(1),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			retries <- delivery.Message.Attributes["retries"]
+			return errors.New("failure")
+		}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- subscriber.Run(ctx) }()
+
+	assert.NoError(t, bus.PublishRaw("orders", []byte(`{"id":1}`), map[string]string{"tenant": "acme"}))
+
+	var dead kafkago.Message
+
+	select {
+	case dead = <-broker.topic("orders_dlq"):
+	case <-ctx.Done():
+		t.Fatal("message not sent to the dlq")
+	}
+
+	var data []byte
+	assert.NoError(t, json.Unmarshal(dead.Value, &data))
+	assert.Equal(t, []byte(`{"id":1}`), data)
+	assert.Equal(t, "failure", toMessage(dead).Attributes["error"])
+
+	assert.Equal(t, "", <-retries)
+	assert.Equal(t, "1", <-retries)
+
+	for _, offset := range []string{"orders/0/0", "orders/0/1"} {
+		select {
+		case commit := <-broker.commits:
+			assert.Equal(t, offset, messageID(commit))
+		case <-ctx.Done():
+			t.Fatalf("message %s not committed", offset)
+		}
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestReceiveNack(t *testing.T) {
+	broker := newBroker()
+	bus := broker.bus(WithNackBackoff(10 * time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, bus.PublishRaw("orders", []byte(`{"id":1}`), map[string]string{"tenant": "acme"}))
+
+	calls := 0
+	done := make(chan error, 1)
+
+	go func() {
+		done <- bus.Receive(ctx, "orders-sub", "orders", func(ctx context.Context, message *pubsub.Message, ack grok.Acknowledger) {
+			calls++
+
+			assert.Equal(t, "orders/0/0", message.ID)
+			assert.Equal(t, map[string]string{"tenant": "acme"}, message.Attributes)
+
+			if calls == 1 {
+				ack.Nack()
+				return
+			}
+
+			ack.Ack()
+		})
+	}()
+
+	select {
+	case commit := <-broker.commits:
+		assert.Equal(t, "orders/0/0", messageID(commit))
+	case <-ctx.Done():
+		t.Fatal("message not committed")
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,135 @@
+package grok
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+)
+
+// ErrInvalidEnvelope is returned when decrypting data not produced by KMSEnvelope.Encrypt.
+var ErrInvalidEnvelope = errors.New("invalid encryption envelope")
+
+// KMSEnvelope is a Cloud KMS backed envelope encryption for WithEncryption and WithDecryption.
+// Each body is encrypted with a new AES-256-GCM data key, which is wrapped by the KMS key
+// and sent along, so the KMS is called once per message and the body never leaves the process.
+type KMSEnvelope struct {
+	keyName string
+	keys    *cloudkms.ProjectsLocationsKeyRingsCryptoKeysService
+}
+
+// NewKMSEnvelope creates a KMSEnvelope for the crypto key resource keyName, e.g.
+// projects/p/locations/global/keyRings/r/cryptoKeys/k.
+func NewKMSEnvelope(ctx context.Context, keyName string, opts ...option.ClientOption) (*KMSEnvelope, error) {
+	service, err := cloudkms.NewService(ctx, opts...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &KMSEnvelope{
+		keyName: keyName,
+		keys:    service.Projects.Locations.KeyRings.CryptoKeys,
+	}, nil
+}
+
+// Encrypt returns the wrapped data key length, the wrapped data key, the nonce and the sealed data.
+func (e *KMSEnvelope) Encrypt(ctx context.Context, data []byte) ([]byte, error) {
+	key := make([]byte, 32)
+
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	response, err := e.keys.Encrypt(e.keyName, &cloudkms.EncryptRequest{
+		Plaintext: base64.StdEncoding.EncodeToString(key),
+	}).Context(ctx).Do()
+
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(response.Ciphertext)
+
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	envelope := make([]byte, 2, 2+len(wrapped)+len(nonce)+len(data)+gcm.Overhead())
+	binary.BigEndian.PutUint16(envelope, uint16(len(wrapped)))
+	envelope = append(envelope, wrapped...)
+	envelope = append(envelope, nonce...)
+
+	return gcm.Seal(envelope, nonce, data, nil), nil
+}
+
+// Decrypt unwraps the data key with the KMS key and opens data.
+func (e *KMSEnvelope) Decrypt(ctx context.Context, data []byte) ([]byte, error) {
+	if len(data) < 2 {
+		return nil, ErrInvalidEnvelope
+	}
+
+	size := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+
+	if len(data) < size {
+		return nil, ErrInvalidEnvelope
+	}
+
+	response, err := e.keys.Decrypt(e.keyName, &cloudkms.DecryptRequest{
+		Ciphertext: base64.StdEncoding.EncodeToString(data[:size]),
+	}).Context(ctx).Do()
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(response.Plaintext)
+
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data = data[size:]
+
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrInvalidEnvelope
+	}
+
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,96 @@
+package grok_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/recoli-tech/grok"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+const kmsKeyName = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+
+// newKMSFake serves the KMS encrypt and decrypt calls, wrapping keys with a prefix.
+func newKMSFake(t *testing.T, calls *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls = append(*calls, r.URL.Path)
+
+		request := map[string]string{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/v1/" + kmsKeyName + ":encrypt":
+			key, _ := base64.StdEncoding.DecodeString(request["plaintext"])
+			json.NewEncoder(w).Encode(map[string]string{
+				"ciphertext": base64.StdEncoding.EncodeToString(append([]byte("wrapped:"), key...)),
+			})
+		case "/v1/" + kmsKeyName + ":decrypt":
+			wrapped, _ := base64.StdEncoding.DecodeString(request["ciphertext"])
+			json.NewEncoder(w).Encode(map[string]string{
+				"plaintext": base64.StdEncoding.EncodeToString(bytes.TrimPrefix(wrapped, []byte("wrapped:"))),
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func newTestKMSEnvelope(t *testing.T, server *httptest.Server) *grok.KMSEnvelope {
+	envelope, err := grok.NewKMSEnvelope(context.Background(), kmsKeyName,
+		option.WithEndpoint(server.URL+"/"),
+		option.WithHTTPClient(server.Client()))
+	assert.NoError(t, err)
+
+	return envelope
+}
+
+func TestKMSEnvelope(t *testing.T) {
+	calls := []string{}
+	server := newKMSFake(t, &calls)
+	defer server.Close()
+
+	envelope := newTestKMSEnvelope(t, server)
+	ctx := context.Background()
+
+	sealed, err := envelope.Encrypt(ctx, []byte(`{"id":1}`))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(sealed), `"id"`)
+
+	data, err := envelope.Decrypt(ctx, sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`{"id":1}`), data)
+	assert.Len(t, calls, 2)
+
+	sealed[len(sealed)-1] ^= 1
+	_, err = envelope.Decrypt(ctx, sealed)
+	assert.Error(t, err)
+
+	_, err = envelope.Decrypt(ctx, []byte{0})
+	assert.Equal(t, grok.ErrInvalidEnvelope, err)
+}
+
+func TestKMSEnvelopeContext(t *testing.T) {
+	calls := []string{}
+	server := newKMSFake(t, &calls)
+	defer server.Close()
+
+	envelope := newTestKMSEnvelope(t, server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := envelope.Encrypt(ctx, []byte(`{"id":1}`))
+
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), context.Canceled.Error()), err.Error())
+	assert.Empty(t, calls)
+}
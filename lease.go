@@ -0,0 +1,91 @@
+package grok
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// lease is the handler context of a message. Its deadline can be pushed forward by
+// the handler, up to the subscription MaxExtension counted from the receipt.
+type lease struct {
+	context.Context
+
+	cancel   context.CancelFunc
+	mu       sync.Mutex
+	timer    *time.Timer
+	deadline time.Time
+	limit    time.Time
+	expired  bool
+}
+
+func newLease(parent context.Context, d, maxExtension time.Duration) *lease {
+	ctx, cancel := context.WithCancel(parent)
+	now := time.Now()
+
+	l := &lease{
+		Context:  ctx,
+		cancel:   cancel,
+		deadline: now.Add(d),
+		limit:    now.Add(maxExtension),
+	}
+
+	l.timer = time.AfterFunc(d, l.expire)
+
+	return l
+}
+
+func (l *lease) Deadline() (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.deadline, true
+}
+
+func (l *lease) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.expired {
+		return context.DeadlineExceeded
+	}
+
+	return l.Context.Err()
+}
+
+// extend moves the deadline to d from now. It never shortens the lease nor goes
+// past the limit, and does nothing once the lease expired.
+func (l *lease) extend(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	deadline := time.Now().Add(d)
+
+	if deadline.After(l.limit) {
+		deadline = l.limit
+	}
+
+	if !deadline.After(l.deadline) || l.Context.Err() != nil {
+		return
+	}
+
+	if !l.timer.Stop() {
+		return
+	}
+
+	l.deadline = deadline
+	l.timer.Reset(time.Until(deadline))
+}
+
+func (l *lease) expire() {
+	l.mu.Lock()
+	l.expired = true
+	l.mu.Unlock()
+
+	l.cancel()
+}
+
+func (l *lease) release() {
+	l.timer.Stop()
+	l.cancel()
+}
@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -12,18 +15,42 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const redactedValue = "***"
+
+// RequestIDKey is the context key of the request id set by LogMiddleware.
+const RequestIDKey = "request_id"
+
+// internalKeyPrefix prefixes the context keys set by grok for its own middlewares.
+const internalKeyPrefix = "grok."
+
+var (
+	// DefaultLogRedaction are the header names and query keys always redacted by LogMiddleware.
+	DefaultLogRedaction = []string{"Authorization", "Cookie", "Set-Cookie", "token", "api_key"}
+)
+
 type bodyLogWriter struct {
 	gin.ResponseWriter
-	body *bytes.Buffer
+	body      *bytes.Buffer
+	streaming bool
 }
 
 func (w *bodyLogWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)
+	if !w.streaming {
+		w.body.Write(b)
+	}
+
 	return w.ResponseWriter.Write(b)
 }
 
-//LogMiddleware ...
-func LogMiddleware() gin.HandlerFunc {
+//LogMiddleware logs every request, redacting the values of DefaultLogRedaction
+// and the given header names and query keys, in both request and response headers.
+func LogMiddleware(redacted ...string) gin.HandlerFunc {
+	keys := make(map[string]bool)
+
+	for _, k := range append(append([]string{}, DefaultLogRedaction...), redacted...) {
+		keys[strings.ToLower(k)] = true
+	}
+
 	return func(c *gin.Context) {
 		defer recovery()
 		defer c.Request.Body.Close()
@@ -33,9 +60,10 @@ func LogMiddleware() gin.HandlerFunc {
 		blw := &bodyLogWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
 		blw.Header().Set("Request-Id", requestID.String())
 		c.Writer = blw
+		c.Set(RequestIDKey, requestID.String())
 
 		now := time.Now()
-		req := request(c)
+		req := request(c, keys)
 
 		c.Next()
 
@@ -43,12 +71,16 @@ func LogMiddleware() gin.HandlerFunc {
 		fields := make(map[string]interface{})
 
 		fields["request"] = req
-		fields["claims"] = c.Keys
+		fields["claims"] = claims(c)
 		fields["errors"] = c.Errors
 		fields["ip"] = c.ClientIP()
 		fields["latency"] = elapsed.Seconds()
 		fields["request_id"] = requestID.String()
-		fields["response"] = response(blw)
+		fields["response"] = response(blw, keys)
+
+		if tenant := TenantFromContext(c); tenant != "" {
+			fields["tenant"] = tenant
+		}
 
 		logrus.WithFields(fields).Infof(
 			"Request incoming from %s elapsed %s completed with %d",
@@ -59,7 +91,29 @@ func LogMiddleware() gin.HandlerFunc {
 	}
 }
 
-func request(context *gin.Context) interface{} {
+// claims returns the keys of the context set by the authentication middlewares, leaving
+// out the request id, logged on its own, and the internal keys of grok, prefixed with
+// internalKeyPrefix, which hold values such as funcs that cannot be logged.
+func claims(c *gin.Context) map[string]interface{} {
+	claims := make(map[string]interface{}, len(c.Keys))
+
+	for k, v := range c.Keys {
+		if k == RequestIDKey || strings.HasPrefix(k, internalKeyPrefix) {
+			continue
+		}
+
+		claims[k] = v
+	}
+
+	return claims
+}
+
+// RequestID returns the request id set by LogMiddleware, also sent in the Request-Id header.
+func RequestID(c *gin.Context) string {
+	return c.GetString(RequestIDKey)
+}
+
+func request(context *gin.Context, redacted map[string]bool) interface{} {
 	r := make(map[string]interface{})
 
 	bodyCopy := new(bytes.Buffer)
@@ -74,18 +128,55 @@ func request(context *gin.Context) interface{} {
 	r["form"] = context.Request.Form
 	r["path"] = context.Request.URL.Path
 	r["method"] = context.Request.Method
-	r["headers"] = context.Request.Header
-	r["url"] = context.Request.URL.String()
+	r["headers"] = redactHeaders(context.Request.Header, redacted)
+	r["url"] = redactURL(context.Request.URL, redacted)
 	r["post_form"] = context.Request.PostForm
 	r["remote_addr"] = context.Request.RemoteAddr
-	r["query_string"] = context.Request.URL.Query()
+	r["query_string"] = redactQuery(context.Request.URL.Query(), redacted)
 
 	context.Request.Body = ioutil.NopCloser(bytes.NewReader(bodyData))
 
 	return r
 }
 
-func response(writer *bodyLogWriter) interface{} {
+func redactHeaders(headers http.Header, redacted map[string]bool) http.Header {
+	result := make(http.Header, len(headers))
+
+	for k, v := range headers {
+		if redacted[strings.ToLower(k)] {
+			result[k] = []string{redactedValue}
+			continue
+		}
+
+		result[k] = v
+	}
+
+	return result
+}
+
+func redactQuery(query url.Values, redacted map[string]bool) url.Values {
+	for k := range query {
+		if redacted[strings.ToLower(k)] {
+			query[k] = []string{redactedValue}
+		}
+	}
+
+	return query
+}
+
+func redactURL(u *url.URL, redacted map[string]bool) string {
+	copied := *u
+	copied.RawQuery = strings.Replace(
+		redactQuery(u.Query(), redacted).Encode(),
+		url.QueryEscape(redactedValue),
+		redactedValue,
+		-1,
+	)
+
+	return copied.String()
+}
+
+func response(writer *bodyLogWriter, redacted map[string]bool) interface{} {
 	r := make(map[string]interface{})
 
 	var body map[string]interface{}
@@ -93,7 +184,7 @@ func response(writer *bodyLogWriter) interface{} {
 
 	r["body"] = body
 	r["status"] = writer.Status()
-	r["headers"] = writer.Header()
+	r["headers"] = redactHeaders(writer.Header(), redacted)
 
 	return r
 }
@@ -0,0 +1,104 @@
+package grok_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/recoli-tech/grok"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// captureLog serves req with engine, returning the request log line formatted as JSON.
+func captureLog(t *testing.T, engine *gin.Engine, req *http.Request) map[string]interface{} {
+	output := new(bytes.Buffer)
+
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+	logrus.SetOutput(output)
+
+	defer func() {
+		logrus.SetFormatter(&logrus.TextFormatter{})
+		logrus.SetOutput(os.Stderr)
+	}()
+
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+
+	entry := map[string]interface{}{}
+
+	for _, line := range bytes.Split(bytes.TrimSpace(output.Bytes()), []byte("\n")) {
+		entry = map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal(line, &entry), string(line))
+	}
+
+	return entry
+}
+
+func TestLogMiddlewareInternalKeys(t *testing.T) {
+	settings := &grok.Settings{}
+	grok.FromYAML("tests/config.yaml", settings)
+
+	server := grok.New(
+		grok.WithSettings(settings),
+		grok.WithBindErrorHandler(grok.SafeBindErrorHandler))
+
+	server.Engine.GET("/tenant",
+		grok.Tenant(grok.TenantFromHeader("X-Tenant")),
+		func(c *gin.Context) {
+			c.Set("sub", "user-1")
+			c.Status(http.StatusNoContent)
+		})
+
+	req := httptest.NewRequest("GET", "/tenant", nil)
+	req.Header.Set("X-Tenant", "acme")
+
+	entry := captureLog(t, server.Engine, req)
+
+	assert.Equal(t, map[string]interface{}{"sub": "user-1"}, entry["claims"])
+	assert.Equal(t, "acme", entry["tenant"])
+	assert.NotEmpty(t, entry["request_id"])
+}
+
+func TestLogMiddlewareRedaction(t *testing.T) {
+	settings := &grok.Settings{}
+	grok.FromYAML("tests/config.yaml", settings)
+
+	server := grok.New(
+		grok.WithSettings(settings),
+		grok.WithLogRedaction([]string{"X-Secret", "signature"}))
+
+	server.Engine.GET("/redacted", func(c *gin.Context) {
+		c.Header("Set-Cookie", "session=abc")
+		c.Header("X-Secret", "def")
+		c.Header("X-Trace", "1")
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest("GET", "/redacted?token=abc&signature=def&page=1", nil)
+	req.Header.Set("Authorization", "Bearer abc")
+	req.Header.Set("X-Secret", "def")
+	req.Header.Set("X-Trace", "1")
+
+	entry := captureLog(t, server.Engine, req)
+	request := entry["request"].(map[string]interface{})
+	headers := request["headers"].(map[string]interface{})
+	query := request["query_string"].(map[string]interface{})
+
+	assert.Equal(t, []interface{}{"***"}, headers["Authorization"])
+	assert.Equal(t, []interface{}{"***"}, headers["X-Secret"])
+	assert.Equal(t, []interface{}{"1"}, headers["X-Trace"])
+	assert.Equal(t, []interface{}{"***"}, query["token"])
+	assert.Equal(t, []interface{}{"***"}, query["signature"])
+	assert.Equal(t, []interface{}{"1"}, query["page"])
+	assert.Equal(t, "/redacted?page=1&signature=***&token=***", request["url"])
+
+	headers = entry["response"].(map[string]interface{})["headers"].(map[string]interface{})
+
+	assert.Equal(t, []interface{}{"***"}, headers["Set-Cookie"])
+	assert.Equal(t, []interface{}{"***"}, headers["X-Secret"])
+	assert.Equal(t, []interface{}{"1"}, headers["X-Trace"])
+}
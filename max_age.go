@@ -0,0 +1,48 @@
+package grok
+
+import (
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// PublishedAtAttribute keeps the first publish time of a message, in unix milliseconds,
+// across the republishes of its retries, so WithMaxMessageAge measures its whole age.
+const PublishedAtAttribute = "published_at"
+
+// WithMaxMessageAge acks and drops, without handling, messages published longer than d ago,
+// with DispositionExpired. Retries keep the age of the first publish. See WithMaxAgeExemption.
+func WithMaxMessageAge(d time.Duration) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.maxMessageAge = d
+	}
+}
+
+// WithMaxAgeExemption handles the messages for which exempt returns true regardless of their age.
+func WithMaxAgeExemption(exempt func(*pubsub.Message) bool) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.maxAgeExempt = exempt
+	}
+}
+
+// publishedAt returns the first publish time of message.
+func publishedAt(message *pubsub.Message) time.Time {
+	if ms, err := strconv.ParseInt(message.Attributes[PublishedAtAttribute], 10, 64); err == nil {
+		return time.Unix(0, ms*int64(time.Millisecond))
+	}
+
+	return message.PublishTime
+}
+
+func (s *PubSubSubscriber) expired(message *pubsub.Message) bool {
+	if s.maxMessageAge <= 0 || message.PublishTime.IsZero() && message.Attributes[PublishedAtAttribute] == "" {
+		return false
+	}
+
+	if time.Since(publishedAt(message)) <= s.maxMessageAge {
+		return false
+	}
+
+	return s.maxAgeExempt == nil || !s.maxAgeExempt(message)
+}
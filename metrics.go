@@ -0,0 +1,229 @@
+package grok
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// Metrics are recorded with opencensus, so they can be exported to Prometheus or
+// Stackdriver by registering the matching opencensus exporter.
+
+const (
+	metricNameKey = "grok.metric_name"
+	noMetricsKey  = "grok.no_metrics"
+)
+
+var (
+	// KeyRoute ...
+	KeyRoute, _ = tag.NewKey("route")
+	// KeyMethod ...
+	KeyMethod, _ = tag.NewKey("method")
+	// KeyStatus ...
+	KeyStatus, _ = tag.NewKey("status")
+	// KeySubscription ...
+	KeySubscription, _ = tag.NewKey("subscription")
+	// KeyRetries ...
+	KeyRetries, _ = tag.NewKey("retries")
+
+	// HTTPRequestLatency ...
+	HTTPRequestLatency = stats.Float64("grok/http/latency", "HTTP request latency", stats.UnitMilliseconds)
+
+	// HTTPRequestCountView ...
+	HTTPRequestCountView = &view.View{
+		Name:        "grok_http_requests_total",
+		Description: "HTTP requests by route, method and status",
+		Measure:     HTTPRequestLatency,
+		TagKeys:     []tag.Key{KeyRoute, KeyMethod, KeyStatus},
+		Aggregation: view.Count(),
+	}
+
+	// HTTPRequestLatencyView ...
+	HTTPRequestLatencyView = &view.View{
+		Name:        "grok_http_request_latency",
+		Description: "HTTP request latency by route, method and status",
+		Measure:     HTTPRequestLatency,
+		TagKeys:     []tag.Key{KeyRoute, KeyMethod, KeyStatus},
+		Aggregation: view.Distribution(5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000),
+	}
+
+	// HTTPInflightRequests ...
+	HTTPInflightRequests = stats.Int64("grok/http/inflight", "HTTP requests in flight", stats.UnitDimensionless)
+
+	// HTTPInflightRequestsView ...
+	HTTPInflightRequestsView = &view.View{
+		Name:        "grok_http_inflight_requests",
+		Description: "HTTP requests in flight",
+		Measure:     HTTPInflightRequests,
+		Aggregation: view.LastValue(),
+	}
+
+	// HTTPViews ...
+	HTTPViews = []*view.View{HTTPRequestCountView, HTTPRequestLatencyView, HTTPInflightRequestsView}
+
+	// RecoveredMessages counts messages acked after one or more retries.
+	RecoveredMessages = stats.Int64("grok/subscriber/recovered", "Messages succeeded after retries", stats.UnitDimensionless)
+
+	// RecoveredMessagesView ...
+	RecoveredMessagesView = &view.View{
+		Name:        "grok_subscriber_recovered_total",
+		Description: "Messages succeeded after retries by subscription and retries bucket",
+		Measure:     RecoveredMessages,
+		TagKeys:     []tag.Key{KeySubscription, KeyRetries},
+		Aggregation: view.Count(),
+	}
+
+	// SubscriberPaused is 1 while the subscriber is paused.
+	SubscriberPaused = stats.Int64("grok/subscriber/paused", "Whether the subscriber is paused", stats.UnitDimensionless)
+
+	// SubscriberPausedView ...
+	SubscriberPausedView = &view.View{
+		Name:        "grok_subscriber_paused",
+		Description: "Whether the subscriber is paused by subscription",
+		Measure:     SubscriberPaused,
+		TagKeys:     []tag.Key{KeySubscription},
+		Aggregation: view.LastValue(),
+	}
+
+	// LateAcks counts acks sent after the message lease could no longer be extended,
+	// which are likely ignored by the server and followed by a redelivery.
+	LateAcks = stats.Int64("grok/subscriber/late_acks", "Acks sent after the max extension", stats.UnitDimensionless)
+
+	// LateAcksView ...
+	LateAcksView = &view.View{
+		Name:        "grok_subscriber_late_acks_total",
+		Description: "Acks sent after the max extension by subscription",
+		Measure:     LateAcks,
+		TagKeys:     []tag.Key{KeySubscription},
+		Aggregation: view.Count(),
+	}
+
+	// ExpiredMessages counts messages dropped by WithMaxMessageAge.
+	ExpiredMessages = stats.Int64("grok/subscriber/expired", "Messages older than the max age", stats.UnitDimensionless)
+
+	// ExpiredMessagesView ...
+	ExpiredMessagesView = &view.View{
+		Name:        "grok_subscriber_expired_total",
+		Description: "Messages older than the max age by subscription",
+		Measure:     ExpiredMessages,
+		TagKeys:     []tag.Key{KeySubscription},
+		Aggregation: view.Count(),
+	}
+
+	// SubscriberViews are registered by WithSubscriberMetrics.
+	SubscriberViews = []*view.View{RecoveredMessagesView, SubscriberPausedView, LateAcksView, ExpiredMessagesView}
+)
+
+func retriesBucket(retries int) string {
+	switch {
+	case retries <= 2:
+		return strconv.Itoa(retries)
+	case retries <= 5:
+		return "3-5"
+	case retries <= 10:
+		return "6-10"
+	default:
+		return "10+"
+	}
+}
+
+var subscriberViewsOnce sync.Once
+
+// WithSubscriberMetrics records the subscriber metrics and registers SubscriberViews, once
+// per process. Without it nothing is recorded, so processing messages does not allocate
+// for metrics.
+func WithSubscriberMetrics() PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.metrics = true
+
+		subscriberViewsOnce.Do(func() {
+			if err := view.Register(SubscriberViews...); err != nil {
+				logrus.WithError(err).Error("error registering subscriber views")
+			}
+		})
+	}
+}
+
+func (s *PubSubSubscriber) record(ctx context.Context, m stats.Measurement, mutators ...tag.Mutator) {
+	if !s.metrics {
+		return
+	}
+
+	mutators = append(mutators, tag.Upsert(KeySubscription, s.subscriberID))
+
+	if ctx, err := tag.New(ctx, mutators...); err == nil {
+		stats.Record(ctx, m)
+	}
+}
+
+// WithMetrics records request metrics, labelled by route template unless the route
+// is annotated with MetricName or NoMetrics.
+func WithMetrics() APIOption {
+	return func(server *API) {
+		server.metrics = true
+	}
+}
+
+// MetricsMiddleware ...
+func MetricsMiddleware() gin.HandlerFunc {
+	if err := view.Register(HTTPViews...); err != nil {
+		logrus.WithError(err).Error("error registering http views")
+	}
+
+	return func(c *gin.Context) {
+		started := time.Now()
+
+		c.Next()
+
+		if c.GetBool(noMetricsKey) {
+			return
+		}
+
+		route := c.GetString(metricNameKey)
+
+		if route == "" {
+			route = c.FullPath()
+		}
+
+		if route == "" {
+			route = "unmatched"
+		}
+
+		ctx, err := tag.New(c.Request.Context(),
+			tag.Upsert(KeyRoute, route),
+			tag.Upsert(KeyMethod, c.Request.Method),
+			tag.Upsert(KeyStatus, strconv.Itoa(c.Writer.Status())),
+		)
+
+		if err != nil {
+			return
+		}
+
+		stats.Record(ctx, HTTPRequestLatency.M(float64(time.Since(started))/float64(time.Millisecond)))
+	}
+}
+
+// MetricName labels the route with name instead of its path template.
+//
+//	r.GET("/items/:id", grok.MetricName("get_item"), handler)
+func MetricName(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(metricNameKey, name)
+		c.Next()
+	}
+}
+
+// NoMetrics excludes the route from metrics, e.g. high cardinality routes.
+func NoMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(noMetricsKey, true)
+		c.Next()
+	}
+}
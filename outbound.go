@@ -0,0 +1,38 @@
+package grok
+
+import (
+	"context"
+	"fmt"
+)
+
+// OutboundMessage is a follow-up message returned by a ResultHandler.
+type OutboundMessage struct {
+	TopicID    string
+	Body       interface{}
+	Attributes map[string]string
+}
+
+// ResultHandler handles a message returning the follow-up messages to publish.
+type ResultHandler func(ctx context.Context, delivery *Delivery) ([]OutboundMessage, error)
+
+// WithResultHandler handles messages with h, publishing the returned messages with the
+// subscriber producer in order. The message is acked only after all of them are published;
+// when h or a publish fails the message is retried, publishing all of them again, so this
+// is at least once like Delivery.Publisher.
+func WithResultHandler(h ResultHandler) PubSubSubscriberOption {
+	return WithMessageHandler(func(ctx context.Context, delivery *Delivery) error {
+		messages, err := h(ctx, delivery)
+
+		if err != nil {
+			return err
+		}
+
+		for i, message := range messages {
+			if err := delivery.Publisher.PublishWihAttribrutes(message.TopicID, message.Body, message.Attributes); err != nil {
+				return fmt.Errorf("publishing outbound message %d of %d to %s: %w", i+1, len(messages), message.TopicID, err)
+			}
+		}
+
+		return nil
+	})
+}
@@ -1,7 +1,185 @@
 package grok
 
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultPageLimit is the limit used by Paginate when the limit param is missing,
+	// unless WithDefaultPageLimit is given.
+	DefaultPageLimit int64 = 20
+	// MaxPageLimit is the greatest limit accepted by Paginate, unless WithMaxPageLimit is given.
+	MaxPageLimit int64 = 100
+)
+
+// PaginateOption ...
+type PaginateOption func(*paginateLimits)
+
+type paginateLimits struct {
+	limit    int64
+	maxLimit int64
+}
+
+// WithDefaultPageLimit sets the limit used when the limit param is missing,
+// capped by the max page limit.
+func WithDefaultPageLimit(limit int64) PaginateOption {
+	return func(l *paginateLimits) {
+		l.limit = limit
+	}
+}
+
+// WithMaxPageLimit sets the greatest limit accepted.
+func WithMaxPageLimit(limit int64) PaginateOption {
+	return func(l *paginateLimits) {
+		l.maxLimit = limit
+	}
+}
+
 // PaginationResult ...
 type PaginationResult struct {
-	Total int64 `json:"total"`
-	Pages int64 `json:"pages"`
+	Total  int64  `json:"total"`
+	Pages  int64  `json:"pages"`
+	Limit  int64  `json:"limit,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+	Next   string `json:"next,omitempty"`
+	Prev   string `json:"prev,omitempty"`
+}
+
+// PaginatedResult is the body written by PaginatedResponse.
+type PaginatedResult struct {
+	Items      interface{}      `json:"items"`
+	Pagination PaginationResult `json:"pagination"`
+}
+
+// SortField is a field of the sort param, descending when prefixed by "-".
+type SortField struct {
+	Field      string
+	Descending bool
+}
+
+// Pagination is the page requested by the limit, offset or cursor and sort params.
+type Pagination struct {
+	Limit  int64
+	Offset int64
+	Cursor string
+	Sort   []SortField
+
+	// NextCursor is set by cursor paginated handlers before PaginatedResponse
+	// to link the next page.
+	NextCursor string
+}
+
+// Paginate parses the limit, offset, cursor and sort params, e.g.
+// ?limit=10&offset=20&sort=-created_at,name. Limit defaults to DefaultPageLimit and
+// cannot exceed MaxPageLimit, unless set by opts. Offset and cursor cannot be used together.
+// When it fails the error response is already written and the error is returned.
+func Paginate(c *gin.Context, opts ...PaginateOption) (Pagination, error) {
+	limits := paginateLimits{limit: DefaultPageLimit, maxLimit: MaxPageLimit}
+
+	for _, opt := range opts {
+		opt(&limits)
+	}
+
+	if limits.limit > limits.maxLimit {
+		limits.limit = limits.maxLimit
+	}
+
+	pagination := Pagination{Limit: limits.limit, Cursor: c.Query("cursor")}
+
+	fail := func(message string) (Pagination, error) {
+		err := NewError(http.StatusBadRequest, message)
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, err)
+		return Pagination{}, err
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.ParseInt(limit, 10, 64)
+
+		if err != nil || n < 1 || n > limits.maxLimit {
+			return fail(fmt.Sprintf("limit must be between 1 and %d", limits.maxLimit))
+		}
+
+		pagination.Limit = n
+	}
+
+	if offset := c.Query("offset"); offset != "" {
+		n, err := strconv.ParseInt(offset, 10, 64)
+
+		if err != nil || n < 0 {
+			return fail("offset must be a positive number")
+		}
+
+		if pagination.Cursor != "" {
+			return fail("offset and cursor cannot be used together")
+		}
+
+		pagination.Offset = n
+	}
+
+	if sort := c.Query("sort"); sort != "" {
+		for _, field := range strings.Split(sort, ",") {
+			descending := strings.HasPrefix(field, "-")
+			field = strings.TrimPrefix(field, "-")
+
+			if field == "" {
+				return fail("invalid sort " + sort)
+			}
+
+			pagination.Sort = append(pagination.Sort, SortField{Field: field, Descending: descending})
+		}
+	}
+
+	return pagination, nil
+}
+
+// PaginatedResponse writes items and the pagination result, linking the next and previous
+// pages of offset pagination, or the next page of cursor pagination when NextCursor is set.
+func PaginatedResponse(c *gin.Context, items interface{}, total int64, pagination Pagination) {
+	result := PaginationResult{
+		Total:  total,
+		Limit:  pagination.Limit,
+		Offset: pagination.Offset,
+	}
+
+	if pagination.Limit > 0 {
+		result.Pages = (total + pagination.Limit - 1) / pagination.Limit
+	}
+
+	switch {
+	case pagination.Cursor != "" || pagination.NextCursor != "":
+		if pagination.NextCursor != "" {
+			result.Next = pageLink(c, "cursor", pagination.NextCursor)
+		}
+	default:
+		if pagination.Offset+pagination.Limit < total {
+			result.Next = pageLink(c, "offset", strconv.FormatInt(pagination.Offset+pagination.Limit, 10))
+		}
+
+		if pagination.Offset > 0 {
+			prev := pagination.Offset - pagination.Limit
+
+			if prev < 0 {
+				prev = 0
+			}
+
+			result.Prev = pageLink(c, "offset", strconv.FormatInt(prev, 10))
+		}
+	}
+
+	c.JSON(http.StatusOK, PaginatedResult{Items: items, Pagination: result})
+}
+
+func pageLink(c *gin.Context, key, value string) string {
+	link := *c.Request.URL
+	query := link.Query()
+	query.Set(key, value)
+	link.RawQuery = query.Encode()
+
+	return link.RequestURI()
 }
@@ -0,0 +1,34 @@
+package grok
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PermissionError is a permission denied error from Pub/Sub, naming the resource and
+// the role the service account likely lacks.
+type PermissionError struct {
+	Resource string
+	Role     string
+	Err      error
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("permission denied on %s, grant the service account %s: %v", e.Resource, e.Role, e.Err)
+}
+
+// Unwrap ...
+func (e *PermissionError) Unwrap() error {
+	return e.Err
+}
+
+// permissionError wraps err in a PermissionError when it is a permission denied error.
+func permissionError(err error, resource, role string) error {
+	if status.Code(err) != codes.PermissionDenied {
+		return err
+	}
+
+	return &PermissionError{Resource: resource, Role: role, Err: err}
+}
@@ -0,0 +1,26 @@
+package grok
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPermissionError(t *testing.T) {
+	denied := status.Error(codes.PermissionDenied, "User not authorized to perform this action.")
+
+	err := permissionError(denied, "projects/p/subscriptions/s", "roles/pubsub.subscriber")
+
+	var permission *PermissionError
+	assert.True(t, errors.As(err, &permission))
+	assert.Equal(t, "projects/p/subscriptions/s", permission.Resource)
+	assert.Contains(t, err.Error(), "roles/pubsub.subscriber")
+	assert.Equal(t, codes.PermissionDenied, status.Code(errors.Unwrap(err)))
+	assert.False(t, isRetryable(denied))
+
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	assert.Equal(t, unavailable, permissionError(unavailable, "projects/p/subscriptions/s", "roles/pubsub.subscriber"))
+}
@@ -0,0 +1,52 @@
+package grok
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// PreStopHook runs when the service is stopping, before the HTTP listener is closed,
+// e.g. to deregister from service discovery or fail the readiness check.
+type PreStopHook func(ctx context.Context) error
+
+// WithPreStopHook adds a hook run, in the order added, before the HTTP server shuts down.
+// Hook errors are logged and do not stop the shutdown.
+func WithPreStopHook(hook PreStopHook) APIOption {
+	return func(server *API) {
+		server.preStopHooks = append(server.preStopHooks, hook)
+	}
+}
+
+// WithPreStopDelay waits d after the pre-stop hooks and before the HTTP server shuts down,
+// giving load balancers time to stop routing requests to this instance.
+func WithPreStopDelay(d time.Duration) APIOption {
+	return func(server *API) {
+		server.preStopDelay = d
+	}
+}
+
+func (server *API) preStop(ctx context.Context) {
+	if len(server.preStopHooks) > 0 {
+		logrus.Infof("running %d pre-stop hooks", len(server.preStopHooks))
+	}
+
+	for i, hook := range server.preStopHooks {
+		if err := hook(ctx); err != nil {
+			logrus.WithError(err).Errorf("pre-stop hook %d failed", i)
+		}
+	}
+
+	if server.preStopDelay <= 0 {
+		return
+	}
+
+	logrus.Infof("waiting %s before shutting down", server.preStopDelay)
+
+	select {
+	case <-time.After(server.preStopDelay):
+	case <-ctx.Done():
+		logrus.Warn("pre-stop delay interrupted")
+	}
+}
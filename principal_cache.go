@@ -0,0 +1,63 @@
+package grok
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// PrincipalCache caches the claims of validated tokens, keyed by a hash of the token.
+type PrincipalCache struct {
+	cache *cache.Cache
+	ttl   time.Duration
+}
+
+type principalEntry struct {
+	claims map[string]interface{}
+}
+
+// NewPrincipalCache stores principals in c for ttl, or until the token expires when sooner.
+// A zero ttl caches principals until the token expires.
+func NewPrincipalCache(c *cache.Cache, ttl time.Duration) *PrincipalCache {
+	return &PrincipalCache{cache: c, ttl: ttl}
+}
+
+// GetPrincipal ...
+func (p *PrincipalCache) GetPrincipal(token string) (map[string]interface{}, bool) {
+	value, found := p.cache.Get(principalKey(token))
+
+	if !found {
+		return nil, false
+	}
+
+	entry, ok := value.(principalEntry)
+
+	if !ok {
+		return nil, false
+	}
+
+	return entry.claims, true
+}
+
+// SetPrincipal caches claims until expiresAt, bounded by the cache ttl.
+// Tokens already expired are not cached.
+func (p *PrincipalCache) SetPrincipal(token string, claims map[string]interface{}, expiresAt time.Time) {
+	ttl := time.Until(expiresAt)
+
+	if p.ttl > 0 && p.ttl < ttl {
+		ttl = p.ttl
+	}
+
+	if ttl <= 0 {
+		return
+	}
+
+	p.cache.Set(principalKey(token), principalEntry{claims: claims}, ttl)
+}
+
+func principalKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "grok.principal:" + hex.EncodeToString(sum[:])
+}
@@ -3,19 +3,141 @@ package grok
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/pubsub"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/monitoring/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// topicNamePattern matches fully qualified topic names, published to in their own
+// project instead of the client's.
+var topicNamePattern = regexp.MustCompile(`^projects/([^/]+)/topics/([^/]+)$`)
+
+var (
+	// ErrPublishTimeout ...
+	ErrPublishTimeout = errors.New("publish timeout")
+	// ErrFlowControlLimit ...
+	ErrFlowControlLimit = errors.New("publish flow control limit exceeded")
+)
+
+// LimitExceededBehavior is what the producer does when WithFlowControl's limit is reached.
+type LimitExceededBehavior int
+
+const (
+	// FlowControlIgnore does not limit publishes, messages queue in the client buffer.
+	FlowControlIgnore LimitExceededBehavior = iota
+	// FlowControlSignalError fails publishes with ErrFlowControlLimit while saturated.
+	FlowControlSignalError
+	// FlowControlBlock waits for capacity until the publish context is done,
+	// failing with ErrPublishTimeout.
+	FlowControlBlock
 )
 
 // PubSubProducer ...
 type PubSubProducer struct {
-	client *pubsub.Client
+	client   *pubsub.Client
+	timeout  time.Duration
+	settings *pubsub.PublishSettings
+	retryer  func() gax.Retryer
+
+	propagateTrace bool
+	compression    Compression
+	encrypt        EncryptFunc
+	extractor      AttributeExtractor
+	resourcePrefix string
+
+	inflight chan struct{}
+	behavior LimitExceededBehavior
+
+	mu     sync.Mutex
+	topics map[string]*pubsub.Topic
+
+	monitoring *monitoring.Service
+	depthsMu   sync.Mutex
+	depths     map[string]dlqDepth
+
+	metadata map[string]string
+
+	closer     closer
+	closing    chan struct{}
+	ownsClient bool
 }
 
+// PubSubProducerOption ...
+type PubSubProducerOption func(*PubSubProducer)
+
 // NewPubSubProducer ...
-func NewPubSubProducer(client *pubsub.Client) *PubSubProducer {
-	return &PubSubProducer{client: client}
+func NewPubSubProducer(client *pubsub.Client, opts ...PubSubProducerOption) *PubSubProducer {
+	producer := &PubSubProducer{client: client, closing: make(chan struct{})}
+	producer.topics = make(map[string]*pubsub.Topic)
+	producer.depths = make(map[string]dlqDepth)
+
+	for _, opt := range opts {
+		opt(producer)
+	}
+
+	return producer
+}
+
+// WithPublishTimeout bounds how long a publish waits for the server, returning ErrPublishTimeout.
+func WithPublishTimeout(d time.Duration) PubSubProducerOption {
+	return func(p *PubSubProducer) {
+		p.timeout = d
+	}
+}
+
+// WithPublishSettings sets the settings of every topic published by the producer.
+func WithPublishSettings(settings pubsub.PublishSettings) PubSubProducerOption {
+	return func(p *PubSubProducer) {
+		p.settings = &settings
+	}
+}
+
+// WithPublishRetry retries publishes failing with transient errors up to attempts times,
+// doubling backoff between attempts up to a minute.
+func WithPublishRetry(attempts int, backoff time.Duration) PubSubProducerOption {
+	return WithPublishRetryer(func() gax.Retryer {
+		return &limitedRetryer{
+			retryer:  gax.OnCodes(retryableCodes, gax.Backoff{Initial: backoff, Max: time.Minute, Multiplier: 2}),
+			attempts: attempts,
+		}
+	})
+}
+
+// WithPublishRetryer retries failed publishes as told by the gax retryer, created once per publish.
+func WithPublishRetryer(retryer func() gax.Retryer) PubSubProducerOption {
+	return func(p *PubSubProducer) {
+		p.retryer = retryer
+	}
+}
+
+// WithFlowControl limits the producer to maxOutstanding in-flight publishes,
+// applying behavior when the limit is reached. A maxOutstanding of zero or less
+// does not limit publishes.
+func WithFlowControl(maxOutstanding int, behavior LimitExceededBehavior) PubSubProducerOption {
+	return func(p *PubSubProducer) {
+		p.inflight = nil
+		p.behavior = behavior
+
+		if maxOutstanding > 0 {
+			p.inflight = make(chan struct{}, maxOutstanding)
+		}
+	}
+}
+
+// WithProducerResourcePrefix prefixes the id of every topic published to, matching
+// the subscribers WithResourcePrefix.
+func WithProducerResourcePrefix(prefix string) PubSubProducerOption {
+	return func(p *PubSubProducer) {
+		p.resourcePrefix = prefix
+	}
 }
 
 // Publish ...
@@ -25,36 +147,344 @@ func (p *PubSubProducer) Publish(topicID string, data interface{}) error {
 
 // PublishWihAttribrutes ...
 func (p *PubSubProducer) PublishWihAttribrutes(topicID string, data interface{}, attributes map[string]string) error {
+	return p.PublishContext(context.Background(), topicID, data, attributes)
+}
+
+// PublishContext publishes propagating the tenant of ctx, and its trace when
+// WithTracePropagation is set.
+func (p *PubSubProducer) PublishContext(ctx context.Context, topicID string, data interface{}, attributes map[string]string) error {
+	return p.publishContext(ctx, p.behavior, topicID, data, attributes)
+}
+
+// PublishBlocking publishes waiting for flow control capacity regardless of the
+// configured behavior, failing with ErrPublishTimeout when ctx is done first.
+func (p *PubSubProducer) PublishBlocking(ctx context.Context, topicID string, data interface{}, attributes map[string]string) error {
+	return p.publishContext(ctx, FlowControlBlock, topicID, data, attributes)
+}
+
+func (p *PubSubProducer) publishContext(ctx context.Context, behavior LimitExceededBehavior, topicID string, data interface{}, attributes map[string]string) error {
+	release, err := p.acquire(ctx, behavior)
+
+	if err != nil {
+		return err
+	}
+
+	defer release()
+
 	body, err := json.Marshal(data)
 
 	if err != nil {
 		return err
 	}
 
-	topic, err := createTopicIfNotExists(p.client, topicID)
+	return p.publishData(ctx, topicID, body, p.attributes(ctx, data, attributes))
+}
+
+// attributes adds the extracted attributes, the tenant of ctx and its trace when
+// WithTracePropagation is set.
+func (p *PubSubProducer) attributes(ctx context.Context, data interface{}, attributes map[string]string) map[string]string {
+	attributes = p.extractAttributes(data, attributes)
+
+	if p.propagateTrace {
+		attributes = injectCloudTrace(ctx, attributes)
+	}
+
+	return injectTenant(ctx, attributes)
+}
+
+// publishData publishes an already marshaled body.
+func (p *PubSubProducer) publishData(ctx context.Context, topicID string, body []byte, attributes map[string]string) error {
+	body, attributes, err := p.encode(ctx, body, attributes)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = topic.
-		Publish(context.Background(), &pubsub.Message{
-			Data:        body,
-			PublishTime: time.Now(),
-			Attributes:  attributes,
-		}).
-		Get(context.Background())
+	return p.publishRaw(ctx, topicID, body, attributes)
+}
+
+// PublishRaw publishes data as is, without marshaling nor compressing it.
+func (p *PubSubProducer) PublishRaw(topicID string, data []byte, attributes map[string]string) error {
+	return p.publishRaw(context.Background(), topicID, data, attributes)
+}
+
+func (p *PubSubProducer) publishRaw(ctx context.Context, topicID string, data []byte, attributes map[string]string) error {
+	topic, err := p.topic(p.prefixed(topicID))
+
+	if err != nil {
+		return err
+	}
+
+	_, err = p.await(ctx, topic, data, attributes, p.send(topic, data, attributes))
 
 	return err
 }
 
-func createTopicIfNotExists(client *pubsub.Client, id string) (*pubsub.Topic, error) {
+// await waits for the server id of result, publishing again while the retryer allows it.
+// It stops retrying, returning the last error, when ctx is done or the producer is closed
+// during the backoff.
+func (p *PubSubProducer) await(ctx context.Context, topic *pubsub.Topic, body []byte, attributes map[string]string, result *pubsub.PublishResult) (string, error) {
+	id, err := p.result(topic, result)
+
+	if err == nil || p.retryer == nil {
+		return id, err
+	}
+
+	retryer := p.retryer()
+
+	for {
+		pause, retry := retryer.Retry(err)
+
+		if !retry {
+			return "", err
+		}
+
+		if !p.pause(ctx, pause) {
+			return "", err
+		}
+
+		if id, err = p.result(topic, p.send(topic, body, attributes)); err == nil {
+			return id, nil
+		}
+	}
+}
+
+// pause waits for d, returning false when ctx is done or the producer is closed first.
+func (p *PubSubProducer) pause(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-p.closing:
+		return false
+	}
+}
+
+// limitedRetryer stops retrying after attempts retries.
+type limitedRetryer struct {
+	retryer  gax.Retryer
+	attempts int
+}
+
+func (r *limitedRetryer) Retry(err error) (time.Duration, bool) {
+	pause, retry := r.retryer.Retry(err)
+
+	if !retry || r.attempts <= 0 {
+		return 0, false
+	}
+
+	r.attempts--
+
+	return pause, true
+}
+
+func (p *PubSubProducer) acquire(ctx context.Context, behavior LimitExceededBehavior) (func(), error) {
+	if p.inflight == nil {
+		return func() {}, nil
+	}
+
+	release := func() { <-p.inflight }
+
+	switch behavior {
+	case FlowControlSignalError:
+		select {
+		case p.inflight <- struct{}{}:
+			return release, nil
+		default:
+			return nil, ErrFlowControlLimit
+		}
+	case FlowControlBlock:
+		select {
+		case p.inflight <- struct{}{}:
+			return release, nil
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: waiting for flow control capacity: %v", ErrPublishTimeout, ctx.Err())
+		}
+	default:
+		return func() {}, nil
+	}
+}
+
+// PublishAsync publishes without waiting for the server. onResult is called exactly
+// once, from its own goroutine, with the server assigned id or the error.
+func (p *PubSubProducer) PublishAsync(topicID string, data interface{}, attributes map[string]string, onResult func(id string, err error)) {
+	p.PublishAsyncContext(context.Background(), topicID, data, attributes, onResult)
+}
+
+// PublishAsyncContext is PublishAsync propagating the tenant and trace of ctx as
+// PublishContext does. It waits for flow control capacity as the configured behavior,
+// the capacity being released once the publish resolves, before onResult is called.
+func (p *PubSubProducer) PublishAsyncContext(ctx context.Context, topicID string, data interface{}, attributes map[string]string, onResult func(id string, err error)) {
+	release, err := p.acquire(ctx, p.behavior)
+
+	if err != nil {
+		go onResult("", err)
+		return
+	}
+
+	topic, body, attributes, err := p.prepare(ctx, topicID, data, p.attributes(ctx, data, attributes))
+
+	if err != nil {
+		release()
+		go onResult("", err)
+		return
+	}
+
+	result := p.send(topic, body, attributes)
+
+	go func() {
+		id, err := p.await(ctx, topic, body, attributes, result)
+		release()
+		onResult(id, err)
+	}()
+}
+
+func (p *PubSubProducer) prepare(ctx context.Context, topicID string, data interface{}, attributes map[string]string) (*pubsub.Topic, []byte, map[string]string, error) {
+	body, err := json.Marshal(data)
+
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	body, attributes, err = p.encode(ctx, body, attributes)
+
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	topic, err := p.topic(p.prefixed(topicID))
+
+	return topic, body, attributes, err
+}
+
+// encode compresses the body when WithCompression is set, then encrypts it when
+// WithEncryption is set.
+func (p *PubSubProducer) encode(ctx context.Context, body []byte, attributes map[string]string) ([]byte, map[string]string, error) {
+	if p.compression == "" && p.encrypt == nil {
+		return body, attributes, nil
+	}
+
+	encoded := make(map[string]string)
+
+	for k, v := range attributes {
+		encoded[k] = v
+	}
+
+	if p.compression != "" {
+		compressed, err := compress(p.compression, body)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		body = compressed
+		encoded[ContentEncodingAttribute] = string(p.compression)
+	}
+
+	if p.encrypt != nil {
+		sealed, err := p.encrypt(ctx, body)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		body = sealed
+		encoded[EncryptedAttribute] = "true"
+	}
+
+	return body, encoded, nil
+}
+
+func (p *PubSubProducer) send(topic *pubsub.Topic, body []byte, attributes map[string]string) *pubsub.PublishResult {
+	return topic.Publish(context.Background(), &pubsub.Message{
+		Data:        body,
+		PublishTime: time.Now(),
+		Attributes:  p.withMetadata(attributes),
+	})
+}
+
+// result waits for the server id, failing with ErrPublishTimeout after the publish timeout.
+func (p *PubSubProducer) result(topic *pubsub.Topic, result *pubsub.PublishResult) (string, error) {
+	ctx := context.Background()
+
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	id, err := result.Get(ctx)
+
+	if err == context.DeadlineExceeded || status.Code(err) == codes.DeadlineExceeded {
+		return "", fmt.Errorf("%w: topic %s after %s", ErrPublishTimeout, topic.ID(), p.timeout)
+	}
+
+	return id, err
+}
+
+func (p *PubSubProducer) topic(topicID string) (*pubsub.Topic, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if topic, ok := p.topics[topicID]; ok {
+		return topic, nil
+	}
+
+	topic, err := p.createTopic(topicID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.settings != nil {
+		topic.PublishSettings = *p.settings
+	}
+
+	if p.timeout > 0 {
+		topic.PublishSettings.Timeout = p.timeout
+	}
+
+	p.topics[topicID] = topic
+
+	return topic, nil
+}
+
+// prefixed applies the resource prefix to the id of topicID, a topic id or name.
+func (p *PubSubProducer) prefixed(topicID string) string {
+	if match := topicNamePattern.FindStringSubmatch(topicID); match != nil {
+		return fmt.Sprintf("projects/%s/topics/%s", match[1], p.resourcePrefix+match[2])
+	}
+
+	return p.resourcePrefix + topicID
+}
+
+// createTopic creates topicID when it does not exist. Topics of other projects,
+// given by their fully qualified name, are never created.
+func (p *PubSubProducer) createTopic(topicID string) (*pubsub.Topic, error) {
+	if match := topicNamePattern.FindStringSubmatch(topicID); match != nil {
+		return p.client.TopicInProject(match[2], match[1]), nil
+	}
+
+	return createTopicIfNotExists(context.Background(), p.client, topicID)
+}
+
+func createTopicIfNotExists(ctx context.Context, client *pubsub.Client, id string) (*pubsub.Topic, error) {
 	topic := client.Topic(id)
-	exists, _ := topic.Exists(context.Background())
+	exists, _ := topic.Exists(ctx)
 
 	if exists {
 		return topic, nil
 	}
 
-	return client.CreateTopic(context.Background(), id)
+	topic, err := client.CreateTopic(ctx, id)
+
+	if status.Code(err) == codes.AlreadyExists {
+		return client.Topic(id), nil
+	}
+
+	return topic, err
 }
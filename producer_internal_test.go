@@ -0,0 +1,56 @@
+package grok
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPublishRetry(t *testing.T) {
+	producer := NewPubSubProducer(nil, WithPublishRetry(2, time.Millisecond))
+	retryer := producer.retryer()
+
+	_, retry := retryer.Retry(errors.New("invalid message"))
+	assert.False(t, retry)
+
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+
+	pause, retry := retryer.Retry(unavailable)
+	assert.True(t, retry)
+	assert.True(t, pause <= time.Millisecond)
+
+	_, retry = retryer.Retry(unavailable)
+	assert.True(t, retry)
+
+	_, retry = retryer.Retry(unavailable)
+	assert.False(t, retry)
+
+	_, retry = producer.retryer().Retry(status.Error(codes.InvalidArgument, "invalid"))
+	assert.False(t, retry)
+}
+
+func TestFlowControlLimit(t *testing.T) {
+	producer := NewPubSubProducer(nil, WithFlowControl(1, FlowControlSignalError))
+
+	release, err := producer.acquire(context.Background(), producer.behavior)
+	assert.NoError(t, err)
+
+	_, err = producer.acquire(context.Background(), FlowControlSignalError)
+	assert.True(t, errors.Is(err, ErrFlowControlLimit))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = producer.acquire(ctx, FlowControlBlock)
+	assert.True(t, errors.Is(err, ErrPublishTimeout))
+
+	release()
+
+	_, err = producer.acquire(context.Background(), FlowControlSignalError)
+	assert.NoError(t, err)
+}
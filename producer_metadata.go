@@ -0,0 +1,70 @@
+package grok
+
+import (
+	"os"
+	"runtime/debug"
+)
+
+// Producer metadata attributes set by WithProducerMetadata.
+const (
+	ProducerServiceAttribute = "producer_service"
+	ProducerVersionAttribute = "producer_version"
+	ProducerHostAttribute    = "producer_host"
+)
+
+const libraryModule = "github.com/recoli-tech/grok"
+
+// WithProducerMetadata sets the service, version and hostname attributes on every
+// published message, so its origin can be traced, e.g. from the dlq. Attributes
+// given to publish take precedence over them.
+func WithProducerMetadata(service, version string) PubSubProducerOption {
+	return func(p *PubSubProducer) {
+		hostname, _ := os.Hostname()
+
+		p.metadata = map[string]string{
+			ProducerServiceAttribute: service,
+			ProducerVersionAttribute: version,
+			ProducerHostAttribute:    hostname,
+		}
+	}
+}
+
+// withMetadata returns the attributes merged with the producer metadata.
+func (p *PubSubProducer) withMetadata(attributes map[string]string) map[string]string {
+	if len(p.metadata) == 0 {
+		return attributes
+	}
+
+	merged := make(map[string]string, len(attributes)+len(p.metadata))
+
+	for k, v := range p.metadata {
+		merged[k] = v
+	}
+
+	for k, v := range attributes {
+		merged[k] = v
+	}
+
+	return merged
+}
+
+// libraryVersion returns the grok module version built into the binary.
+func libraryVersion() string {
+	info, ok := debug.ReadBuildInfo()
+
+	if !ok {
+		return ""
+	}
+
+	if info.Main.Path == libraryModule {
+		return info.Main.Version
+	}
+
+	for _, dep := range info.Deps {
+		if dep.Path == libraryModule {
+			return dep.Version
+		}
+	}
+
+	return ""
+}
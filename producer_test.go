@@ -1,11 +1,23 @@
 package grok_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"cloud.google.com/go/pubsub"
+	"github.com/googleapis/gax-go/v2"
 	"github.com/recoli-tech/grok"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"google.golang.org/api/monitoring/v3"
+	"google.golang.org/api/option"
 )
 
 type ProducerTestSuite struct {
@@ -32,3 +44,471 @@ func (s *ProducerTestSuite) TestPublish() {
 
 	s.assert.NoError(err)
 }
+
+func (s *ProducerTestSuite) TestPublishWithTimeout() {
+	producer := grok.NewPubSubProducer(
+		grok.FakePubSubClient(s.settings.GCP.PubSub.Endpoint),
+		grok.WithPublishTimeout(5*time.Second),
+		grok.WithPublishRetry(2, 100*time.Millisecond))
+
+	err := producer.Publish("test-topic", map[string]interface{}{"ping": "pong"})
+
+	s.assert.NoError(err)
+}
+
+// pausingRetryer retries every error after pause.
+type pausingRetryer struct {
+	pause time.Duration
+}
+
+func (r pausingRetryer) Retry(err error) (time.Duration, bool) {
+	return r.pause, true
+}
+
+func (s *ProducerTestSuite) TestPublishRetryInterrupted() {
+	newProducer := func() *grok.PubSubProducer {
+		return grok.NewPubSubProducer(
+			grok.FakePubSubClient(s.settings.GCP.PubSub.Endpoint),
+			grok.WithPublishTimeout(time.Nanosecond),
+			grok.WithPublishRetryer(func() gax.Retryer { return pausingRetryer{pause: time.Hour} }))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := newProducer().PublishContext(ctx, "test-topic", map[string]interface{}{"ping": "pong"}, nil)
+	s.assert.True(errors.Is(err, grok.ErrPublishTimeout), err)
+
+	producer := newProducer()
+	time.AfterFunc(100*time.Millisecond, func() { producer.Close(context.Background()) })
+
+	err = producer.PublishRaw("test-topic", []byte(`{"ping":"pong"}`), nil)
+	s.assert.True(errors.Is(err, grok.ErrPublishTimeout), err)
+}
+
+func (s *ProducerTestSuite) TestPublishFlowControl() {
+	for _, limit := range []int{1, 0, -1} {
+		producer := grok.NewPubSubProducer(
+			grok.FakePubSubClient(s.settings.GCP.PubSub.Endpoint),
+			grok.WithFlowControl(limit, grok.FlowControlBlock))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := producer.PublishContext(ctx, "test-topic", map[string]interface{}{"ping": "pong"}, nil)
+		cancel()
+
+		s.assert.NoError(err, limit)
+	}
+}
+
+func (s *ProducerTestSuite) TestPublishAsync() {
+	producer := grok.NewPubSubProducer(
+		grok.FakePubSubClient(s.settings.GCP.PubSub.Endpoint))
+
+	results := make(chan string, 1)
+
+	producer.PublishAsync("test-topic", map[string]interface{}{"ping": "pong"}, nil, func(id string, err error) {
+		s.assert.NoError(err)
+		results <- id
+	})
+
+	s.assert.NotEmpty(<-results)
+}
+
+func (s *ProducerTestSuite) TestPublishAsyncContext() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := grok.FakePubSubClient(s.settings.GCP.PubSub.Endpoint)
+	topicID := fmt.Sprintf("topic-async-%d", time.Now().UnixNano())
+
+	topic, err := client.CreateTopic(ctx, topicID)
+	s.assert.NoError(err)
+
+	subscription, err := client.CreateSubscription(ctx, topicID, pubsub.SubscriptionConfig{Topic: topic})
+	s.assert.NoError(err)
+
+	producer := grok.NewPubSubProducer(client, grok.WithFlowControl(1, grok.FlowControlSignalError))
+	results := make(chan error, 2)
+
+	producer.PublishAsyncContext(grok.ContextWithTenant(ctx, "acme"), topicID, map[string]interface{}{"ping": "pong"}, nil, func(id string, err error) {
+		results <- err
+	})
+
+	producer.PublishAsync(topicID, map[string]interface{}{"ping": "pong"}, nil, func(id string, err error) {
+		results <- err
+	})
+
+	limited := 0
+
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			s.assert.True(errors.Is(err, grok.ErrFlowControlLimit), err)
+			limited++
+		}
+	}
+
+	s.assert.Equal(1, limited)
+
+	received := s.receive(ctx, subscription, 1)
+	s.assert.Len(received, 1)
+	s.assert.Equal("acme", received[0].Attributes[grok.TenantAttribute])
+}
+
+func (s *ProducerTestSuite) TestProducerMetadata() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := grok.FakePubSubClient(s.settings.GCP.PubSub.Endpoint)
+	topicID := fmt.Sprintf("topic-metadata-%d", time.Now().UnixNano())
+
+	topic, err := client.CreateTopic(ctx, topicID)
+	s.assert.NoError(err)
+
+	subscription, err := client.CreateSubscription(ctx, topicID, pubsub.SubscriptionConfig{Topic: topic})
+	s.assert.NoError(err)
+
+	producer := grok.NewPubSubProducer(client, grok.WithProducerMetadata("orders", "1.2.0"))
+
+	err = producer.PublishWihAttribrutes(topicID, map[string]interface{}{"ping": "pong"}, map[string]string{
+		grok.ProducerVersionAttribute: "override",
+	})
+	s.assert.NoError(err)
+
+	attributes := make(chan map[string]string, 1)
+
+	err = subscription.Receive(ctx, func(ctx context.Context, m *pubsub.Message) {
+		m.Ack()
+		attributes <- m.Attributes
+		cancel()
+	})
+	s.assert.NoError(err)
+
+	received := <-attributes
+	s.assert.Equal("orders", received[grok.ProducerServiceAttribute])
+	s.assert.Equal("override", received[grok.ProducerVersionAttribute])
+	s.assert.NotEmpty(received[grok.ProducerHostAttribute])
+}
+
+func (s *ProducerTestSuite) TestNewClientWithEmulator() {
+	client, err := grok.NewClient(context.Background(), "local-project",
+		grok.EmulatorOptions(s.settings.GCP.PubSub.Endpoint)...)
+
+	s.assert.NoError(err)
+	s.assert.NoError(grok.NewPubSubProducer(client).Publish("test-topic", map[string]interface{}{"ping": "pong"}))
+}
+
+func (s *ProducerTestSuite) TestPublishTopicInProject() {
+	central, err := grok.NewClient(context.Background(), "central-project",
+		grok.EmulatorOptions(s.settings.GCP.PubSub.Endpoint)...)
+	s.assert.NoError(err)
+
+	topicID := fmt.Sprintf("topic-central-%d", time.Now().UnixNano())
+	_, err = central.CreateTopic(context.Background(), topicID)
+	s.assert.NoError(err)
+
+	producer := grok.NewPubSubProducer(grok.FakePubSubClient(s.settings.GCP.PubSub.Endpoint))
+
+	s.assert.NoError(producer.PublishRaw("projects/central-project/topics/"+topicID, []byte("ping"), nil))
+	s.assert.Error(producer.PublishRaw("projects/central-project/topics/missing", []byte("ping"), nil))
+}
+
+func (s *ProducerTestSuite) TestAttributeExtractor() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	type order struct {
+		Type   string `json:"type"`
+		Tenant string `json:"tenant"`
+	}
+
+	client := grok.FakePubSubClient(s.settings.GCP.PubSub.Endpoint)
+	topicID := fmt.Sprintf("topic-extractor-%d", time.Now().UnixNano())
+
+	topic, err := client.CreateTopic(ctx, topicID)
+	s.assert.NoError(err)
+
+	subscription, err := client.CreateSubscription(ctx, topicID, pubsub.SubscriptionConfig{Topic: topic})
+	s.assert.NoError(err)
+
+	producer := grok.NewPubSubProducer(client, grok.WithAttributeExtractor(func(body interface{}) map[string]string {
+		o, ok := body.(order)
+
+		if !ok {
+			return nil
+		}
+
+		return map[string]string{"event_type": o.Type, "tenant": o.Tenant}
+	}))
+
+	err = producer.PublishWihAttribrutes(topicID, order{Type: "order.created", Tenant: "acme"}, map[string]string{
+		"tenant": "override",
+	})
+	s.assert.NoError(err)
+
+	attributes := make(chan map[string]string, 1)
+
+	err = subscription.Receive(ctx, func(ctx context.Context, m *pubsub.Message) {
+		m.Ack()
+		attributes <- m.Attributes
+		cancel()
+	})
+	s.assert.NoError(err)
+
+	received := <-attributes
+	s.assert.Equal("order.created", received["event_type"])
+	s.assert.Equal("override", received["tenant"])
+}
+
+func (s *ProducerTestSuite) TestReplayMessage() {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	client := grok.FakePubSubClient(s.settings.GCP.PubSub.Endpoint)
+	producer := grok.NewPubSubProducer(client)
+	dlq, target := s.replayTopics(ctx, client, "replay-message")
+
+	ids := []string{}
+
+	for _, ping := range []string{"first", "second", "third"} {
+		id, err := s.publishDeadLetter(producer, dlq.ID(), ping)
+		s.assert.NoError(err)
+		ids = append(ids, id)
+	}
+
+	s.assert.NoError(producer.ReplayMessage(ctx, dlq.ID(), ids[1], target.ID()))
+
+	replayed := s.receive(ctx, client.Subscription(target.ID()), 1)
+	s.assert.Len(replayed, 1)
+	s.assert.Equal(`{"ping":"second"}`, string(replayed[0].Data))
+	s.assert.NotContains(replayed[0].Attributes, "error")
+
+	left := s.receive(ctx, client.Subscription(dlq.ID()), 2)
+	s.assert.Len(left, 2)
+
+	for _, message := range left {
+		s.assert.NotEqual(ids[1], message.ID)
+	}
+}
+
+func (s *ProducerTestSuite) TestReplayMessageNotFound() {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	client := grok.FakePubSubClient(s.settings.GCP.PubSub.Endpoint)
+	producer := grok.NewPubSubProducer(client)
+	dlq, target := s.replayTopics(ctx, client, "replay-missing")
+
+	_, err := s.publishDeadLetter(producer, dlq.ID(), "first")
+	s.assert.NoError(err)
+
+	replayCtx, replayCancel := context.WithTimeout(ctx, 2*time.Second)
+	defer replayCancel()
+
+	err = producer.ReplayMessage(replayCtx, dlq.ID(), "missing", target.ID())
+	s.assert.True(errors.Is(err, grok.ErrMessageNotFound), err)
+
+	s.assert.Len(s.receive(ctx, client.Subscription(dlq.ID()), 1), 1)
+}
+
+func (s *ProducerTestSuite) TestReplayDLQ() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client := grok.FakePubSubClient(s.settings.GCP.PubSub.Endpoint)
+	producer := grok.NewPubSubProducer(client)
+	dlq, target := s.replayTopics(ctx, client, "replay-dlq")
+
+	for _, ping := range []string{"first", "broken", "third"} {
+		_, err := s.publishDeadLetter(producer, dlq.ID(), ping)
+		s.assert.NoError(err)
+	}
+
+	replayCtx, replayCancel := context.WithTimeout(ctx, 3*time.Second)
+	defer replayCancel()
+
+	report, err := producer.ReplayDLQ(replayCtx, dlq.ID(), target.ID(), func(version string, data []byte) ([]byte, error) {
+		if strings.Contains(string(data), "broken") {
+			return nil, errors.New("cannot migrate")
+		}
+
+		return data, nil
+	})
+	s.assert.NoError(err)
+	s.assert.Equal(2, report.Replayed)
+	s.assert.Len(report.Skipped, 1)
+
+	s.assert.Len(s.receive(ctx, client.Subscription(target.ID()), 2), 2)
+
+	left := s.receive(ctx, client.Subscription(dlq.ID()), 1)
+	s.assert.Len(left, 1)
+	s.assert.Equal(report.Skipped[0].ID, left[0].ID)
+}
+
+func (s *ProducerTestSuite) TestReplayDLQSchemaVersion() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client := grok.FakePubSubClient(s.settings.GCP.PubSub.Endpoint)
+	producer := grok.NewPubSubProducer(client)
+	dlq, target := s.replayTopics(ctx, client, "replay-version")
+
+	s.assert.NoError(producer.PublishWihAttribrutes(dlq.ID(), []byte(`{"name":"a"}`), map[string]string{
+		"error":                     "boom",
+		grok.SchemaVersionAttribute: "v1",
+	}))
+
+	replayCtx, replayCancel := context.WithTimeout(ctx, 3*time.Second)
+	defer replayCancel()
+
+	versions := []string{}
+
+	report, err := producer.ReplayDLQ(replayCtx, dlq.ID(), target.ID(), func(version string, data []byte) ([]byte, error) {
+		versions = append(versions, version)
+		return []byte(strings.Replace(string(data), `"name"`, `"title"`, 1)), nil
+	})
+	s.assert.NoError(err)
+	s.assert.Equal(1, report.Replayed)
+	s.assert.Equal([]string{"v1"}, versions)
+
+	replayed := s.receive(ctx, client.Subscription(target.ID()), 1)
+	s.Require().Len(replayed, 1)
+	s.assert.Equal(`{"title":"a"}`, string(replayed[0].Data))
+	s.assert.NotContains(replayed[0].Attributes, grok.SchemaVersionAttribute)
+}
+
+func (s *ProducerTestSuite) TestDLQMonitor() {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	client := grok.FakePubSubClient(s.settings.GCP.PubSub.Endpoint)
+	producer := grok.NewPubSubProducer(client)
+	dlqTopicID := fmt.Sprintf("monitor-dlq-%d", time.Now().UnixNano())
+
+	alerts := make(chan grok.DeadLetterMessage, 2)
+	monitor := grok.NewDLQMonitor(client, dlqTopicID, func(m grok.DeadLetterMessage) {
+		alerts <- m
+		panic("alert failed")
+	}, time.Hour)
+
+	go monitor.Run(ctx)
+
+	s.assert.Eventually(func() bool {
+		exists, _ := client.Subscription(dlqTopicID + "_monitor").Exists(ctx)
+		return exists
+	}, 10*time.Second, 100*time.Millisecond)
+
+	for _, ping := range []string{"first", "second"} {
+		_, err := s.publishDeadLetter(producer, dlqTopicID, ping)
+		s.assert.NoError(err)
+	}
+
+	select {
+	case alert := <-alerts:
+		s.assert.Equal(dlqTopicID, alert.Topic)
+		s.assert.Equal("boom", alert.Error)
+		s.assert.Contains([]string{`{"ping":"first"}`, `{"ping":"second"}`}, string(alert.Data))
+	case <-ctx.Done():
+		s.Fail("no alert for the dead letter")
+	}
+
+	select {
+	case <-alerts:
+		s.Fail("alert not suppressed within the interval")
+	case <-time.After(time.Second):
+	}
+
+	exists, err := client.Topic(dlqTopicID + "_dlq").Exists(ctx)
+	s.assert.NoError(err)
+	s.assert.False(exists, "failed alert sent to the dlq of the monitor")
+}
+
+func (s *ProducerTestSuite) TestDLQDepth() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filters := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filters = append(filters, r.URL.Query().Get("filter"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"timeSeries":[{"points":[{"value":{"int64Value":"7"}},{"value":{"int64Value":"3"}}]}]}`))
+	}))
+	defer server.Close()
+
+	svc, err := monitoring.NewService(ctx, option.WithEndpoint(server.URL+"/"), option.WithHTTPClient(server.Client()))
+	s.Require().NoError(err)
+
+	client := grok.FakePubSubClient(s.settings.GCP.PubSub.Endpoint)
+	producer := grok.NewPubSubProducer(client, grok.WithMonitoringService(svc))
+	dlq, _ := s.replayTopics(ctx, client, "depth")
+
+	depth, err := producer.DLQDepth(ctx, dlq.ID())
+	s.assert.NoError(err)
+	s.assert.Equal(int64(7), depth)
+
+	depth, err = producer.DLQDepth(ctx, dlq.ID())
+	s.assert.NoError(err)
+	s.assert.Equal(int64(7), depth)
+
+	s.assert.Len(filters, 1)
+	s.assert.Contains(filters[0], fmt.Sprintf(`resource.labels.subscription_id = "%s"`, dlq.ID()))
+
+	_, err = producer.DLQDepth(ctx, "depth-missing")
+	s.assert.True(errors.Is(err, grok.ErrDLQSubscriptionNotFound), err)
+}
+
+func (s *ProducerTestSuite) replayTopics(ctx context.Context, client *pubsub.Client, name string) (*pubsub.Topic, *pubsub.Topic) {
+	topics := []*pubsub.Topic{}
+
+	for _, suffix := range []string{"dlq", "target"} {
+		topicID := fmt.Sprintf("%s-%s-%d", name, suffix, time.Now().UnixNano())
+
+		topic, err := client.CreateTopic(ctx, topicID)
+		s.Require().NoError(err)
+
+		_, err = client.CreateSubscription(ctx, topicID, pubsub.SubscriptionConfig{Topic: topic})
+		s.Require().NoError(err)
+
+		topics = append(topics, topic)
+	}
+
+	return topics[0], topics[1]
+}
+
+// publishDeadLetter publishes to the dlq as the subscriber does, returning the message id.
+func (s *ProducerTestSuite) publishDeadLetter(producer *grok.PubSubProducer, dlq, ping string) (string, error) {
+	results := make(chan error, 1)
+
+	var messageID string
+
+	producer.PublishAsync(dlq, []byte(fmt.Sprintf(`{"ping":"%s"}`, ping)), map[string]string{"error": "boom"}, func(id string, err error) {
+		messageID = id
+		results <- err
+	})
+
+	return messageID, <-results
+}
+
+// receive acks up to count messages from subscription.
+func (s *ProducerTestSuite) receive(ctx context.Context, subscription *pubsub.Subscription, count int) []*pubsub.Message {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+
+	messages := []*pubsub.Message{}
+
+	subscription.Receive(ctx, func(ctx context.Context, m *pubsub.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		m.Ack()
+		messages = append(messages, m)
+
+		if len(messages) == count {
+			cancel()
+		}
+	})
+
+	return messages
+}
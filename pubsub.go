@@ -5,8 +5,35 @@ import (
 
 	"cloud.google.com/go/pubsub"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
 )
 
+// ClientOption configures the client created by NewClient, e.g. option.WithEndpoint.
+type ClientOption = option.ClientOption
+
+// NewClient creates a pubsub client for projectID. Unlike PUBSUB_EMULATOR_HOST, an
+// emulator set through EmulatorOptions only affects this client, so other tools of
+// the process keep using the real services. For local development start an emulator,
+//
+//	gcloud beta emulators pubsub start --host-port=localhost:8085
+//
+// and create the client with
+//
+//	client, err := grok.NewClient(ctx, "local-project", grok.EmulatorOptions("localhost:8085")...)
+func NewClient(ctx context.Context, projectID string, opts ...ClientOption) (*pubsub.Client, error) {
+	return pubsub.NewClient(ctx, projectID, opts...)
+}
+
+// EmulatorOptions connects to the emulator at endpoint, without TLS nor authentication.
+func EmulatorOptions(endpoint string) []ClientOption {
+	return []ClientOption{
+		option.WithEndpoint(endpoint),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithInsecure()),
+	}
+}
+
 // CreatePubSubClient ...
 func CreatePubSubClient(settings *GCPSettings) *pubsub.Client {
 	switch {
@@ -0,0 +1,164 @@
+package grok
+
+import (
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/auth0-community/go-auth0"
+	"github.com/gin-gonic/gin"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+const (
+	// GoogleJWKS serves the keys signing the OIDC tokens of push requests.
+	GoogleJWKS = "https://www.googleapis.com/oauth2/v3/certs"
+	// GoogleIssuer is the issuer of the OIDC tokens of push requests.
+	GoogleIssuer = "https://accounts.google.com"
+)
+
+// PushRequest is the body of a push subscription request.
+type PushRequest struct {
+	Message struct {
+		ID          string            `json:"messageId"`
+		Data        []byte            `json:"data"`
+		Attributes  map[string]string `json:"attributes"`
+		PublishTime time.Time         `json:"publishTime"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// PushHandler processes push subscription requests with the subscriber, see ProcessMessage.
+// It responds 204 to ack the message, or 503 to nack it so Pub/Sub redelivers it. Run must
+// not be called on the subscriber; its subscription is the push subscription. Protect the
+// route with PushAuth.
+//
+// Failed messages are retried and dead lettered as by Run: retries are republished to the
+// topic, and pushed again, and exhausted messages are published to the dlq topic. The
+// subscriber therefore needs a client, see WithClient; PushHandler panics without one.
+func PushHandler(s *PubSubSubscriber) gin.HandlerFunc {
+	if s.client == nil {
+		panic("grok: PushHandler requires a subscriber with a client to retry and dead letter messages")
+	}
+
+	return func(c *gin.Context) {
+		request := new(PushRequest)
+
+		if err := c.ShouldBindJSON(request); err != nil {
+			c.Error(err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, "invalid push request"))
+			return
+		}
+
+		disposition := s.ProcessMessage(c.Request.Context(), &pubsub.Message{
+			ID:          request.Message.ID,
+			Data:        request.Message.Data,
+			Attributes:  request.Message.Attributes,
+			PublishTime: request.Message.PublishTime,
+		})
+
+		if disposition == DispositionNack {
+			c.Status(http.StatusServiceUnavailable)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+type pushAuth struct {
+	audience       string
+	serviceAccount string
+	jwks           string
+}
+
+// PushAuthOption ...
+type PushAuthOption func(*pushAuth)
+
+// WithPushAudience sets the expected audience of the token, the audience configured in the
+// push subscription, which defaults to the push endpoint URL. It is required.
+func WithPushAudience(audience string) PushAuthOption {
+	return func(a *pushAuth) {
+		a.audience = audience
+	}
+}
+
+// WithPushServiceAccount sets the expected email of the token, the service account configured
+// in the push subscription. It is required.
+func WithPushServiceAccount(email string) PushAuthOption {
+	return func(a *pushAuth) {
+		a.serviceAccount = email
+	}
+}
+
+// WithPushJWKS replaces the keys used to verify tokens - default GoogleJWKS.
+func WithPushJWKS(uri string) PushAuthOption {
+	return func(a *pushAuth) {
+		a.jwks = uri
+	}
+}
+
+// PushAuth responds 401 to push requests without a valid OIDC token for the audience,
+// signed by Google for the service account, so only Pub/Sub invokes the push endpoint.
+// It panics without WithPushAudience or WithPushServiceAccount, which would accept tokens
+// Google issued to anyone.
+//
+// Create the push subscription with an OIDC token for a service account, e.g.
+//
+//	gcloud pubsub subscriptions create orders --topic orders \
+//		--push-endpoint https://orders-xyz.a.run.app/push \
+//		--push-auth-service-account push@project.iam.gserviceaccount.com
+//
+// grant the Pub/Sub service agent, service-PROJECT_NUMBER@gcp-sa-pubsub.iam.gserviceaccount.com,
+// roles/iam.serviceAccountTokenCreator on the service account, and, on Cloud Run, grant the
+// service account roles/run.invoker on the service.
+func PushAuth(opts ...PushAuthOption) gin.HandlerFunc {
+	a := &pushAuth{jwks: GoogleJWKS}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	if a.audience == "" || a.serviceAccount == "" {
+		panic("grok: PushAuth requires WithPushAudience and WithPushServiceAccount")
+	}
+
+	validator := auth0.NewValidator(
+		auth0.NewConfiguration(
+			auth0.NewJWKClient(auth0.JWKClientOptions{URI: a.jwks}, nil),
+			[]string{a.audience},
+			GoogleIssuer,
+			jose.RS256,
+		),
+		nil,
+	)
+
+	return func(c *gin.Context) {
+		token, err := validator.ValidateRequest(c.Request)
+
+		if err != nil {
+			c.Error(err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		claims := struct {
+			Email         string `json:"email"`
+			EmailVerified bool   `json:"email_verified"`
+		}{}
+
+		if err := validator.Claims(c.Request, token, &claims); err != nil {
+			c.Error(err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		if claims.Email != a.serviceAccount || !claims.EmailVerified {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,71 @@
+package grok
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultRetryAfter is the Retry-After of the responses of WithReadinessGate by default.
+const DefaultRetryAfter = 5 * time.Second
+
+// ErrReadinessGateWithoutHealthChecks is returned by NewAPI when WithReadinessGate is set
+// without WithHealthChecks.
+var ErrReadinessGateWithoutHealthChecks = errors.New("readiness gate requires WithHealthChecks")
+
+// readinessInterval is the minimum interval between the checks of the readiness gate.
+const readinessInterval = time.Second
+
+// WithReadinessGate responds 503 with a Retry-After header to every request until the
+// WithHealthChecks checks pass for the first time, so the server may listen before its
+// dependencies are ready. The checks run in the background, at most once a second while
+// requests arrive, so gated requests never wait for them. The healthz, health and swagger
+// routes are not gated.
+func WithReadinessGate(retryAfter time.Duration) APIOption {
+	return func(server *API) {
+		server.readinessGate = true
+		server.retryAfter = retryAfter
+	}
+}
+
+func readinessGate(checker *HealthChecker, retryAfter time.Duration) gin.HandlerFunc {
+	if retryAfter <= 0 {
+		retryAfter = DefaultRetryAfter
+	}
+
+	seconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+	ready := int32(0)
+	checking := int32(0)
+	checked := int64(0)
+
+	check := func() {
+		defer atomic.StoreInt32(&checking, 0)
+
+		if checker.Check(context.Background()).Status == HealthUp {
+			atomic.StoreInt32(&ready, 1)
+		}
+
+		atomic.StoreInt64(&checked, time.Now().UnixNano())
+	}
+
+	return func(c *gin.Context) {
+		if atomic.LoadInt32(&ready) == 1 {
+			return
+		}
+
+		if time.Since(time.Unix(0, atomic.LoadInt64(&checked))) >= readinessInterval &&
+			atomic.CompareAndSwapInt32(&checking, 0, 1) {
+			go check()
+		}
+
+		c.Header("Retry-After", seconds)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable,
+			NewError(http.StatusServiceUnavailable, "service is not ready"))
+	}
+}
@@ -0,0 +1,65 @@
+package grok
+
+import (
+	"cloud.google.com/go/pubsub"
+	"github.com/sirupsen/logrus"
+)
+
+// EffectiveReceiveSettings returns the receive settings Run applies, with the defaults the
+// client library uses for zero values resolved. A negative max extension disables lease
+// extension and is returned as zero.
+func (s *PubSubSubscriber) EffectiveReceiveSettings() pubsub.ReceiveSettings {
+	settings := s.receiveSettings()
+	defaults := pubsub.DefaultReceiveSettings
+
+	if settings.MaxOutstandingMessages == 0 {
+		settings.MaxOutstandingMessages = defaults.MaxOutstandingMessages
+	}
+
+	if settings.MaxOutstandingBytes == 0 {
+		settings.MaxOutstandingBytes = defaults.MaxOutstandingBytes
+	}
+
+	switch {
+	case settings.MaxExtension == 0:
+		settings.MaxExtension = defaults.MaxExtension
+	case settings.MaxExtension < 0:
+		settings.MaxExtension = 0
+	}
+
+	switch {
+	case settings.Synchronous:
+		settings.NumGoroutines = 1
+	case settings.NumGoroutines < 1:
+		settings.NumGoroutines = defaults.NumGoroutines
+	}
+
+	return settings
+}
+
+// receiveSettings returns the receive settings of WithExistingSubscription, if any, with the
+// subscriber options applied.
+func (s *PubSubSubscriber) receiveSettings() pubsub.ReceiveSettings {
+	settings := pubsub.ReceiveSettings{}
+
+	if s.existingSubscription != nil {
+		settings = s.existingSubscription.ReceiveSettings
+	}
+
+	settings.MaxOutstandingMessages = s.maxOutstandingMessages
+	settings.MaxExtension = s.maxExtension
+
+	return settings
+}
+
+func (s *PubSubSubscriber) logReceiveSettings() {
+	settings := s.EffectiveReceiveSettings()
+
+	s.log.WithFields(logrus.Fields{
+		"max_outstanding_messages": settings.MaxOutstandingMessages,
+		"max_outstanding_bytes":    settings.MaxOutstandingBytes,
+		"max_extension":            settings.MaxExtension.String(),
+		"num_goroutines":           settings.NumGoroutines,
+		"synchronous":              settings.Synchronous,
+	}).Infof("consumer %s receive settings", s.subscriberID)
+}
@@ -0,0 +1,82 @@
+package grok
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/sirupsen/logrus"
+)
+
+// WithReconcileSubscription updates an existing subscription whose ack deadline,
+// retention or labels drift from the subscriber options, logging what changed.
+// Immutable fields, such as the topic, are only warned about. Max outstanding
+// messages is a receive setting and always applied, so it is not reconciled.
+func WithReconcileSubscription() PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.reconcile = true
+	}
+}
+
+// WithSubscriptionRetention sets how long unacknowledged messages are retained - default 7 days.
+func WithSubscriptionRetention(d time.Duration) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.retention = d
+	}
+}
+
+// WithSubscriptionLabels sets the labels of the subscription.
+func WithSubscriptionLabels(labels map[string]string) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.labels = labels
+	}
+}
+
+func (s *PubSubSubscriber) reconcileSubscription(ctx context.Context, subscription *pubsub.Subscription) error {
+	config, err := subscription.Config(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if config.Topic != nil && config.Topic.String() != s.topic().String() {
+		s.log.WithField("current", config.Topic.String()).
+			WithField("desired", s.topic().String()).
+			Warnf("subscription %s topic cannot be changed", s.subscriberID)
+	}
+
+	update := pubsub.SubscriptionConfigToUpdate{}
+	changes := logrus.Fields{}
+
+	if config.AckDeadline != s.ackDeadline {
+		update.AckDeadline = s.ackDeadline
+		changes["ack_deadline"] = fmt.Sprintf("%s -> %s", config.AckDeadline, s.ackDeadline)
+	}
+
+	if s.retention != 0 && config.RetentionDuration != s.retention {
+		update.RetentionDuration = s.retention
+		changes["retention"] = fmt.Sprintf("%s -> %s", config.RetentionDuration, s.retention)
+	}
+
+	if s.labels != nil && !reflect.DeepEqual(config.Labels, s.labels) {
+		update.Labels = s.labels
+		changes["labels"] = fmt.Sprintf("%v -> %v", config.Labels, s.labels)
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if _, err := subscription.Update(ctx, update); err != nil {
+		s.log.WithError(err).
+			Errorf("error reconciling subscription %s", s.subscriberID)
+		return err
+	}
+
+	s.log.WithFields(changes).
+		Infof("subscription %s reconciled", s.subscriberID)
+
+	return nil
+}
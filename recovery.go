@@ -0,0 +1,69 @@
+package grok
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultPanicMessage is the message returned to clients when a handler panics.
+const DefaultPanicMessage = "internal server error"
+
+// WithPanicMessage replaces the message returned to clients when a handler panics - default DefaultPanicMessage.
+// When settings.API.Debug is set the panic value is returned as well.
+func WithPanicMessage(message string) APIOption {
+	return func(server *API) {
+		server.panicMessage = message
+	}
+}
+
+// Recovery responds 500 with the standard error body and the request id when a handler
+// panics, logging the panic with its stack. With detailed the panic value is returned
+// to the client, it should be used only in debug.
+func Recovery(message string, detailed bool) gin.HandlerFunc {
+	return RecoveryWithReporter(message, detailed, nil)
+}
+
+// RecoveryWithReporter is Recovery reporting the panics to reporter when it is not nil.
+func RecoveryWithReporter(message string, detailed bool, reporter ErrorReporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+
+			if r == nil {
+				return
+			}
+
+			requestID := RequestID(c)
+			stack := string(debug.Stack())
+
+			logrus.WithField("error", r).
+				WithField("request_id", requestID).
+				WithField("stack", stack).
+				Errorf("panic handling %s %s", c.Request.Method, c.Request.URL.Path)
+
+			if reporter != nil {
+				reporter.Report(c.Request.Context(), fmt.Errorf("panic: %v", r), map[string]interface{}{
+					"request_id": requestID,
+					"method":     c.Request.Method,
+					"path":       c.Request.URL.Path,
+					"stack":      stack,
+				})
+			}
+
+			err := NewError(http.StatusInternalServerError, message)
+			err.RequestID = requestID
+
+			if detailed {
+				err.Messages = append(err.Messages, fmt.Sprint(r))
+			}
+
+			c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		}()
+
+		c.Next()
+	}
+}
@@ -0,0 +1,138 @@
+package grok
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/patrickmn/go-cache"
+)
+
+// CacheStatusHeader tells whether CacheResponse served the response from the cache, HIT, or not, MISS.
+const CacheStatusHeader = "X-Cache"
+
+const responseCachePrefix = "response:"
+
+type cachedResponse struct {
+	path   string
+	status int
+	header http.Header
+	body   []byte
+}
+
+type cacheWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *cacheWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *cacheWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// DefaultCacheKey keys responses by method, path, query, Accept header and tenant.
+func DefaultCacheKey(c *gin.Context) string {
+	return c.Request.Method + " " + c.Request.URL.RequestURI() + " " + c.GetHeader("Accept") + " " + TenantFromContext(c)
+}
+
+// CacheResponse serves GET requests from c, storing 2xx responses for ttl under keyFunc,
+// DefaultCacheKey when nil. Requests with Cache-Control: no-cache skip the cached response
+// and refresh it. Responses setting cookies are never cached. With DefaultCacheKey, requests
+// with an Authorization header are not cached, since their responses may depend on the
+// principal; give a keyFunc identifying the principal to cache them.
+func CacheResponse(c *cache.Cache, ttl time.Duration, keyFunc func(*gin.Context) string) gin.HandlerFunc {
+	public := keyFunc == nil
+
+	if keyFunc == nil {
+		keyFunc = DefaultCacheKey
+	}
+
+	return func(ctx *gin.Context) {
+		if ctx.Request.Method != http.MethodGet || public && ctx.GetHeader("Authorization") != "" {
+			ctx.Next()
+			return
+		}
+
+		key := responseCachePrefix + keyFunc(ctx)
+
+		if !strings.Contains(ctx.GetHeader("Cache-Control"), "no-cache") {
+			if value, found := c.Get(key); found {
+				if cached, ok := value.(*cachedResponse); ok {
+					for k, v := range cached.header {
+						ctx.Writer.Header()[k] = append([]string(nil), v...)
+					}
+
+					ctx.Header(CacheStatusHeader, "HIT")
+					ctx.Data(cached.status, cached.header.Get("Content-Type"), cached.body)
+					ctx.Abort()
+					return
+				}
+			}
+		}
+
+		writer := &cacheWriter{ResponseWriter: ctx.Writer, body: new(bytes.Buffer)}
+		ctx.Writer = writer
+		ctx.Header(CacheStatusHeader, "MISS")
+
+		ctx.Next()
+
+		status := writer.Status()
+
+		if status < 200 || status > 299 || writer.Header().Get("Set-Cookie") != "" {
+			return
+		}
+
+		header := writer.Header().Clone()
+		header.Del(CacheStatusHeader)
+
+		c.Set(key, &cachedResponse{
+			path:   ctx.Request.URL.Path,
+			status: status,
+			header: header,
+			body:   writer.body.Bytes(),
+		}, ttl)
+	}
+}
+
+// InvalidateCachedResponses removes the responses cached by CacheResponse whose path starts
+// with any of prefixes, e.g. /items invalidates /items and /items/1.
+func InvalidateCachedResponses(c *cache.Cache, prefixes ...string) {
+	for key, item := range c.Items() {
+		cached, ok := item.Object.(*cachedResponse)
+
+		if !ok || !strings.HasPrefix(key, responseCachePrefix) {
+			continue
+		}
+
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(cached.path, prefix) {
+				c.Delete(key)
+				break
+			}
+		}
+	}
+}
+
+// InvalidateCache invalidates the cached responses under prefixes after successful writes,
+// requests other than GET, HEAD and OPTIONS answered with 2xx.
+func InvalidateCache(c *cache.Cache, prefixes ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+
+		switch ctx.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return
+		}
+
+		if status := ctx.Writer.Status(); status >= 200 && status <= 299 {
+			InvalidateCachedResponses(c, prefixes...)
+		}
+	}
+}
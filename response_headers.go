@@ -0,0 +1,90 @@
+package grok
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// SecurityHeadersConfig sets the security headers of every response.
+// Empty fields use the secure default of DefaultSecurityHeaders.
+type SecurityHeadersConfig struct {
+	ContentTypeOptions    string
+	FrameOptions          string
+	ContentSecurityPolicy string
+	ReferrerPolicy        string
+	CrossDomainPolicies   string
+	DownloadOptions       string
+}
+
+// DefaultSecurityHeaders are secure defaults for JSON APIs.
+var DefaultSecurityHeaders = SecurityHeadersConfig{
+	ContentTypeOptions:    "nosniff",
+	FrameOptions:          "DENY",
+	ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+	ReferrerPolicy:        "no-referrer",
+	CrossDomainPolicies:   "none",
+	DownloadOptions:       "noopen",
+}
+
+func (config SecurityHeadersConfig) headers() map[string]string {
+	value := func(v, def string) string {
+		if v == "" {
+			return def
+		}
+
+		return v
+	}
+
+	return map[string]string{
+		"X-Content-Type-Options":            value(config.ContentTypeOptions, DefaultSecurityHeaders.ContentTypeOptions),
+		"X-Frame-Options":                   value(config.FrameOptions, DefaultSecurityHeaders.FrameOptions),
+		"Content-Security-Policy":           value(config.ContentSecurityPolicy, DefaultSecurityHeaders.ContentSecurityPolicy),
+		"Referrer-Policy":                   value(config.ReferrerPolicy, DefaultSecurityHeaders.ReferrerPolicy),
+		"X-Permitted-Cross-Domain-Policies": value(config.CrossDomainPolicies, DefaultSecurityHeaders.CrossDomainPolicies),
+		"X-Download-Options":                value(config.DownloadOptions, DefaultSecurityHeaders.DownloadOptions),
+	}
+}
+
+// WithSecurityHeaders sets the security headers on every response, including errors.
+func WithSecurityHeaders(config SecurityHeadersConfig) APIOption {
+	return WithResponseHeaders(config.headers())
+}
+
+// WithResponseHeaders sets static headers on every response, including errors.
+// They are set before the handlers run, so handlers can still override them.
+func WithResponseHeaders(headers map[string]string) APIOption {
+	return func(server *API) {
+		if server.responseHeaders == nil {
+			server.responseHeaders = make(map[string]string)
+		}
+
+		for k, v := range headers {
+			server.responseHeaders[k] = v
+		}
+	}
+}
+
+// WithRouteResponseHeaders overrides the response headers of the route registered with
+// method and path, e.g. "/files/:id". An empty value removes the header from the route.
+func WithRouteResponseHeaders(method, path string, headers map[string]string) APIOption {
+	return func(server *API) {
+		if server.routeResponseHeaders == nil {
+			server.routeResponseHeaders = make(map[string]map[string]string)
+		}
+
+		server.routeResponseHeaders[method+" "+path] = headers
+	}
+}
+
+func responseHeadersMiddleware(headers map[string]string, routes map[string]map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for k, v := range headers {
+			c.Header(k, v)
+		}
+
+		for k, v := range routes[c.Request.Method+" "+c.FullPath()] {
+			c.Header(k, v)
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,129 @@
+package grok
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// NotBeforeAttribute holds the unix time in milliseconds before which a message
+// in the retry topic is not republished.
+const NotBeforeAttribute = "not_before"
+
+// MaxRetryDelay caps the delay of messages sent to the retry topic. The retry delayer
+// extends the lease of each message until its not_before time, which WithMaxExtension
+// (default 10m) must allow, or the message is redelivered and waited for again.
+const MaxRetryDelay = 5 * time.Minute
+
+// WithRetryTopic publishes failed messages to the <topic>_retry topic with the
+// not_before attribute, instead of republishing them to the topic right away.
+// The RetryDelayer of the subscriber must run to move them back to the topic.
+func WithRetryTopic() PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.retryTopic = true
+	}
+}
+
+// WithRetryDelay - default 1s. Delay of the first retry with WithRetryTopic, doubled on
+// each retry up to MaxRetryDelay.
+func WithRetryDelay(d time.Duration) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.retryDelay = d
+	}
+}
+
+// RetryTopicID returns the retry topic id, also used as its subscription id.
+func (s *PubSubSubscriber) RetryTopicID() string {
+	return s.topicID + "_retry"
+}
+
+// RetryDelayer returns the subscriber of the retry topic. It holds every message until
+// its not_before time and republishes it, byte for byte, to the topic. Messages failing
+// to be republished are nacked to be redelivered.
+func (s *PubSubSubscriber) RetryDelayer() *PubSubSubscriber {
+	return NewPubSubSubscriber(
+		WithClient(s.client),
+		WithMessageBus(s.bus),
+		WithTopicID(s.RetryTopicID()),
+		WithPubSubSubscriberID(s.RetryTopicID()),
+		WithMaxOutstandingMessages(s.maxOutstandingMessages),
+		WithAckDeadline(s.ackDeadline),
+		WithDeadlineMargin(s.deadlineMargin),
+		WithMaxExtension(s.maxExtension),
+		WithPublisher(s.producer),
+		WithMaxRetries(0),
+		WithoutDLQ(),
+		WithExhaustedPolicy(ExhaustedNack),
+		WithMessageHandler(s.delay),
+	)
+}
+
+func (s *PubSubSubscriber) delay(ctx context.Context, delivery *Delivery) error {
+	message := delivery.Message
+	attributes := make(map[string]string, len(message.Attributes))
+
+	for k, v := range message.Attributes {
+		attributes[k] = v
+	}
+
+	delete(attributes, NotBeforeAttribute)
+
+	if notBefore, err := strconv.ParseInt(message.Attributes[NotBeforeAttribute], 10, 64); err == nil {
+		wait := time.Until(time.Unix(0, notBefore*int64(time.Millisecond)))
+
+		if wait > 0 {
+			// keeps the usual handler deadline to republish once the wait is over
+			delivery.Extend(wait + s.handlerDeadline())
+
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	if err := s.producer.PublishRaw(s.retryTarget(), message.Data, attributes); err != nil {
+		return fmt.Errorf("republishing message %s: %w", message.ID, err)
+	}
+
+	s.log.Debugf("message %s moved from %s to %s", message.ID, s.RetryTopicID(), s.topicID)
+
+	return nil
+}
+
+func (s *PubSubSubscriber) createRetryTopic(ctx context.Context) error {
+	topic, err := createTopicIfNotExists(ctx, s.client, s.RetryTopicID())
+
+	if err != nil {
+		return err
+	}
+
+	return createTopicSubscription(ctx, s.client, topic)
+}
+
+// createTopicSubscription creates the subscription named after topic.
+func createTopicSubscription(ctx context.Context, client *pubsub.Client, topic *pubsub.Topic) error {
+	subscription := client.Subscription(topic.ID())
+	exists, err := subscription.Exists(ctx)
+
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = client.CreateSubscription(ctx, topic.ID(), pubsub.SubscriptionConfig{Topic: topic})
+
+	if status.Code(err) == codes.AlreadyExists {
+		return nil
+	}
+
+	return err
+}
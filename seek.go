@@ -0,0 +1,55 @@
+package grok
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// ErrReceiving is returned when seeking a subscription while Run receives from it.
+var ErrReceiving = errors.New("cannot seek while the subscriber is receiving")
+
+// WithRetainAckedMessages creates the subscription retaining acked messages for the retention
+// duration, see WithSubscriptionRetention, so Seek can reprocess them.
+func WithRetainAckedMessages() PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.retainAcked = true
+	}
+}
+
+// Seek marks every message published after to as unacked and every message before
+// as acked, so they are redelivered for reprocessing. Acked messages are redelivered only
+// when the subscription retains them, see WithRetainAckedMessages. Seek affects every
+// consumer of the subscription, and fails with ErrReceiving while Run is receiving;
+// stop the subscriber, seek, and run it again.
+func (s *PubSubSubscriber) Seek(ctx context.Context, to time.Time) error {
+	if atomic.LoadInt32(&s.receiving) == 1 {
+		return ErrReceiving
+	}
+
+	s.log.Warnf("seeking subscription %s to %s", s.subscriberID, to)
+
+	return s.seekSubscription().SeekToTime(ctx, to)
+}
+
+// SeekToSnapshot is Seek to the state of the subscription captured by snapshot.
+func (s *PubSubSubscriber) SeekToSnapshot(ctx context.Context, snapshot string) error {
+	if atomic.LoadInt32(&s.receiving) == 1 {
+		return ErrReceiving
+	}
+
+	s.log.Warnf("seeking subscription %s to snapshot %s", s.subscriberID, snapshot)
+
+	return s.seekSubscription().SeekToSnapshot(ctx, s.client.Snapshot(snapshot))
+}
+
+func (s *PubSubSubscriber) seekSubscription() *pubsub.Subscription {
+	if s.existingSubscription != nil {
+		return s.existingSubscription
+	}
+
+	return s.client.Subscription(s.subscriberID)
+}
@@ -2,12 +2,13 @@ package grok
 
 import (
 	"context"
+	"crypto/x509"
+	"errors"
 	"net/http"
-	"os"
-	"os/signal"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
 	"github.com/sirupsen/logrus"
 )
 
@@ -16,12 +17,46 @@ type API struct {
 	Engine *gin.Engine
 	router *gin.RouterGroup
 
-	cors     bool
-	settings *Settings
-	healthz  gin.HandlerFunc
-	handlers []gin.HandlerFunc
+	cors         bool
+	corsConfig   *CORSConfig
+	metrics      bool
+	settings     *Settings
+	healthz      gin.HandlerFunc
+	health       *HealthChecker
+	notFound     gin.HandlerFunc
+	handlers     []gin.HandlerFunc
+	validator    *validator.Validate
+	logRedaction []string
+	inflight     *inflightRequests
+	panicMessage string
 
-	Container Container
+	trustedProxies       []string
+	httpsRedirect        bool
+	apiKeyAuth           bool
+	preStopHooks         []PreStopHook
+	preStopDelay         time.Duration
+	readinessGate        bool
+	retryAfter           time.Duration
+	errorReporter        ErrorReporter
+	requireControllers   bool
+	bindErrorHandler     BindErrorHandler
+	responseHeaders      map[string]string
+	routeResponseHeaders map[string]map[string]string
+	hstsMaxAge           time.Duration
+	configLogLevel       logrus.Level
+	contentTypes         []string
+	routeContentTypes    map[string][]string
+	acceptTypes          []string
+	routeAcceptTypes     map[string][]string
+
+	tlsCert          string
+	tlsKey           string
+	clientCertAuth   bool
+	clientCAs        *x509.CertPool
+	verifyClientCert func(*x509.Certificate) error
+
+	Container  Container
+	containers containers
 }
 
 // APIOption wrapps all server configurations
@@ -31,10 +66,20 @@ func init() {
 	gin.SetMode("release")
 }
 
-// WithContainer adds a container to the server
+// WithContainer sets the server container, replacing containers set before.
+// Use WithContainers to serve several containers.
 func WithContainer(c Container) APIOption {
 	return func(server *API) {
-		server.Container = c
+		server.containers = containers{c}
+	}
+}
+
+// WithContainers adds containers to the server. Their controllers are all registered,
+// and they are started and closed in order. Containers registering the same route
+// are rejected by NewAPI.
+func WithContainers(cs ...Container) APIOption {
+	return func(server *API) {
+		server.containers = append(server.containers, cs...)
 	}
 }
 
@@ -66,26 +111,127 @@ func WithHealthz(h gin.HandlerFunc) APIOption {
 	}
 }
 
-// New creates a new API server
+// WithValidator sets the validator used by Bind.
+// Custom validation tags must be registered on it by the caller.
+func WithValidator(v *validator.Validate) APIOption {
+	return func(server *API) {
+		server.validator = v
+	}
+}
+
+// WithLogRedaction adds header names and query keys to be redacted from access logs.
+func WithLogRedaction(keys []string) APIOption {
+	return func(server *API) {
+		server.logRedaction = append(server.logRedaction, keys...)
+	}
+}
+
+// WithHealthChecks serves the checker report at /health
+func WithHealthChecks(h *HealthChecker) APIOption {
+	return func(server *API) {
+		server.health = h
+	}
+}
+
+// WithNotFoundHandler replaces the default JSON 404 handler
+func WithNotFoundHandler(h gin.HandlerFunc) APIOption {
+	return func(server *API) {
+		server.notFound = h
+	}
+}
+
+// WithAPIKeyAuth requires one of keys in header for every controller route.
+// Healthz, health and swagger routes are not protected. It can be used along with
+// or instead of an Authenticate middleware.
+func WithAPIKeyAuth(keys []string, header string) APIOption {
+	return func(server *API) {
+		server.handlers = append(server.handlers, APIKeyAuth(keys, header))
+		server.apiKeyAuth = true
+	}
+}
+
+// New creates a new API server. It panics when NewAPI fails, on missing settings,
+// invalid options or container routes registered twice, where it used to panic on
+// a nil pointer or inside gin. Use NewAPI to handle the error instead.
 func New(opts ...APIOption) *API {
+	server, err := NewAPI(opts...)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return server
+}
+
+// NewAPI creates a new API server, failing on missing settings, invalid options or
+// container routes registered twice.
+func NewAPI(opts ...APIOption) (*API, error) {
 	server := &API{}
 	server.handlers = []gin.HandlerFunc{}
+	server.validator = Validator
+	server.panicMessage = DefaultPanicMessage
+	server.hstsMaxAge = DefaultHSTSMaxAge
+	server.configLogLevel = DefaultConfigLogLevel
 
 	for _, opt := range opts {
 		opt(server)
 	}
 
+	if server.settings == nil || server.settings.API == nil {
+		return nil, errors.New("missing required settings: api")
+	}
+
+	if server.clientCertAuth && server.tlsCert == "" {
+		return nil, ErrClientCertWithoutTLS
+	}
+
+	if server.readinessGate && server.health == nil {
+		return nil, ErrReadinessGateWithoutHealthChecks
+	}
+
+	server.Container = server.containers
+
+	if len(server.containers) == 1 {
+		server.Container = server.containers[0]
+	}
+
+	server.inflight = newInflightRequests(server.metrics)
+
 	server.Engine = gin.New()
-	server.Engine.Use(gin.Recovery())
-	server.Engine.Use(LogMiddleware())
+	server.Engine.ForwardedByClientIP = false
+	server.Engine.Use(trustedProxies(server.trustedProxies))
+	server.Engine.Use(server.inflight.middleware())
+	server.Engine.Use(LogMiddleware(server.logRedaction...))
+	server.Engine.Use(RecoveryWithReporter(server.panicMessage, server.settings.API.Debug, server.errorReporter))
+	server.Engine.Use(validatorMiddleware(server.validator))
+
+	if server.bindErrorHandler != nil {
+		server.Engine.Use(bindErrorMiddleware(server.bindErrorHandler))
+	}
+
+	if server.httpsRedirect {
+		server.Engine.Use(httpsRedirect(server.hstsMaxAge))
+	}
+
+	if len(server.responseHeaders) > 0 || len(server.routeResponseHeaders) > 0 {
+		server.Engine.Use(responseHeadersMiddleware(server.responseHeaders, server.routeResponseHeaders))
+	}
 
-	if server.cors {
+	if server.metrics {
+		server.Engine.Use(MetricsMiddleware())
+	}
+
+	if server.corsConfig != nil {
+		server.Engine.Use(CORSWithConfig(*server.corsConfig))
+	} else if server.cors {
 		server.Engine.Use(CORS())
 	}
 
-	server.Engine.NoRoute(func(c *gin.Context) {
-		c.AbortWithStatus(http.StatusNotFound)
-	})
+	if server.notFound == nil {
+		server.notFound = NotFound
+	}
+
+	server.Engine.NoRoute(server.notFound)
 
 	server.router = server.Engine.Group("")
 
@@ -93,44 +239,75 @@ func New(opts ...APIOption) *API {
 		server.router.GET("/healthz", server.healthz)
 	}
 
+	if server.health != nil {
+		server.router.GET("/health", server.health.Handler())
+	}
+
 	server.router.GET("/swagger", Swagger(server.settings.API.Swagger))
 
+	if server.readinessGate {
+		server.router.Use(readinessGate(server.health, server.retryAfter))
+	}
+
 	server.router.Use(server.handlers...)
 
-	for _, ctrl := range server.Container.Controllers() {
-		ctrl.RegisterRoutes(server.router)
+	if len(server.contentTypes) > 0 || len(server.routeContentTypes) > 0 {
+		server.router.Use(contentTypeMiddleware(server.contentTypes, server.routeContentTypes))
 	}
 
-	return server
-}
+	if len(server.acceptTypes) > 0 || len(server.routeAcceptTypes) > 0 {
+		server.router.Use(acceptMiddleware(server.acceptTypes, server.routeAcceptTypes))
+	}
 
-// Run starts the server.
-func (server *API) Run() {
-	defer server.Container.Close()
+	controllers := make([][]APIController, len(server.containers))
+	count := 0
 
-	srv := http.Server{
-		Addr:    server.settings.API.Host,
-		Handler: server.Engine,
+	for i, c := range server.containers {
+		controllers[i] = c.Controllers()
+		count += len(controllers[i])
 	}
 
-	sigs := make(chan os.Signal)
-	signal.Notify(sigs, os.Interrupt)
+	if count == 0 {
+		if server.requireControllers {
+			return nil, ErrNoControllers
+		}
 
-	go func() {
-		sig := <-sigs
+		logrus.Warn("no controllers registered - only the health and swagger routes are served")
+	}
 
-		logrus.Infof("caught sig: %+v", sig)
-		logrus.Info("waiting 5 seconds to finish processing")
+	if err := registerControllers(server.Engine, server.router, controllers); err != nil {
+		return nil, err
+	}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+	server.logConfig()
 
-		if err := srv.Shutdown(ctx); err != nil {
-			logrus.WithField("error", err).Error("shotdown error")
-		}
-	}()
+	return server, nil
+}
+
+// NotFound responds 404 with the standard error body.
+func NotFound(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusNotFound, NewError(http.StatusNotFound, "resource not found"))
+}
 
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+// Run starts the server and blocks until it is interrupted.
+func (server *API) Run() {
+	if err := NewService(WithServiceAPI(server)).Run(context.Background()); err != nil {
 		logrus.WithField("error", err).Info("startup error")
 	}
 }
+
+func (server *API) httpServer() *http.Server {
+	return &http.Server{
+		Addr:      server.settings.API.Host,
+		Handler:   server.Engine,
+		TLSConfig: server.tlsConfig(),
+	}
+}
+
+func (server *API) listenAndServe(srv *http.Server) error {
+	if server.tlsCert != "" {
+		return srv.ListenAndServeTLS(server.tlsCert, server.tlsKey)
+	}
+
+	return srv.ListenAndServe()
+}
@@ -0,0 +1,181 @@
+package grok
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Subscriber ...
+type Subscriber interface {
+	Run(ctx context.Context) error
+}
+
+// Service runs an API and subscribers together, sharing signal handling.
+// On shutdown it runs the API pre-stop hooks and delay, then stops accepting HTTP
+// requests, drains the subscribers and closes the API container, all within the
+// shutdown timeout.
+type Service struct {
+	api         *API
+	subscribers []Subscriber
+	timeout     time.Duration
+
+	startupConcurrency int
+}
+
+// ServiceOption ...
+type ServiceOption func(*Service)
+
+// WithServiceAPI ...
+func WithServiceAPI(api *API) ServiceOption {
+	return func(s *Service) {
+		s.api = api
+	}
+}
+
+// WithSubscribers ...
+func WithSubscribers(subscribers ...Subscriber) ServiceOption {
+	return func(s *Service) {
+		s.subscribers = append(s.subscribers, subscribers...)
+	}
+}
+
+// WithShutdownTimeout - default 5s
+func WithShutdownTimeout(d time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.timeout = d
+	}
+}
+
+// NewService ...
+func NewService(opts ...ServiceOption) *Service {
+	service := new(Service)
+	service.timeout = 5 * time.Second
+	service.startupConcurrency = DefaultStartupConcurrency
+
+	for _, opt := range opts {
+		opt(service)
+	}
+
+	return service
+}
+
+// Run starts everything and blocks until ctx is done, a signal is caught or a
+// component fails. It returns the first fatal error.
+func (s *Service) Run(ctx context.Context) error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	errs := make(chan error, len(s.subscribers)+1)
+
+	if s.api != nil {
+		if starter, ok := s.api.Container.(Starter); ok {
+			if err := starter.Start(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := s.setupSubscribers(ctx); err != nil {
+		return err
+	}
+
+	var srv *http.Server
+
+	if s.api != nil {
+		srv = s.api.httpServer()
+
+		go func() {
+			if err := s.api.listenAndServe(srv); err != nil && err != http.ErrServerClosed {
+				errs <- err
+			}
+		}()
+	}
+
+	subscribersCtx, cancelSubscribers := context.WithCancel(context.Background())
+	defer cancelSubscribers()
+
+	wg := new(sync.WaitGroup)
+
+	for _, subscriber := range s.subscribers {
+		wg.Add(1)
+		go func(subscriber Subscriber) {
+			defer wg.Done()
+			if err := subscriber.Run(subscribersCtx); err != nil {
+				errs <- err
+			}
+		}(subscriber)
+	}
+
+	drained := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+
+	var err error
+
+	select {
+	case <-ctx.Done():
+	case sig := <-sigs:
+		logrus.Infof("caught sig: %+v", sig)
+	case err = <-errs:
+		logrus.WithError(err).Error("service component failed")
+	}
+
+	if s.api != nil {
+		preStopCtx, cancelPreStop := context.WithTimeout(context.Background(), s.timeout+s.api.preStopDelay)
+		s.api.preStop(preStopCtx)
+		cancelPreStop()
+	}
+
+	logrus.Infof("waiting %s to finish processing", s.timeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	if srv != nil {
+		logrus.Infof("shutting down with %d requests in flight", s.api.inflight.count())
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logrus.WithField("error", err).Error("shotdown error")
+
+			if paths := s.api.inflight.paths(); len(paths) > 0 {
+				logrus.WithField("requests", paths).
+					Warnf("shutdown timed out with %d requests in flight", len(paths))
+			}
+		}
+	}
+
+	cancelSubscribers()
+
+	select {
+	case <-drained:
+	case <-shutdownCtx.Done():
+		logrus.Warn("subscribers did not drain before shutdown timeout")
+	}
+
+	for _, subscriber := range s.subscribers {
+		if c, ok := subscriber.(interface{ Close(context.Context) error }); ok {
+			if err := c.Close(shutdownCtx); err != nil {
+				logrus.WithError(err).Error("error closing subscriber")
+			}
+		}
+	}
+
+	if s.api != nil && s.api.Container != nil {
+		if err := s.api.Container.Close(); err != nil {
+			logrus.WithError(err).Error("error closing container")
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,69 @@
+package grok_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/recoli-tech/grok"
+	"github.com/stretchr/testify/assert"
+)
+
+type shutdownEvents struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (e *shutdownEvents) add(event string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, event)
+}
+
+type shutdownSubscriber struct {
+	events *shutdownEvents
+}
+
+func (s *shutdownSubscriber) Run(ctx context.Context) error {
+	<-ctx.Done()
+	s.events.add("subscriber")
+	return nil
+}
+
+type shutdownContainer struct {
+	events *shutdownEvents
+}
+
+func (c *shutdownContainer) Controllers() []grok.APIController {
+	return []grok.APIController{&testController{}}
+}
+
+func (c *shutdownContainer) Close() error {
+	c.events.add("container")
+	return nil
+}
+
+func TestServiceShutdownOrder(t *testing.T) {
+	events := &shutdownEvents{}
+
+	api := grok.New(
+		grok.WithSettings(&grok.Settings{API: &grok.APISettings{Host: "127.0.0.1:0"}}),
+		grok.WithContainer(&shutdownContainer{events: events}),
+		grok.WithPreStopHook(func(ctx context.Context) error {
+			events.add("pre_stop")
+			return nil
+		}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	err := grok.NewService(
+		grok.WithServiceAPI(api),
+		grok.WithSubscribers(&shutdownSubscriber{events: events}, &shutdownSubscriber{events: events}),
+		grok.WithShutdownTimeout(time.Second),
+	).Run(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pre_stop", "subscriber", "subscriber", "container"}, events.events)
+}
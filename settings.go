@@ -1,37 +1,47 @@
 package grok
 
 import (
+	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 
+	"github.com/go-playground/validator/v10"
 	"gopkg.in/yaml.v2"
 )
 
+// SettingsEnvPrefix prefixes the environment variables read by LoadSettings.
+const SettingsEnvPrefix = "GROK"
+
 //Settings ...
 type Settings struct {
-	API          *APISettings   `yaml:"api"`
-	Mongo        *MongoSettings `yaml:"mongo"`
-	GCP          *GCPSettings   `yaml:"gcp"`
+	API          *APISettings   `yaml:"api" validate:"required"`
+	Mongo        *MongoSettings `yaml:"mongo" validate:"required"`
+	GCP          *GCPSettings   `yaml:"gcp" validate:"required"`
 	UserProvider *UserProvider  `yaml:"user_provider"`
 	Mail         *MailSettings  `yaml:"mail"`
 }
 
 // APISettings ...
 type APISettings struct {
-	Host    string   `yaml:"host"`
+	Host    string   `yaml:"host" validate:"required"`
 	Swagger string   `yaml:"swagger"`
 	Auth    *APIAuth `yaml:"auth"`
+	Debug   bool     `yaml:"debug"`
 }
 
 // MongoSettings ...
 type MongoSettings struct {
-	ConnectionString string `yaml:"connection_string"`
-	Database         string `yaml:"database"`
+	ConnectionString string `yaml:"connection_string" validate:"required"`
+	Database         string `yaml:"database" validate:"required"`
 }
 
 // GCPSettings ...
 type GCPSettings struct {
-	ProjectID string `yaml:"project_id"`
+	ProjectID string `yaml:"project_id" validate:"required"`
 	PubSub    struct {
 		Fake     bool   `yaml:"fake"`
 		Endpoint string `yaml:"endpoint"`
@@ -98,3 +108,121 @@ func FromYAML(file string, dist interface{}) error {
 
 	return yaml.Unmarshal(data, dist)
 }
+
+// LoadSettings reads settings from a YAML or JSON file and overrides them with
+// environment variables named after the yaml keys, e.g. GROK_API_HOST or
+// GROK_MONGO_CONNECTION_STRING. Environment variables win over the file. The api, mongo
+// and gcp sections are required.
+func LoadSettings(path string) (*Settings, error) {
+	settings := new(Settings)
+
+	if path != "" {
+		if err := FromYAML(path, settings); err != nil {
+			return nil, err
+		}
+	}
+
+	applyEnv(reflect.ValueOf(settings).Elem(), SettingsEnvPrefix)
+
+	if err := validateSettings(settings); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// applyEnv sets the fields found in the environment and reports whether any was set.
+func applyEnv(v reflect.Value, prefix string) bool {
+	set := false
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		tag := strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0]
+
+		if tag == "" || tag == "-" || !field.CanSet() {
+			continue
+		}
+
+		key := fmt.Sprintf("%s_%s", prefix, strings.ToUpper(tag))
+
+		switch {
+		case field.Kind() == reflect.Struct:
+			set = applyEnv(field, key) || set
+		case field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Struct:
+			value := field
+
+			if field.IsNil() {
+				value = reflect.New(field.Type().Elem())
+			}
+
+			if applyEnv(value.Elem(), key) {
+				field.Set(value)
+				set = true
+			}
+		default:
+			env, ok := os.LookupEnv(key)
+
+			if ok && setFromString(field, env) {
+				set = true
+			}
+		}
+	}
+
+	return set
+}
+
+func setFromString(field reflect.Value, value string) bool {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return false
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false
+		}
+		field.SetInt(i)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return false
+		}
+		field.Set(reflect.ValueOf(strings.Split(value, ",")))
+	default:
+		return false
+	}
+
+	return true
+}
+
+func validateSettings(settings *Settings) error {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		return strings.Split(f.Tag.Get("yaml"), ",")[0]
+	})
+
+	err := validate.Struct(settings)
+
+	if err == nil {
+		return nil
+	}
+
+	validationErrors, ok := err.(validator.ValidationErrors)
+
+	if !ok {
+		return err
+	}
+
+	missing := []string{}
+
+	for _, e := range validationErrors {
+		namespace := strings.SplitN(e.Namespace(), ".", 2)
+		missing = append(missing, namespace[len(namespace)-1])
+	}
+
+	return fmt.Errorf("missing required settings: %s", strings.Join(missing, ", "))
+}
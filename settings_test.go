@@ -0,0 +1,45 @@
+package grok_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/recoli-tech/grok"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadSettings(t *testing.T) {
+	t.Run("Env Override", func(t *testing.T) {
+		os.Setenv("GROK_API_HOST", ":9999")
+		defer os.Unsetenv("GROK_API_HOST")
+
+		settings, err := grok.LoadSettings("tests/config.yaml")
+
+		assert.NoError(t, err)
+		assert.Equal(t, ":9999", settings.API.Host)
+		assert.Equal(t, "grok", settings.Mongo.Database)
+	})
+
+	t.Run("Missing Required", func(t *testing.T) {
+		os.Setenv("GROK_MONGO_DATABASE", "grok")
+		defer os.Unsetenv("GROK_MONGO_DATABASE")
+
+		_, err := grok.LoadSettings("")
+
+		assert.EqualError(t, err, "missing required settings: api, mongo.connection_string, gcp")
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		_, err := grok.LoadSettings("")
+		assert.EqualError(t, err, "missing required settings: api, mongo, gcp")
+
+		file, err := ioutil.TempFile("", "settings-*.yaml")
+		assert.NoError(t, err)
+		defer os.Remove(file.Name())
+		file.Close()
+
+		_, err = grok.LoadSettings(file.Name())
+		assert.EqualError(t, err, "missing required settings: api, mongo, gcp")
+	})
+}
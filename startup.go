@@ -0,0 +1,124 @@
+package grok
+
+import (
+	"context"
+	"sync"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// DefaultStartupConcurrency is how many subscribers Service sets up at once by default.
+const DefaultStartupConcurrency = 8
+
+// SetupSubscriber is a Subscriber with resources to create or verify before running,
+// which Service sets up concurrently, see WithStartupConcurrency.
+type SetupSubscriber interface {
+	Subscriber
+	Setup(ctx context.Context) error
+}
+
+// WithStartupConcurrency bounds how many subscribers Service sets up at once, creating
+// or verifying their topics and subscriptions - default DefaultStartupConcurrency.
+func WithStartupConcurrency(n int) ServiceOption {
+	return func(s *Service) {
+		s.startupConcurrency = n
+	}
+}
+
+// Setup creates or verifies the subscription and the retry topic, so Run only receives.
+// It is called by Run when it was not called before. Subscribers of a message bus have
+// nothing to set up.
+func (s *PubSubSubscriber) Setup(ctx context.Context) error {
+	if s.bus != nil {
+		return nil
+	}
+
+	_, err := s.setup(ctx)
+	return err
+}
+
+func (s *PubSubSubscriber) setup(ctx context.Context) (*pubsub.Subscription, error) {
+	s.setupMu.Lock()
+	defer s.setupMu.Unlock()
+
+	if s.prepared != nil {
+		return s.prepared, nil
+	}
+
+	subscription, err := s.subscription(ctx)
+
+	if err != nil {
+		s.log.WithError(err).
+			Errorf("error starting %s", s.subscriberID)
+		return nil, err
+	}
+
+	if s.retryTopic {
+		if err := s.createRetryTopic(ctx); err != nil {
+			s.log.WithError(err).
+				Errorf("error creating retry topic %s", s.RetryTopicID())
+			return nil, err
+		}
+	}
+
+	s.prepared = subscription
+
+	return subscription, nil
+}
+
+// setupSubscribers sets up the subscribers implementing SetupSubscriber, at most
+// startupConcurrency at once, aggregating the errors. No setup is started once ctx is done.
+func (s *Service) setupSubscribers(ctx context.Context) error {
+	concurrency := s.startupConcurrency
+
+	if concurrency <= 0 {
+		concurrency = DefaultStartupConcurrency
+	}
+
+	sem := make(chan struct{}, concurrency)
+	wg := new(sync.WaitGroup)
+	mu := new(sync.Mutex)
+	errs := multiError{}
+
+	for _, subscriber := range s.subscribers {
+		setup, ok := subscriber.(SetupSubscriber)
+
+		if !ok {
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		if ctx.Err() != nil {
+			wg.Wait()
+
+			if len(errs) == 0 {
+				return ctx.Err()
+			}
+
+			return append(errs, ctx.Err())
+		}
+
+		wg.Add(1)
+
+		go func(setup SetupSubscriber) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := setup.Setup(ctx); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(setup)
+	}
+
+	wg.Wait()
+
+	return errs.err()
+}
@@ -0,0 +1,46 @@
+package grok
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type flushWriter struct {
+	ctx    context.Context
+	writer gin.ResponseWriter
+}
+
+func (w *flushWriter) Write(b []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := w.writer.Write(b)
+	w.writer.Flush()
+
+	return n, err
+}
+
+// Stream writes the output of producer to the client as it is produced, without
+// buffering it. Writes fail once the client disconnects, so producer should stop on
+// the first write error. The response body is not kept for the access log.
+func Stream(c *gin.Context, contentType string, producer func(io.Writer) error) error {
+	if w, ok := c.Writer.(*bodyLogWriter); ok {
+		w.streaming = true
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+
+	err := producer(&flushWriter{ctx: c.Request.Context(), writer: c.Writer})
+
+	if err != nil {
+		c.Error(err)
+	}
+
+	return err
+}
@@ -1,32 +1,201 @@
 package grok
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
+	"regexp"
+	"runtime/debug"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"cloud.google.com/go/pubsub"
 
+	"github.com/patrickmn/go-cache"
 	"github.com/sirupsen/logrus"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+const (
+	// DefaultSubscriberPublishTimeout bounds the retry and dlq publishes of a subscriber,
+	// so a stuck publish cannot block message processing.
+	DefaultSubscriberPublishTimeout = 10 * time.Second
+)
+
+// Delivery is what a MessageHandler receives for each message.
+type Delivery struct {
+	Body    interface{}
+	Message *pubsub.Message
+	Event   *CloudEvent
+
+	// Extend pushes the handler deadline to d from now. The client library keeps the
+	// message leased until MaxExtension from the receipt, which also caps Extend.
+	Extend func(d time.Duration)
+
+	// Publisher is the subscriber producer, to publish follow-up messages before
+	// returning nil to ack the message. When publishing fails return the error to
+	// retry the message. This is at least once, not transactional: follow-ups are
+	// published again when the message is retried after a partial success, or when
+	// the ack is lost, so their consumers must be idempotent. Follow-ups are not
+	// ordered with the messages of other handlers.
+	Publisher Publisher
+}
+
+// Disposition is what ProcessMessage did with a message.
+type Disposition string
+
+const (
+	// DispositionAck means the message was handled.
+	DispositionAck Disposition = "ack"
+	// DispositionRetry means the message failed and was republished for a retry.
+	DispositionRetry Disposition = "retry"
+	// DispositionDLQ means the message could not be decoded, panicked or exhausted its retries.
+	DispositionDLQ Disposition = "dlq"
+	// DispositionDrop means the message would go to the dlq, but it is disabled and the message was acked.
+	DispositionDrop Disposition = "drop"
+	// DispositionNack means the message was nacked to be redelivered, because the subscriber
+	// is shutting down, the dlq publish failed or the message would go to a disabled dlq.
+	DispositionNack Disposition = "nack"
+	// DispositionExpired means the message was older than WithMaxMessageAge and was acked without handling.
+	DispositionExpired Disposition = "expired"
+)
+
+// ExhaustedPolicy is what happens to messages that would go to a disabled dlq.
+type ExhaustedPolicy int
+
+const (
+	// ExhaustedDrop acks and logs the message. The message is lost.
+	ExhaustedDrop ExhaustedPolicy = iota
+	// ExhaustedNack nacks the message, so it is redelivered until it succeeds or
+	// expires from the subscription, blocking the subscription's capacity meanwhile.
+	ExhaustedNack
+)
+
+// PanicPolicy is what happens to messages whose handler panics.
+type PanicPolicy int
+
+const (
+	// PanicDeadLetter sends the message to the dlq without retrying it.
+	PanicDeadLetter PanicPolicy = iota
+	// PanicRetry handles the panic as a returned error, retrying the message up to the max
+	// retries before sending it to the dlq. A panic that is not transient panics on every
+	// retry, so the message is handled max retries times before reaching the dlq.
+	PanicRetry
+)
+
+// Publisher publishes the retries and dead letters of a subscriber. topicID is a topic id
+// or, for topics owned by another project, a projects/<project>/topics/<id> name.
+type Publisher interface {
+	PublishWihAttribrutes(topicID string, data interface{}, attributes map[string]string) error
+	PublishRaw(topicID string, data []byte, attributes map[string]string) error
+}
+
+// MessageHandler ...
+type MessageHandler func(ctx context.Context, delivery *Delivery) error
+
 // PubSubSubscriber ...
 type PubSubSubscriber struct {
+	droppedEvents int64 // first for 64-bit atomic alignment
+
 	client                 *pubsub.Client
-	handler                func(interface{}) error
+	bus                    MessageBus
+	handler                MessageHandler
 	subscriberID           string
 	topicID                string
 	handleType             reflect.Type
 	maxRetries             int
-	producer               *PubSubProducer
+	producer               Publisher
 	maxRetriesAttribute    string
 	maxOutstandingMessages int
 	ackDeadline            time.Duration
+	restartAttempts        int
+	restartBackoff         time.Duration
+	deadlineMargin         time.Duration
+	noTopicAutoCreate      bool
+	topicProject           string
+	traceProject           string
+	handlerTimeout         time.Duration
+	existing               bool
+	existingSubscription   *pubsub.Subscription
+	cloudEvents            bool
+	maxExtension           time.Duration
+	maxDecompressedSize    int64
+	configLogLevel         logrus.Level
+	resourcePrefix         string
+	errorLogRetries        int
+	noDLQ                  bool
+	exhaustedPolicy        ExhaustedPolicy
+	paused                 int32
+	receiving              int32
+	recordBatching         bool
+	dlqRetries             int
+	dlqBackoff             time.Duration
+	gracePeriod            time.Duration
+	graceUntil             time.Time
+	serial                 bool
+	serialMu               sync.Mutex
+	metrics                bool
+	schemaVersion          string
+	nonDLQErrors           []func(error) bool
+	nonDLQMaxRetries       int
+	nonDLQBackoff          time.Duration
+	reconcile              bool
+	retention              time.Duration
+	labels                 map[string]string
+	events                 chan<- SubscriberEvent
+	retryTopic             bool
+	retryDelay             time.Duration
+	useNumber              bool
+	codec                  Codec
+	decrypt                DecryptFunc
+	dlqRouter              DLQRouter
+	idempotencyKey         func(*pubsub.Message) string
+	maxMessageAge          time.Duration
+	errorReporter          ErrorReporter
+	retainAcked            bool
+	panicPolicy            PanicPolicy
+	maxAgeExempt           func(*pubsub.Message) bool
+	setupMu                sync.Mutex
+	prepared               *pubsub.Subscription
+	log                    *logrus.Entry
+	allowEmptyPayload      bool
+	dedupAttribute         string
+	dedupCache             *cache.Cache
+	dedupTTL               time.Duration
+	beforeProcess          BeforeProcessHook
+	afterProcess           AfterProcessHook
+	deadLetterSink         DeadLetterSink
+	fallbackSink           func(DeadLetterMessage) error
+	decodePool             *sync.Pool
+	noDLQTopic             bool
+
+	closer      closer
+	ownsClient  bool
+	closed      bool
+	cancel      context.CancelFunc
+	done        chan struct{}
+	lifecycleMu sync.Mutex
 }
 
+var (
+	// ErrHandlerTimeout ...
+	ErrHandlerTimeout = errors.New("handler timeout")
+	// ErrNoClient is returned by Run when the subscriber has neither a client nor a
+	// message bus, see WithClient and WithMessageBus.
+	ErrNoClient = errors.New("pubsub client is required")
+)
+
+var projectIDPattern = regexp.MustCompile(`^[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+
 // PubSubSubscriberOption ...
 type PubSubSubscriberOption func(*PubSubSubscriber)
 
@@ -36,13 +205,49 @@ func NewPubSubSubscriber(opts ...PubSubSubscriberOption) *PubSubSubscriber {
 	subscriber.maxRetries = 5
 	subscriber.maxOutstandingMessages = pubsub.DefaultReceiveSettings.MaxOutstandingMessages
 	subscriber.ackDeadline = 10 * time.Second
+	subscriber.deadlineMargin = time.Second
+	subscriber.maxExtension = pubsub.DefaultReceiveSettings.MaxExtension
+	subscriber.errorLogRetries = -1
+	subscriber.dlqRetries = 2
+	subscriber.dlqBackoff = 100 * time.Millisecond
+	subscriber.nonDLQMaxRetries = 100
+	subscriber.nonDLQBackoff = time.Second
+	subscriber.retryDelay = time.Second
+	subscriber.maxDecompressedSize = DefaultMaxDecompressedSize
+	subscriber.configLogLevel = DefaultConfigLogLevel
 
 	for _, opt := range opts {
 		opt(subscriber)
 	}
 
+	if subscriber.errorLogRetries < 0 {
+		subscriber.errorLogRetries = subscriber.maxRetries
+	}
+
+	if subscriber.subscriberID != "" {
+		subscriber.subscriberID = subscriber.resourcePrefix + subscriber.subscriberID
+	}
+
+	if subscriber.topicID != "" {
+		subscriber.topicID = subscriber.resourcePrefix + subscriber.topicID
+	}
+
+	subscriber.log = logrus.WithFields(logrus.Fields{
+		"subscription": subscriber.subscriberID,
+		"topic":        subscriber.topicID,
+	})
+
 	subscriber.maxRetriesAttribute = "retries"
-	subscriber.producer = NewPubSubProducer(subscriber.client)
+
+	if subscriber.producer == nil && subscriber.bus != nil {
+		subscriber.producer = subscriber.bus
+	}
+
+	if subscriber.producer == nil {
+		subscriber.producer = NewPubSubProducer(subscriber.client,
+			WithPublishTimeout(DefaultSubscriberPublishTimeout),
+			WithProducerMetadata("grok", libraryVersion()))
+	}
 
 	return subscriber
 }
@@ -56,11 +261,37 @@ func WithClient(c *pubsub.Client) PubSubSubscriberOption {
 
 // WithHandler ...
 func WithHandler(h func(interface{}) error) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.handler = func(ctx context.Context, delivery *Delivery) error {
+			return h(delivery.Body)
+		}
+	}
+}
+
+// WithMessageHandler sets a handler that also receives the raw message and a context.
+// The context expires at the ack deadline minus the deadline margin; handlers exceeding
+// it risk the message being redelivered while they are still processing it.
+func WithMessageHandler(h MessageHandler) PubSubSubscriberOption {
 	return func(s *PubSubSubscriber) {
 		s.handler = h
 	}
 }
 
+// WithDeadlineMargin - default 1s
+func WithDeadlineMargin(d time.Duration) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.deadlineMargin = d
+	}
+}
+
+// WithMaxExtension - default 10m. It bounds how long the library extends the lease
+// of a message and so how far a handler can call Delivery.Extend.
+func WithMaxExtension(d time.Duration) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.maxExtension = d
+	}
+}
+
 // WithPubSubSubscriberID ...
 func WithPubSubSubscriberID(id string) PubSubSubscriberOption {
 	return func(s *PubSubSubscriber) {
@@ -75,9 +306,15 @@ func WithTopicID(t string) PubSubSubscriberOption {
 	}
 }
 
-// WithType ...
+// WithType sets the type messages are decoded into. Without it handlers receive the raw []byte.
+// Handlers always receive a pointer to t, reflect.TypeOf(Order{}) and reflect.TypeOf(&Order{})
+// both deliver an *Order.
 func WithType(t reflect.Type) PubSubSubscriberOption {
 	return func(s *PubSubSubscriber) {
+		for t != nil && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
 		s.handleType = t
 	}
 }
@@ -89,6 +326,15 @@ func WithMaxRetries(maxRetries int) PubSubSubscriberOption {
 	}
 }
 
+// WithErrorLogThreshold logs handler errors at Warn until the message was retried
+// retries times, then at Error. Default is the max retries, so only the attempt
+// sending the message to the dlq is logged at Error.
+func WithErrorLogThreshold(retries int) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.errorLogRetries = retries
+	}
+}
+
 //WithMaxOutstandingMessages ...
 func WithMaxOutstandingMessages(maxOutstandingMessages int) PubSubSubscriberOption {
 	return func(s *PubSubSubscriber) {
@@ -103,131 +349,932 @@ func WithAckDeadline(t time.Duration) PubSubSubscriberOption {
 	}
 }
 
+// WithAutoRestart restarts Receive up to maxAttempts times when it fails with a
+// transient error, doubling backoff between attempts up to a minute. Fatal errors, such as
+// a PermissionError or errors not coming from the PubSub service, are returned immediately.
+func WithAutoRestart(maxAttempts int, backoff time.Duration) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.restartAttempts = maxAttempts
+		s.restartBackoff = backoff
+	}
+}
+
+// WithHandlerTimeout fails messages whose handler runs longer than d, so they are retried
+// or sent to the dlq. The message lease is extended to d, but never past WithMaxExtension,
+// which caps the effective timeout. When the timeout fires the handler context is cancelled
+// and the handler goroutine is abandoned: a handler ignoring its context keeps running
+// while the message is already being retried.
+func WithHandlerTimeout(d time.Duration) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.handlerTimeout = d
+	}
+}
+
+// WithNoTopicAutoCreate makes Run fail when the topic does not exist instead of creating it.
+// The subscription is still created when missing.
+func WithNoTopicAutoCreate() PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.noTopicAutoCreate = true
+	}
+}
+
+// WithTopicProject subscribes to a topic owned by another project.
+// The subscription is still created in the client's project and the topic is never created.
+// Retries are republished to the topic in its project, while the dlq and retry topics are
+// created in the client's project.
+func WithTopicProject(projectID string) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.topicProject = projectID
+	}
+}
+
+// WithExistingSubscription receives from a subscription managed outside the application.
+// The subscription is never created nor changed, only the receive settings are applied.
+// Unless given, the subscription and topic ids are read from the subscription when it is
+// set up. WithClient is still required to publish retries and dead letters.
+func WithExistingSubscription(subscription *pubsub.Subscription) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.existing = true
+		s.existingSubscription = subscription
+	}
+}
+
+// WithResourcePrefix prefixes the topic, subscription and dlq names, e.g. "staging-"
+// subscribes staging-orders with WithTopicID("orders"). Producers publishing to the
+// topic must use WithProducerResourcePrefix with the same prefix.
+func WithResourcePrefix(prefix string) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.resourcePrefix = prefix
+	}
+}
+
+// TopicName returns the fully qualified name of the subscribed topic, or its id when
+// receiving from a message bus.
+func (s *PubSubSubscriber) TopicName() string {
+	if s.bus != nil {
+		return s.topicID
+	}
+
+	return s.topic().String()
+}
+
+// SubscriptionID returns the subscription id, including the resource prefix.
+func (s *PubSubSubscriber) SubscriptionID() string {
+	return s.subscriberID
+}
+
+// WithStartupGracePeriod retries failed messages regardless of their retries for d after
+// Run starts, so failures while dependencies warm up do not reach the dlq.
+func WithStartupGracePeriod(d time.Duration) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.gracePeriod = d
+	}
+}
+
+// WithSerialProcessing runs one handler at a time, for handlers holding non-reentrant
+// resources. Messages are still prefetched up to the max outstanding messages, but
+// throughput is bounded by the handler latency, e.g. 50ms handlers process 20 msg/s.
+func WithSerialProcessing() PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.serial = true
+	}
+}
+
+// WithSchemaVersion stamps dead letters with the payload schema version, so ReplayDLQ
+// can migrate them after the schema changes.
+func WithSchemaVersion(version string) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.schemaVersion = version
+	}
+}
+
+// WithPublisher replaces the producer used for retries and dead letters,
+// by default a PubSubProducer of the subscriber client.
+func WithPublisher(p Publisher) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.producer = p
+	}
+}
+
+// WithDLQPublishRetries - default 2. Retries failed dlq publishes doubling a 100ms
+// backoff; when every attempt fails, or the subscriber stops while waiting, the
+// message is nacked to be redelivered.
+func WithDLQPublishRetries(n int) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.dlqRetries = n
+	}
+}
+
+// WithUseNumber decodes numbers of interface{} values, e.g. map[string]interface{} types,
+// as json.Number instead of float64, which loses precision beyond 2^53.
+// Handled struct types with typed fields, such as int64, are not affected.
+func WithUseNumber() PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.useNumber = true
+	}
+}
+
+// WithAllowEmptyPayload handles messages without data, e.g. attributes only signals,
+// with a zero value body instead of sending them to the dlq for failing to decode.
+func WithAllowEmptyPayload() PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.allowEmptyPayload = true
+	}
+}
+
+// WithNonDLQErrors retries errors matching any of the matchers past the max retries,
+// backing off before each retry, e.g. errors of an unavailable dependency.
+// A message failing forever with these errors is stuck retrying until it reaches
+// the non dlq max retries, only then it is sent to the dlq.
+func WithNonDLQErrors(matchers ...func(error) bool) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.nonDLQErrors = append(s.nonDLQErrors, matchers...)
+	}
+}
+
+// WithNonDLQMaxRetries - default 100. Ceiling of retries for errors matching WithNonDLQErrors.
+func WithNonDLQMaxRetries(retries int) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.nonDLQMaxRetries = retries
+	}
+}
+
+// WithNonDLQBackoff - default 1s. Backoff before retrying errors matching WithNonDLQErrors
+// past the max retries, doubled on each retry up to a minute.
+func WithNonDLQBackoff(d time.Duration) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.nonDLQBackoff = d
+	}
+}
+
+// WithoutDLQ disables the dlq. Messages exhausting their retries, failing to decode
+// or panicking are handled by the exhausted policy, dropped by default.
+func WithoutDLQ() PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.noDLQ = true
+	}
+}
+
+// WithExhaustedPolicy sets what happens to messages when the dlq is disabled - default ExhaustedDrop.
+func WithExhaustedPolicy(policy ExhaustedPolicy) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.exhaustedPolicy = policy
+	}
+}
+
+// WithPanicPolicy sets what happens to messages whose handler panics - default PanicDeadLetter.
+func WithPanicPolicy(policy PanicPolicy) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.panicPolicy = policy
+	}
+}
+
+// DLQTopicID returns the id of the topic failed messages are sent to.
+func (s *PubSubSubscriber) DLQTopicID() string {
+	return fmt.Sprintf("%s_dlq", s.topicID)
+}
+
 // Run ...
 func (s *PubSubSubscriber) Run(ctx context.Context) error {
-	subscriber, err := createSubscriptionIfNotExists(s.client, s.subscriberID, s.topicID, s.ackDeadline)
-	subscriber.ReceiveSettings.MaxOutstandingMessages = s.maxOutstandingMessages
+	ctx, stop, err := s.start(ctx)
 
 	if err != nil {
-		logrus.WithError(err).
-			Errorf("error starting %s", s.subscriberID)
 		return err
 	}
 
-	logrus.Infof("starting consumer %s with topic %s", s.subscriberID, s.topicID)
-	return subscriber.Receive(ctx, func(c context.Context, message *pubsub.Message) {
-		body := reflect.New(s.handleType).Interface()
-		err := json.Unmarshal(message.Data, body)
+	defer stop()
 
-		if err != nil {
-			logrus.WithError(err).WithField("content", string(message.Data)).
-				Errorf("cannot unmarshal message %s - sending to dlq", message.ID)
+	if err := s.Setup(ctx); err != nil {
+		return err
+	}
+
+	atomic.StoreInt32(&s.receiving, 1)
+	defer atomic.StoreInt32(&s.receiving, 0)
+
+	s.log.Infof("starting consumer %s with topic %s", s.subscriberID, s.topicID)
+	s.logConfig()
+
+	if s.gracePeriod > 0 {
+		s.graceUntil = time.Now().Add(s.gracePeriod)
+		s.log.Infof("consumer %s startup grace period of %s started", s.subscriberID, s.gracePeriod)
+
+		graceEnd := time.AfterFunc(s.gracePeriod, func() {
+			s.log.Infof("consumer %s startup grace period ended", s.subscriberID)
+		})
 
-			s.dlq(message, err)
+		defer graceEnd.Stop()
+	}
+
+	return s.messageBus().Receive(ctx, s.subscriberID, s.topicID, s.receive)
+}
+
+// Pause nacks new deliveries, so they are redelivered after Resume, without tearing
+// down the subscription. Messages already being processed are not affected.
+func (s *PubSubSubscriber) Pause() {
+	if atomic.CompareAndSwapInt32(&s.paused, 0, 1) {
+		s.log.Infof("consumer %s paused", s.subscriberID)
+		s.record(context.Background(), SubscriberPaused.M(1))
+	}
+}
+
+// Resume processes deliveries again after Pause.
+func (s *PubSubSubscriber) Resume() {
+	if atomic.CompareAndSwapInt32(&s.paused, 1, 0) {
+		s.log.Infof("consumer %s resumed", s.subscriberID)
+		s.record(context.Background(), SubscriberPaused.M(0))
+	}
+}
+
+// Paused ...
+func (s *PubSubSubscriber) Paused() bool {
+	return atomic.LoadInt32(&s.paused) == 1
+}
+
+func (s *PubSubSubscriber) receive(c context.Context, message *pubsub.Message, ack Acknowledger) {
+	if s.Paused() {
+		ack.Nack()
+		return
+	}
 
-			message.Ack()
-			return
+	started := time.Now()
+	disposition := s.ProcessMessage(c, message)
+
+	if disposition == DispositionNack {
+		s.log.
+			WithField("elapsed", time.Since(started)).
+			Infof("sending nack to message %s", message.ID)
+
+		ack.Nack()
+		return
+	}
+
+	elapsed := time.Since(started)
+
+	s.log.
+		WithField("elapsed", elapsed).
+		WithField("disposition", disposition).
+		Infof("sending ack to message %s", message.ID)
+
+	// Acks are fire and forget in this client version, there is no ack result to check.
+	// An ack sent after the lease stopped being extended is the likely failure, so it is
+	// reported to explain the redelivery that follows.
+	if s.maxExtension > 0 && elapsed > s.maxExtension {
+		s.log.
+			WithField("elapsed", elapsed).
+			WithField("max_extension", s.maxExtension).
+			Warnf("ack to message %s sent after the max extension - it will likely be redelivered", message.ID)
+
+		s.record(c, LateAcks.M(1))
+	}
+
+	ack.Ack()
+}
+
+// ProcessMessage decodes and handles the message, retrying or sending it to the dlq
+// when it fails. It does not ack the message, Run acks or nacks it depending on the
+// disposition, so it can be called with a crafted message in tests.
+func (s *PubSubSubscriber) ProcessMessage(c context.Context, message *pubsub.Message) (disposition Disposition) {
+	disposition = DispositionAck
+	c, span := s.startSpan(c, message)
+
+	if s.events != nil {
+		start := time.Now()
+		retries := s.getRetries(message)
+
+		defer func() {
+			s.emit(SubscriberEvent{
+				MessageID: message.ID,
+				Outcome:   disposition,
+				Retries:   retries,
+				Duration:  time.Since(start),
+			})
+		}()
+	}
+
+	defer func() {
+		if span != nil {
+			span.AddAttributes(trace.StringAttribute("outcome", string(disposition)))
+			span.End()
 		}
+	}()
+
+	if s.beforeProcess != nil {
+		c = s.before(c, message)
+	}
 
+	if s.expired(message) {
+		s.log.WithField("published_at", publishedAt(message)).
+			WithField("max_age", s.maxMessageAge).
+			Warnf("message %s expired - dropping", message.ID)
+
+		s.record(c, ExpiredMessages.M(1))
+
+		return DispositionExpired
+	}
+
+	var err error
+
+	if s.afterProcess != nil {
 		defer func() {
-			if recover(); err != nil {
-				logrus.WithField("error", err).WithField("content", string(message.Data)).
-					Warnf("consumer panicked with message %s - sending to dlq", message.ID)
+			s.after(c, message, disposition, err)
+		}()
+	}
+
+	body, event, err := s.decode(c, message)
+
+	if err != nil {
+		s.log.WithError(err).WithField("content", string(message.Data)).
+			Errorf("cannot unmarshal message %s - sending to dlq", message.ID)
 
-				s.dlq(message, err)
+		return s.deadLetter(c, message, err)
+	}
+
+	if s.pooled() {
+		defer s.releaseBody(body)
+	}
 
-				message.Ack()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+
+			action := "sending to dlq"
+
+			if s.panicPolicy == PanicRetry {
+				action = "retrying"
+			}
+
+			s.log.WithField("error", err).WithField("content", string(message.Data)).
+				Warnf("consumer panicked with message %s - %s", message.ID, action)
+
+			if s.errorReporter != nil {
+				s.errorReporter.Report(c, err, map[string]interface{}{
+					"message_id":   message.ID,
+					"subscription": s.subscriberID,
+					"topic":        s.topicID,
+					"stack":        string(debug.Stack()),
+				})
 			}
-		}()
 
-		started := time.Now()
+			if s.panicPolicy == PanicRetry {
+				disposition = s.failed(c, message, err)
+				return
+			}
+
+			disposition = s.deadLetter(c, message, err)
+		}
+	}()
+
+	s.log.WithFields(s.traceFields(span)).
+		Infof("processing message %s", message.ID)
 
-		logrus.Infof("processing message %s", message.ID)
+	if s.duplicate(message) {
+		s.log.Infof("skipping duplicate message %s", message.ID)
+		return DispositionAck
+	}
+
+	if tenant := message.Attributes[TenantAttribute]; tenant != "" {
+		c = ContextWithTenant(c, tenant)
+	}
 
-		err = s.handler(body)
+	c = s.withIdempotencyKey(c, message)
+
+	err = s.run(c, &Delivery{Body: body, Message: message, Event: event, Publisher: s.producer})
+
+	if err != nil && c.Err() != nil {
+		s.log.WithError(err).
+			Infof("processing message %s interrupted by shutdown - it will be redelivered", message.ID)
+
+		return DispositionNack
+	}
+
+	if err != nil {
+		return s.failed(c, message, err)
+	}
+
+	s.markHandled(message)
+
+	if retries := s.getRetries(message); retries > 0 {
+		s.log.WithFields(logrus.Fields{
+			"event":   "recovered_after_retry",
+			"retries": retries,
+		}).Infof("message %s recovered after %d retries", message.ID, retries)
+
+		s.record(c, RecoveredMessages.M(1), tag.Upsert(KeyRetries, retriesBucket(retries)))
+	}
+
+	return DispositionAck
+}
+
+// failed retries the message that failed with err, or sends it to the dlq when its
+// retries are exhausted.
+func (s *PubSubSubscriber) failed(c context.Context, message *pubsub.Message, err error) Disposition {
+	retries := s.getRetries(message)
+	entry := s.log.WithError(err).
+		WithField("retries", retries).
+		WithField("max_retries", s.maxRetries)
+
+	if retries >= s.maxRetries || retries >= s.errorLogRetries {
+		entry.Errorf("error processing message %s", message.ID)
+	} else {
+		entry.Warnf("error processing message %s", message.ID)
+	}
+
+	maxRetries := s.maxRetries
+	nonDLQ := s.nonDLQError(err)
+
+	if nonDLQ {
+		maxRetries = s.nonDLQMaxRetries
+	}
+
+	if retries >= maxRetries && time.Now().After(s.graceUntil) {
+		return s.deadLetter(c, message, err)
+	}
+
+	if nonDLQ && retries >= s.maxRetries && !s.backoff(c, retries-s.maxRetries) {
+		return DispositionNack
+	}
+
+	if retryErr := s.retry(message); retryErr != nil {
+		if s.fallbackSink == nil {
+			s.log.WithError(retryErr).
+				Errorf("error retrying message %s - nacking it", message.ID)
+			return DispositionNack
+		}
+
+		s.log.WithError(retryErr).
+			Errorf("error retrying message %s - sending to dlq", message.ID)
+
+		return s.deadLetter(c, message, fmt.Errorf("retry failed: %v: %w", retryErr, err))
+	}
+
+	return DispositionRetry
+}
+
+func (s *PubSubSubscriber) subscription(ctx context.Context) (*pubsub.Subscription, error) {
+	if s.client == nil {
+		return nil, ErrNoClient
+	}
+
+	if s.existing {
+		return s.useExistingSubscription(ctx)
+	}
+
+	if s.topicProject != "" && !projectIDPattern.MatchString(s.topicProject) {
+		return nil, fmt.Errorf("invalid topic project id %q", s.topicProject)
+	}
+
+	return s.createSubscriptionIfNotExists(ctx)
+}
+
+// useExistingSubscription reads the ids not given from the existing subscription, so
+// retries, dead letters and logs name the actual topic and subscription.
+func (s *PubSubSubscriber) useExistingSubscription(ctx context.Context) (*pubsub.Subscription, error) {
+	subscription := s.existingSubscription
+
+	if subscription == nil {
+		return nil, errors.New("existing subscription is nil")
+	}
+
+	if s.subscriberID == "" {
+		s.subscriberID = subscription.ID()
+	}
+
+	if s.topicID == "" {
+		config, err := subscription.Config(ctx)
 
 		if err != nil {
-			logrus.WithError(err).
-				Errorf("error processing message %s", message.ID)
-
-			switch s.getRetries(message) >= s.maxRetries {
-			case true:
-				if err := s.dlq(message, err); err != nil {
-					logrus.WithError(err).
-						Errorf("error sending message %s to dlq", message.ID)
-				}
-				break
-			case false:
-				if err := s.retry(message, body); err != nil {
-					logrus.WithError(err).
-						Errorf("error retrying message %s", message.ID)
-				}
-				break
-			}
+			return nil, permissionError(err, subscription.String(), "roles/pubsub.viewer")
 		}
 
-		logrus.
-			WithField("elapsed", time.Since(started)).
-			Infof("sending ack to message %s", message.ID)
+		s.topicID = config.Topic.ID()
+
+		if match := topicNamePattern.FindStringSubmatch(config.Topic.String()); match != nil &&
+			!strings.HasPrefix(subscription.String(), "projects/"+match[1]+"/") {
+			s.topicProject = match[1]
+		}
+	}
 
-		message.Ack()
+	s.log = s.log.WithFields(logrus.Fields{
+		"subscription": s.subscriberID,
+		"topic":        s.topicID,
 	})
+
+	return subscription, nil
 }
 
-func createSubscriptionIfNotExists(client *pubsub.Client, subscriberID, topicID string, ackDeadline time.Duration) (*pubsub.Subscription, error) {
-	subscriber := client.Subscription(subscriberID)
+func (s *PubSubSubscriber) createSubscriptionIfNotExists(ctx context.Context) (*pubsub.Subscription, error) {
+	subscriber := s.client.Subscription(s.subscriberID)
 
-	exists, err := subscriber.Exists(context.Background())
+	exists, err := subscriber.Exists(ctx)
 
-	if err != nil || exists {
-		return subscriber, err
+	if err != nil {
+		return nil, permissionError(err, subscriber.String(), "roles/pubsub.viewer")
 	}
 
-	topic, err := createTopicIfNotExists(client, topicID)
+	if exists {
+		if s.reconcile {
+			return subscriber, s.reconcileSubscription(ctx, subscriber)
+		}
+
+		return subscriber, nil
+	}
+
+	topic, err := s.subscriptionTopic(ctx)
 
 	if err != nil {
-		logrus.WithError(err).
-			Errorf("error creating topic %s", topicID)
+		s.log.WithError(err).
+			Errorf("error creating topic %s", s.topicID)
 		return nil, err
 	}
 
-	subscriber, err = client.CreateSubscription(context.Background(), subscriberID, pubsub.SubscriptionConfig{
-		Topic:       topic,
-		AckDeadline: ackDeadline,
+	subscriber, err = s.client.CreateSubscription(ctx, s.subscriberID, pubsub.SubscriptionConfig{
+		Topic:               topic,
+		AckDeadline:         s.ackDeadline,
+		RetentionDuration:   s.retention,
+		RetainAckedMessages: s.retainAcked,
+		Labels:              s.labels,
 	})
 
+	if status.Code(err) == codes.AlreadyExists {
+		return s.client.Subscription(s.subscriberID), nil
+	}
+
 	if err != nil {
-		logrus.WithError(err).
-			Errorf("error creating subscription %s", subscriberID)
+		err = permissionError(err, s.client.Subscription(s.subscriberID).String(), "roles/pubsub.editor")
+		s.log.WithError(err).
+			Errorf("error creating subscription %s", s.subscriberID)
 		return nil, err
 	}
 	return subscriber, nil
 }
 
-func (s *PubSubSubscriber) retry(message *pubsub.Message, body interface{}) error {
+func (s *PubSubSubscriber) topic() *pubsub.Topic {
+	if s.topicProject != "" {
+		return s.client.TopicInProject(s.topicID, s.topicProject)
+	}
+
+	return s.client.Topic(s.topicID)
+}
+
+// retryTarget is what retries are republished to: the topic id, or the fully qualified
+// topic name when the topic is owned by another project.
+func (s *PubSubSubscriber) retryTarget() string {
+	if s.topicProject != "" {
+		return s.TopicName()
+	}
+
+	return s.topicID
+}
+
+func (s *PubSubSubscriber) subscriptionTopic(ctx context.Context) (*pubsub.Topic, error) {
+	if s.topicProject != "" {
+		return s.topic(), nil
+	}
+
+	if !s.noTopicAutoCreate {
+		return createTopicIfNotExists(ctx, s.client, s.topicID)
+	}
+
+	topic := s.topic()
+	exists, err := topic.Exists(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, fmt.Errorf("topic %s does not exist and auto creation is disabled", topic)
+	}
+
+	return topic, nil
+}
+
+func (s *PubSubSubscriber) nonDLQError(err error) bool {
+	for _, matches := range s.nonDLQErrors {
+		if matches(err) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// backoff waits the non dlq backoff doubled attempt times, capped to a minute.
+// It returns false when ctx is done before.
+func (s *PubSubSubscriber) backoff(ctx context.Context, attempt int) bool {
+	return sleep(ctx, backoffDelay(s.nonDLQBackoff, attempt, time.Minute))
+}
+
+// sleep waits for d, returning false when ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func backoffDelay(base time.Duration, attempt int, max time.Duration) time.Duration {
+	delay := base
+
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+
+	if delay > max {
+		delay = max
+	}
+
+	return delay
+}
+
+// retryStrippedAttributes are debugging attributes, e.g. set when sending to the dlq,
+// dropped on retry so messages cycling through retries and replays don't accumulate them.
+var retryStrippedAttributes = []string{"error", "error_json", "stack"}
+
+// retry republishes the original data, byte for byte, with the retries incremented.
+func (s *PubSubSubscriber) retry(message *pubsub.Message) error {
 	retries := s.getRetries(message)
 	retries++
 
-	message.Attributes[s.maxRetriesAttribute] = strconv.Itoa(retries)
+	attributes := make(map[string]string, len(message.Attributes)+1)
 
-	return s.producer.PublishWihAttribrutes(s.topicID, body, message.Attributes)
+	for k, v := range message.Attributes {
+		attributes[k] = v
+	}
+
+	for _, k := range retryStrippedAttributes {
+		delete(attributes, k)
+	}
+
+	attributes[s.maxRetriesAttribute] = strconv.Itoa(retries)
+
+	if _, ok := attributes[PublishedAtAttribute]; !ok && !message.PublishTime.IsZero() {
+		attributes[PublishedAtAttribute] = strconv.FormatInt(message.PublishTime.UnixNano()/int64(time.Millisecond), 10)
+	}
+
+	if s.retryTopic {
+		notBefore := time.Now().Add(backoffDelay(s.retryDelay, retries-1, MaxRetryDelay))
+		attributes[NotBeforeAttribute] = strconv.FormatInt(notBefore.UnixNano()/int64(time.Millisecond), 10)
+
+		return s.producer.PublishRaw(s.RetryTopicID(), message.Data, attributes)
+	}
+
+	return s.producer.PublishRaw(s.retryTarget(), message.Data, attributes)
 }
 
-func (s *PubSubSubscriber) dlq(message *pubsub.Message, e error) error {
-	dlq := fmt.Sprintf("%s_dlq", s.topicID)
+// deadLetter sends the message to the dlq, or applies the exhausted policy when the dlq is disabled.
+func (s *PubSubSubscriber) deadLetter(c context.Context, message *pubsub.Message, e error) Disposition {
+	if s.noDLQ {
+		if s.exhaustedPolicy == ExhaustedNack {
+			s.log.WithError(e).Warnf("dlq disabled - nacking message %s", message.ID)
+			return DispositionNack
+		}
 
-	logrus.Infof("sending message %s to %s", message.ID, dlq)
+		s.log.WithError(e).WithField("content", string(message.Data)).
+			Errorf("dlq disabled - dropping message %s", message.ID)
+		return DispositionDrop
+	}
 
-	_, err := createTopicIfNotExists(s.client, dlq)
+	backoff := s.dlqBackoff
 
-	if err != nil {
-		return err
+	for attempt := 1; ; attempt++ {
+		err := s.dlq(message, e)
+
+		if err == nil {
+			return DispositionDLQ
+		}
+
+		if attempt > s.dlqRetries {
+			if s.fallbackSink != nil {
+				return s.fallback(message, e, err)
+			}
+
+			s.log.WithError(err).
+				Errorf("error sending message %s to dlq - nacking it", message.ID)
+			return DispositionNack
+		}
+
+		s.log.WithError(err).WithField("attempt", attempt).
+			Warnf("error sending message %s to dlq - retrying in %s", message.ID, backoff)
+
+		if !sleep(c, backoff) {
+			s.log.WithError(err).
+				Infof("sending message %s to dlq interrupted by shutdown - it will be redelivered", message.ID)
+			return DispositionNack
+		}
+
+		backoff *= 2
 	}
+}
 
+// deadLetterData returns the data and the dlq attributes of message. The data is kept
+// as received, along with the attributes needed to decrypt and decompress it.
+func (s *PubSubSubscriber) deadLetterData(message *pubsub.Message, e error) ([]byte, map[string]string) {
 	attributes := make(map[string]string)
 	attributes["error"] = e.Error()
 
-	return s.producer.PublishWihAttribrutes(dlq, message.Data, attributes)
+	if chain := marshalErrorChain(e); chain != "" {
+		attributes["error_json"] = chain
+	}
+
+	if s.schemaVersion != "" {
+		attributes[SchemaVersionAttribute] = s.schemaVersion
+	}
+
+	for _, attribute := range []string{EncryptedAttribute, ContentEncodingAttribute} {
+		if value, ok := message.Attributes[attribute]; ok {
+			attributes[attribute] = value
+		}
+	}
+
+	return message.Data, attributes
+}
+
+func (s *PubSubSubscriber) dlq(message *pubsub.Message, e error) error {
+	dlq := s.dlqTopicID(message, e)
+	data, attributes := s.deadLetterData(message, e)
+
+	if s.deadLetterSink != nil {
+		s.log.Infof("storing message %s in dead letter sink", message.ID)
+
+		if err := s.storeDeadLetter(message, data, attributes, e); err != nil {
+			return err
+		}
+
+		if s.noDLQTopic {
+			return nil
+		}
+	}
+
+	s.log.Infof("sending message %s to %s", message.ID, dlq)
+
+	if s.bus == nil {
+		if err := createDLQTopic(context.Background(), s.client, dlq); err != nil {
+			return err
+		}
+	}
+
+	return s.producer.PublishWihAttribrutes(dlq, data, attributes)
+}
+
+// run calls the handler within the message lease, once per record WithRecordBatching.
+func (s *PubSubSubscriber) run(c context.Context, delivery *Delivery) error {
+	if s.serial {
+		s.serialMu.Lock()
+		defer s.serialMu.Unlock()
+	}
+
+	ctx := newLease(c, s.handlerDeadline(), s.maxExtension)
+	defer ctx.release()
+
+	if s.handlerTimeout > 0 {
+		ctx.extend(s.handlerTimeout)
+	}
+
+	delivery.Extend = ctx.extend
+
+	if s.recordBatching {
+		return s.handleRecords(ctx, delivery)
+	}
+
+	return s.handle(ctx, delivery)
+}
+
+func (s *PubSubSubscriber) handle(ctx context.Context, delivery *Delivery) error {
+	if s.handlerTimeout <= 0 {
+		return s.handler(ctx, delivery)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.handlerTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	panics := make(chan interface{}, 1)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				panics <- r
+			}
+		}()
+
+		done <- s.handler(ctx, delivery)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case r := <-panics:
+		panic(r)
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded {
+			return ctx.Err()
+		}
+
+		s.log.Warnf("handler timed out processing message %s", delivery.Message.ID)
+
+		return fmt.Errorf("%w: message %s", ErrHandlerTimeout, delivery.Message.ID)
+	}
+}
+
+// decode unmarshals the message into handleType, or returns the raw data when no type is set.
+func (s *PubSubSubscriber) decode(ctx context.Context, message *pubsub.Message) (interface{}, *CloudEvent, error) {
+	data, err := s.messageData(ctx, message)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(data) == 0 && s.allowEmptyPayload {
+		if s.handleType == nil {
+			return data, nil, nil
+		}
+
+		return reflect.New(s.handleType).Interface(), nil, nil
+	}
+
+	if s.cloudEvents {
+		return s.decodeCloudEvent(data)
+	}
+
+	if s.recordBatching {
+		records, err := s.decodeRecords(data)
+		return records, nil, err
+	}
+
+	if s.codec != nil {
+		body, err := s.codec.Decode(data, s.handleType)
+		return body, nil, err
+	}
+
+	if s.handleType == nil {
+		return data, nil, nil
+	}
+
+	body := s.newBody()
+	err = s.unmarshal(data, body)
+
+	return body, nil, err
+}
+
+// unmarshal decodes data into v, as json.Number for interface{} numbers with WithUseNumber.
+func (s *PubSubSubscriber) unmarshal(data []byte, v interface{}) error {
+	if !s.useNumber {
+		return json.Unmarshal(data, v)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	return decoder.Decode(v)
+}
+
+func (s *PubSubSubscriber) handlerDeadline() time.Duration {
+	deadline := s.ackDeadline - s.deadlineMargin
+
+	if deadline <= 0 {
+		return s.ackDeadline
+	}
+
+	return deadline
+}
+
+// retryableCodes are the codes of transient PubSub errors.
+var retryableCodes = []codes.Code{
+	codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted,
+	codes.Aborted, codes.Internal, codes.Unknown,
+}
+
+func isRetryable(err error) bool {
+	st, ok := status.FromError(err)
+
+	if !ok {
+		return false
+	}
+
+	for _, code := range retryableCodes {
+		if st.Code() == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// maxRestartBackoff caps the WithAutoRestart backoff.
+const maxRestartBackoff = time.Minute
+
+func nextRestartBackoff(backoff time.Duration) time.Duration {
+	if backoff *= 2; backoff > maxRestartBackoff {
+		return maxRestartBackoff
+	}
+
+	return backoff
 }
 
 func (s *PubSubSubscriber) getRetries(message *pubsub.Message) int {
@@ -0,0 +1,36 @@
+package grok
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// SubscriberEvent describes the processing of a message.
+type SubscriberEvent struct {
+	MessageID string
+	Outcome   Disposition
+	Retries   int
+	Duration  time.Duration
+}
+
+// WithEventChannel sends a SubscriberEvent for every processed message to events.
+// Events are sent without blocking and dropped when the channel is full, so a slow
+// consumer never back-pressures processing; see DroppedEvents.
+func WithEventChannel(events chan<- SubscriberEvent) PubSubSubscriberOption {
+	return func(s *PubSubSubscriber) {
+		s.events = events
+	}
+}
+
+// DroppedEvents returns how many events were dropped because the event channel was full.
+func (s *PubSubSubscriber) DroppedEvents() int64 {
+	return atomic.LoadInt64(&s.droppedEvents)
+}
+
+func (s *PubSubSubscriber) emit(event SubscriberEvent) {
+	select {
+	case s.events <- event:
+	default:
+		atomic.AddInt64(&s.droppedEvents, 1)
+	}
+}
@@ -0,0 +1,58 @@
+package grok
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, isRetryable(status.Error(codes.Unavailable, "unavailable")))
+	assert.True(t, isRetryable(status.Error(codes.Unknown, "unknown")))
+	assert.False(t, isRetryable(status.Error(codes.NotFound, "not found")))
+	assert.False(t, isRetryable(status.Error(codes.PermissionDenied, "denied")))
+	assert.False(t, isRetryable(errors.New("invalid config")))
+}
+
+func TestNextRestartBackoff(t *testing.T) {
+	assert.Equal(t, 2*time.Second, nextRestartBackoff(time.Second))
+	assert.Equal(t, maxRestartBackoff, nextRestartBackoff(40*time.Second))
+	assert.Equal(t, maxRestartBackoff, nextRestartBackoff(maxRestartBackoff))
+}
+
+func TestMessageDataLimit(t *testing.T) {
+	body, err := compress(CompressionGzip, make([]byte, 1024))
+	assert.NoError(t, err)
+
+	message := &pubsub.Message{Data: body, Attributes: map[string]string{ContentEncodingAttribute: string(CompressionGzip)}}
+
+	data, err := messageData(message, 1024)
+	assert.NoError(t, err)
+	assert.Len(t, data, 1024)
+
+	_, err = messageData(message, 1023)
+	assert.Equal(t, ErrDecompressedTooLarge, err)
+
+	data, err = messageData(message, 0)
+	assert.NoError(t, err)
+	assert.Len(t, data, 1024)
+}
+
+func TestSubscriberConfigLogLevel(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	NewPubSubSubscriber().logConfig()
+	assert.Equal(t, DefaultConfigLogLevel, hook.LastEntry().Level)
+
+	NewPubSubSubscriber(WithSubscriberConfigLogLevel(logrus.WarnLevel)).logConfig()
+	assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+	assert.Equal(t, effectiveConfigMessage, hook.LastEntry().Message)
+}
@@ -2,12 +2,21 @@ package grok_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"reflect"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"cloud.google.com/go/pubsub"
 
+	"github.com/patrickmn/go-cache"
 	"github.com/recoli-tech/grok"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
@@ -20,6 +29,62 @@ type PubSubSubscriberTestSuite struct {
 	producer *grok.PubSubProducer
 }
 
+type flakyPublisher struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+}
+
+func (p *flakyPublisher) PublishWihAttribrutes(topicID string, data interface{}, attributes map[string]string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls++
+
+	if p.calls <= p.failures {
+		return errors.New("unavailable")
+	}
+
+	return nil
+}
+
+func (p *flakyPublisher) PublishRaw(topicID string, data []byte, attributes map[string]string) error {
+	return p.PublishWihAttribrutes(topicID, data, attributes)
+}
+
+type recordingPublisher struct {
+	topicID    string
+	data       []byte
+	attributes map[string]string
+}
+
+func (p *recordingPublisher) PublishWihAttribrutes(topicID string, data interface{}, attributes map[string]string) error {
+	p.topicID = topicID
+	p.attributes = attributes
+	return nil
+}
+
+func (p *recordingPublisher) PublishRaw(topicID string, data []byte, attributes map[string]string) error {
+	p.topicID = topicID
+	p.data = data
+	p.attributes = attributes
+	return nil
+}
+
+type notifyingPublisher struct {
+	topics chan string
+}
+
+func (p *notifyingPublisher) PublishWihAttribrutes(topicID string, data interface{}, attributes map[string]string) error {
+	p.topics <- topicID
+	return nil
+}
+
+func (p *notifyingPublisher) PublishRaw(topicID string, data []byte, attributes map[string]string) error {
+	p.topics <- topicID
+	return nil
+}
+
 func TestPubSubSubscriberTestSuite(t *testing.T) {
 	suite.Run(t, new(PubSubSubscriberTestSuite))
 }
@@ -68,3 +133,1664 @@ func (s *PubSubSubscriberTestSuite) TestSubscribe() {
 
 	<-received
 }
+
+func (s *PubSubSubscriberTestSuite) TestSubscribeWithMessageHandler() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan bool, 1)
+
+	topicID := "topic-message-handler"
+	message := map[string]interface{}{"ping": "pong"}
+
+	go grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID(topicID),
+		grok.WithPubSubSubscriberID("subs-message-handler"),
+		grok.WithType(reflect.TypeOf(message)),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			defer func() { received <- true }()
+
+			_, ok := ctx.Deadline()
+			s.assert.True(ok)
+			s.assert.NotEmpty(delivery.Message.ID)
+
+			return nil
+		}),
+	).
+		Run(ctx)
+
+	err := s.producer.Publish(topicID, message)
+
+	s.assert.NoError(err)
+
+	<-received
+}
+
+func (s *PubSubSubscriberTestSuite) TestPauseResume() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan bool, 1)
+	topicID := "topic-pause"
+
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID(topicID),
+		grok.WithPubSubSubscriberID("subs-pause"),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			received <- true
+			return nil
+		}),
+	)
+
+	s.Require().NoError(subscriber.Setup(ctx))
+
+	subscriber.Pause()
+	s.assert.True(subscriber.Paused())
+
+	go subscriber.Run(ctx)
+
+	s.assert.NoError(s.producer.Publish(topicID, map[string]interface{}{"ping": "pong"}))
+
+	select {
+	case <-received:
+		s.Fail("paused subscriber processed a message")
+	case <-time.After(time.Second):
+	}
+
+	subscriber.Resume()
+	s.assert.False(subscriber.Paused())
+
+	select {
+	case <-received:
+	case <-time.After(10 * time.Second):
+		s.Fail("message not redelivered after resume")
+	}
+}
+
+func (s *PubSubSubscriberTestSuite) TestStartupGracePeriod() {
+	for _, tc := range []struct {
+		name        string
+		gracePeriod time.Duration
+		topicID     string
+	}{
+		{"Grace", time.Minute, "topic-grace"},
+		{"No Grace", 0, "topic-grace_dlq"},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		publisher := &notifyingPublisher{topics: make(chan string, 1)}
+
+		subscriber := grok.NewPubSubSubscriber(
+			grok.WithClient(s.client),
+			grok.WithTopicID("topic-grace"),
+			grok.WithPubSubSubscriberID("subs-grace"),
+			grok.WithPublisher(publisher),
+			grok.WithStartupGracePeriod(tc.gracePeriod),
+			grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+				return errors.New("dependency warming up")
+			}),
+		)
+
+		s.Require().NoError(subscriber.Setup(ctx))
+
+		go subscriber.Run(ctx)
+
+		s.assert.NoError(s.producer.PublishWihAttribrutes("topic-grace", map[string]interface{}{}, map[string]string{"retries": "5"}))
+
+		select {
+		case topicID := <-publisher.topics:
+			s.assert.Equal(tc.topicID, topicID, tc.name)
+		case <-time.After(10 * time.Second):
+			s.Fail("message not republished", tc.name)
+		}
+
+		cancel()
+	}
+}
+
+func (s *PubSubSubscriberTestSuite) TestSubscribeExtend() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan bool, 1)
+
+	topicID := "topic-extend"
+	message := map[string]interface{}{"ping": "pong"}
+
+	go grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID(topicID),
+		grok.WithPubSubSubscriberID("subs-extend"),
+		grok.WithType(reflect.TypeOf(message)),
+		grok.WithMaxExtension(time.Minute),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			defer func() { received <- true }()
+
+			before, _ := ctx.Deadline()
+			delivery.Extend(30 * time.Second)
+			after, _ := ctx.Deadline()
+
+			s.assert.True(after.After(before))
+			s.assert.NoError(ctx.Err())
+
+			return nil
+		}),
+	).
+		Run(ctx)
+
+	err := s.producer.Publish(topicID, message)
+
+	s.assert.NoError(err)
+
+	<-received
+}
+
+func (s *PubSubSubscriberTestSuite) TestHandlerTimeoutExtendsLease() {
+	elapsed := make(chan time.Duration, 1)
+
+	subscriber := func(timeout, maxExtension time.Duration) *grok.PubSubSubscriber {
+		return grok.NewPubSubSubscriber(
+			grok.WithClient(s.client),
+			grok.WithTopicID("topic-handler-timeout"),
+			grok.WithPubSubSubscriberID("subs-handler-timeout"),
+			grok.WithType(reflect.TypeOf(map[string]interface{}{})),
+			grok.WithPublisher(&recordingPublisher{}),
+			grok.WithAckDeadline(time.Second),
+			grok.WithDeadlineMargin(500*time.Millisecond),
+			grok.WithMaxExtension(maxExtension),
+			grok.WithHandlerTimeout(timeout),
+			grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+				started := time.Now()
+				<-ctx.Done()
+				elapsed <- time.Since(started)
+				return ctx.Err()
+			}),
+		)
+	}
+
+	disposition := subscriber(1500*time.Millisecond, time.Minute).
+		ProcessMessage(context.Background(), &pubsub.Message{ID: "1", Data: []byte(`{}`)})
+
+	s.assert.Equal(grok.DispositionRetry, disposition)
+	d := <-elapsed
+	s.assert.True(d >= 1400*time.Millisecond, d.String())
+
+	subscriber(time.Minute, time.Second).
+		ProcessMessage(context.Background(), &pubsub.Message{ID: "2", Data: []byte(`{}`)})
+
+	d = <-elapsed
+	s.assert.True(d < 1500*time.Millisecond, d.String())
+}
+
+func (s *PubSubSubscriberTestSuite) TestSubscribeCloudEvents() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan bool, 1)
+
+	topicID := "topic-cloud-events"
+	message := map[string]interface{}{"ping": "pong"}
+
+	go grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID(topicID),
+		grok.WithPubSubSubscriberID("subs-cloud-events"),
+		grok.WithType(reflect.TypeOf(message)),
+		grok.WithCloudEvents(),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			defer func() { received <- true }()
+
+			value, ok := delivery.Body.(*map[string]interface{})
+			s.assert.True(ok)
+			s.assert.Equal("pong", (*value)["ping"])
+			s.assert.Equal("ping.created", delivery.Event.Type)
+			s.assert.Equal("grok/tests", delivery.Event.Source)
+			s.assert.NotEmpty(delivery.Event.ID)
+
+			return nil
+		}),
+	).
+		Run(ctx)
+
+	err := s.producer.PublishCloudEvent(ctx, topicID,
+		grok.CloudEvent{Type: "ping.created", Source: "grok/tests"}, message)
+
+	s.assert.NoError(err)
+
+	<-received
+}
+
+func (s *PubSubSubscriberTestSuite) TestSubscribeCompressed() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan bool, 1)
+
+	topicID := "topic-compressed"
+	message := map[string]interface{}{"ping": "pong"}
+
+	go grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID(topicID),
+		grok.WithPubSubSubscriberID("subs-compressed"),
+		grok.WithType(reflect.TypeOf(message)),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			defer func() { received <- true }()
+
+			value, ok := delivery.Body.(*map[string]interface{})
+			s.assert.True(ok)
+			s.assert.Equal("pong", (*value)["ping"])
+			s.assert.Equal("gzip", delivery.Message.Attributes[grok.ContentEncodingAttribute])
+
+			return nil
+		}),
+	).
+		Run(ctx)
+
+	producer := grok.NewPubSubProducer(s.client, grok.WithCompression(grok.CompressionGzip))
+	err := producer.Publish(topicID, message)
+
+	s.assert.NoError(err)
+
+	<-received
+}
+
+func (s *PubSubSubscriberTestSuite) TestProcessMessage() {
+	ctx := context.Background()
+	message := map[string]interface{}{"ping": "pong"}
+	failure := errors.New("failure")
+
+	subscriber := func(err error) *grok.PubSubSubscriber {
+		return grok.NewPubSubSubscriber(
+			grok.WithClient(s.client),
+			grok.WithTopicID("topic-process"),
+			grok.WithPubSubSubscriberID("subs-process"),
+			grok.WithType(reflect.TypeOf(message)),
+			grok.WithMaxRetries(1),
+			grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+				return err
+			}),
+		)
+	}
+
+	s.assert.Equal(grok.DispositionAck,
+		subscriber(nil).ProcessMessage(ctx, &pubsub.Message{ID: "1", Data: []byte(`{"ping":"pong"}`)}))
+
+	s.assert.Equal(grok.DispositionRetry,
+		subscriber(failure).ProcessMessage(ctx, &pubsub.Message{ID: "2", Data: []byte(`{"ping":"pong"}`)}))
+
+	s.assert.Equal(grok.DispositionDLQ,
+		subscriber(failure).ProcessMessage(ctx, &pubsub.Message{
+			ID:         "3",
+			Data:       []byte(`{"ping":"pong"}`),
+			Attributes: map[string]string{"retries": "1"},
+		}))
+
+	s.assert.Equal(grok.DispositionDLQ,
+		subscriber(nil).ProcessMessage(ctx, &pubsub.Message{ID: "4", Data: []byte(`not json`)}))
+}
+
+func (s *PubSubSubscriberTestSuite) TestExhaustedPolicy() {
+	ctx := context.Background()
+
+	for policy, exhausted := range map[grok.ExhaustedPolicy]grok.Disposition{
+		grok.ExhaustedDrop: grok.DispositionDrop,
+		grok.ExhaustedNack: grok.DispositionNack,
+	} {
+		subscriber := grok.NewPubSubSubscriber(
+			grok.WithClient(s.client),
+			grok.WithTopicID("topic-exhausted"),
+			grok.WithPubSubSubscriberID("subs-exhausted"),
+			grok.WithMaxRetries(2),
+			grok.WithoutDLQ(),
+			grok.WithExhaustedPolicy(policy),
+			grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+				return errors.New("failure")
+			}),
+		)
+
+		s.assert.Equal(grok.DispositionRetry,
+			subscriber.ProcessMessage(ctx, &pubsub.Message{
+				ID:         "1",
+				Data:       []byte(`{}`),
+				Attributes: map[string]string{"retries": "1"},
+			}))
+
+		s.assert.Equal(exhausted,
+			subscriber.ProcessMessage(ctx, &pubsub.Message{
+				ID:         "2",
+				Data:       []byte(`{}`),
+				Attributes: map[string]string{"retries": "2"},
+			}))
+	}
+}
+
+func (s *PubSubSubscriberTestSuite) TestRetryTopic() {
+	data := []byte(`{"id":1}`)
+	publisher := &recordingPublisher{}
+
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-retry-topic"),
+		grok.WithPubSubSubscriberID("subs-retry-topic"),
+		grok.WithPublisher(publisher),
+		grok.WithRetryTopic(),
+		grok.WithRetryDelay(50*time.Millisecond),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			return errors.New("failure")
+		}),
+	)
+
+	s.assert.Equal(grok.DispositionRetry,
+		subscriber.ProcessMessage(context.Background(), &pubsub.Message{ID: "1", Data: data}))
+	s.assert.Equal("topic-retry-topic_retry", publisher.topicID)
+	s.assert.NotEmpty(publisher.attributes[grok.NotBeforeAttribute])
+
+	start := time.Now()
+
+	s.assert.Equal(grok.DispositionAck,
+		subscriber.RetryDelayer().ProcessMessage(context.Background(), &pubsub.Message{
+			ID:         "1",
+			Data:       publisher.data,
+			Attributes: publisher.attributes,
+		}))
+	s.assert.True(time.Since(start) >= 40*time.Millisecond)
+	s.assert.Equal("topic-retry-topic", publisher.topicID)
+	s.assert.Equal(data, publisher.data)
+	s.assert.Equal("1", publisher.attributes["retries"])
+	s.assert.NotContains(publisher.attributes, grok.NotBeforeAttribute)
+}
+
+func (s *PubSubSubscriberTestSuite) TestRetryTopicExtendsLease() {
+	publisher := &recordingPublisher{}
+
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-retry-lease"),
+		grok.WithPubSubSubscriberID("subs-retry-lease"),
+		grok.WithPublisher(publisher),
+		grok.WithRetryTopic(),
+		grok.WithAckDeadline(time.Second),
+		grok.WithDeadlineMargin(500*time.Millisecond),
+	)
+
+	notBefore := time.Now().Add(1500*time.Millisecond).UnixNano() / int64(time.Millisecond)
+
+	s.assert.Equal(grok.DispositionAck,
+		subscriber.RetryDelayer().ProcessMessage(context.Background(), &pubsub.Message{
+			ID:         "1",
+			Data:       []byte(`{"id":1}`),
+			Attributes: map[string]string{grok.NotBeforeAttribute: strconv.FormatInt(notBefore, 10)},
+		}))
+	s.assert.Equal("topic-retry-lease", publisher.topicID)
+}
+
+func (s *PubSubSubscriberTestSuite) TestUseNumber() {
+	var id interface{}
+
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-use-number"),
+		grok.WithPubSubSubscriberID("subs-use-number"),
+		grok.WithType(reflect.TypeOf(map[string]interface{}{})),
+		grok.WithUseNumber(),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			id = (*delivery.Body.(*map[string]interface{}))["id"]
+			return nil
+		}),
+	)
+
+	s.assert.Equal(grok.DispositionAck,
+		subscriber.ProcessMessage(context.Background(), &pubsub.Message{
+			ID:   "1",
+			Data: []byte(`{"id":9007199254740993}`),
+		}))
+	s.assert.Equal(json.Number("9007199254740993"), id)
+}
+
+func (s *PubSubSubscriberTestSuite) TestAllowEmptyPayload() {
+	type signal struct {
+		Name string `json:"name"`
+	}
+
+	var body interface{}
+
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-empty"),
+		grok.WithPubSubSubscriberID("subs-empty"),
+		grok.WithType(reflect.TypeOf(signal{})),
+		grok.WithAllowEmptyPayload(),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			body = delivery.Body
+			return nil
+		}),
+	)
+
+	s.assert.Equal(grok.DispositionAck,
+		subscriber.ProcessMessage(context.Background(), &pubsub.Message{
+			ID:         "1",
+			Attributes: map[string]string{"event": "refresh"},
+		}))
+	s.assert.Equal(&signal{}, body)
+}
+
+func (s *PubSubSubscriberTestSuite) TestDedup() {
+	handled := []string{}
+
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-dedup"),
+		grok.WithPubSubSubscriberID("subs-dedup"),
+		grok.WithDedup("order_id", cache.New(time.Minute, time.Minute), time.Minute),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			handled = append(handled, delivery.Message.ID)
+			return nil
+		}),
+	)
+
+	for _, m := range []struct{ id, key string }{{"1", "a"}, {"2", "a"}, {"3", "b"}} {
+		s.assert.Equal(grok.DispositionAck,
+			subscriber.ProcessMessage(context.Background(), &pubsub.Message{
+				ID:         m.id,
+				Data:       []byte(`{}`),
+				Attributes: map[string]string{"order_id": m.key},
+			}))
+	}
+
+	s.assert.Equal([]string{"1", "3"}, handled)
+}
+
+func (s *PubSubSubscriberTestSuite) TestProcessHooks() {
+	type key struct{}
+
+	var (
+		value       interface{}
+		disposition grok.Disposition
+		failure     error
+	)
+
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-hooks"),
+		grok.WithPubSubSubscriberID("subs-hooks"),
+		grok.WithPublisher(&flakyPublisher{}),
+		grok.WithBeforeProcess(func(ctx context.Context, m *pubsub.Message) context.Context {
+			return context.WithValue(ctx, key{}, m.ID)
+		}),
+		grok.WithAfterProcess(func(ctx context.Context, m *pubsub.Message, d grok.Disposition, err error) {
+			disposition, failure = d, err
+			panic("after hook")
+		}),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			value = ctx.Value(key{})
+			return errors.New("failure")
+		}),
+	)
+
+	s.assert.Equal(grok.DispositionRetry,
+		subscriber.ProcessMessage(context.Background(), &pubsub.Message{
+			ID:         "1",
+			Data:       []byte(`{}`),
+			Attributes: map[string]string{},
+		}))
+	s.assert.Equal("1", value)
+	s.assert.Equal(grok.DispositionRetry, disposition)
+	s.assert.EqualError(failure, "failure")
+}
+
+type memorySink struct {
+	messages []grok.DeadLetterMessage
+}
+
+func (m *memorySink) Store(ctx context.Context, message grok.DeadLetterMessage) error {
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+func (s *PubSubSubscriberTestSuite) TestDeadLetterSink() {
+	sink := &memorySink{}
+	publisher := &flakyPublisher{}
+
+	disposition := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-sink"),
+		grok.WithPubSubSubscriberID("subs-sink"),
+		grok.WithType(reflect.TypeOf(map[string]interface{}{})),
+		grok.WithPublisher(publisher),
+		grok.WithDeadLetterSink(sink),
+		grok.WithoutDLQTopic(),
+	).
+		ProcessMessage(context.Background(), &pubsub.Message{
+			ID:         "1",
+			Data:       []byte(`not json`),
+			Attributes: map[string]string{"origin": "test"},
+		})
+
+	s.assert.Equal(grok.DispositionDLQ, disposition)
+	s.assert.Equal(0, publisher.calls)
+	s.assert.Len(sink.messages, 1)
+	s.assert.Equal("1", sink.messages[0].ID)
+	s.assert.Equal("topic-sink", sink.messages[0].Topic)
+	s.assert.Equal([]byte(`not json`), sink.messages[0].Data)
+	s.assert.Equal("test", sink.messages[0].Attributes["origin"])
+	s.assert.NotEmpty(sink.messages[0].Error)
+}
+
+func (s *PubSubSubscriberTestSuite) TestPointerType() {
+	type order struct {
+		ID string `json:"id"`
+	}
+
+	for _, t := range []reflect.Type{reflect.TypeOf(order{}), reflect.TypeOf(&order{})} {
+		var body interface{}
+
+		disposition := grok.NewPubSubSubscriber(
+			grok.WithClient(s.client),
+			grok.WithTopicID("topic-pointer"),
+			grok.WithPubSubSubscriberID("subs-pointer"),
+			grok.WithType(t),
+			grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+				body = delivery.Body
+				return nil
+			}),
+		).
+			ProcessMessage(context.Background(), &pubsub.Message{ID: "1", Data: []byte(`{"id":"a"}`)})
+
+		s.assert.Equal(grok.DispositionAck, disposition, t.String())
+		s.assert.Equal(&order{ID: "a"}, body, t.String())
+	}
+}
+
+func (s *PubSubSubscriberTestSuite) TestErrorLogThreshold() {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-error-log"),
+		grok.WithPubSubSubscriberID("subs-error-log"),
+		grok.WithPublisher(&recordingPublisher{}),
+		grok.WithErrorLogThreshold(3),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			return errors.New("failure")
+		}),
+	)
+
+	for _, tc := range []struct {
+		retries string
+		level   logrus.Level
+	}{
+		{"0", logrus.WarnLevel},
+		{"2", logrus.WarnLevel},
+		{"3", logrus.ErrorLevel},
+		{"5", logrus.ErrorLevel},
+	} {
+		hook.Reset()
+
+		subscriber.ProcessMessage(context.Background(), &pubsub.Message{
+			ID:         tc.retries,
+			Data:       []byte(`{}`),
+			Attributes: map[string]string{"retries": tc.retries},
+		})
+
+		var entry *logrus.Entry
+
+		for _, e := range hook.AllEntries() {
+			if e.Message == "error processing message "+tc.retries {
+				entry = e
+			}
+		}
+
+		if s.assert.NotNil(entry, tc.retries) {
+			s.assert.Equal(tc.level, entry.Level, tc.retries)
+		}
+	}
+}
+
+func (s *PubSubSubscriberTestSuite) TestNackOnShutdown() {
+	publisher := &recordingPublisher{}
+	failing := true
+
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-shutdown"),
+		grok.WithPubSubSubscriberID("subs-shutdown"),
+		grok.WithPublisher(publisher),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			if failing {
+				return ctx.Err()
+			}
+
+			return nil
+		}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	disposition := subscriber.ProcessMessage(ctx, &pubsub.Message{ID: "1", Data: []byte(`{}`)})
+
+	s.assert.Equal(grok.DispositionNack, disposition)
+	s.assert.Empty(publisher.topicID)
+
+	failing = false
+
+	s.assert.Equal(grok.DispositionAck, subscriber.ProcessMessage(ctx, &pubsub.Message{ID: "2", Data: []byte(`{}`)}))
+}
+
+func (s *PubSubSubscriberTestSuite) TestSerialProcessing() {
+	for _, tc := range []struct {
+		name   string
+		opts   []grok.PubSubSubscriberOption
+		serial bool
+	}{
+		{"Serial", []grok.PubSubSubscriberOption{grok.WithSerialProcessing()}, true},
+		{"Concurrent", nil, false},
+	} {
+		mu := new(sync.Mutex)
+		running, max := 0, 0
+
+		subscriber := grok.NewPubSubSubscriber(append(tc.opts,
+			grok.WithClient(s.client),
+			grok.WithTopicID("topic-serial"),
+			grok.WithPubSubSubscriberID("subs-serial"),
+			grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+				mu.Lock()
+				running++
+				if running > max {
+					max = running
+				}
+				mu.Unlock()
+
+				time.Sleep(20 * time.Millisecond)
+
+				mu.Lock()
+				running--
+				mu.Unlock()
+
+				return nil
+			}),
+		)...)
+
+		wg := new(sync.WaitGroup)
+
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				subscriber.ProcessMessage(context.Background(), &pubsub.Message{ID: strconv.Itoa(i), Data: []byte(`{}`)})
+			}(i)
+		}
+
+		wg.Wait()
+
+		s.assert.Equal(tc.serial, max == 1, tc.name)
+	}
+}
+
+func (s *PubSubSubscriberTestSuite) TestSchemaVersion() {
+	publisher := &recordingPublisher{}
+
+	disposition := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-schema-version"),
+		grok.WithPubSubSubscriberID("subs-schema-version"),
+		grok.WithPublisher(publisher),
+		grok.WithSchemaVersion("v2"),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			return errors.New("failure")
+		}),
+	).
+		ProcessMessage(context.Background(), &pubsub.Message{
+			ID:         "1",
+			Data:       []byte(`{}`),
+			Attributes: map[string]string{"retries": "5"},
+		})
+
+	s.assert.Equal(grok.DispositionDLQ, disposition)
+	s.assert.Equal("topic-schema-version_dlq", publisher.topicID)
+	s.assert.Equal("v2", publisher.attributes[grok.SchemaVersionAttribute])
+}
+
+func (s *PubSubSubscriberTestSuite) TestDLQSubscription() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	topicID := fmt.Sprintf("topic-dlq-subscription-%d", time.Now().UnixNano())
+
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID(topicID),
+		grok.WithPubSubSubscriberID(topicID),
+		grok.WithMaxRetries(0),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			return errors.New("failure")
+		}),
+	)
+
+	disposition := subscriber.ProcessMessage(ctx, &pubsub.Message{ID: "1", Data: []byte(`{"id":1}`)})
+	s.Require().Equal(grok.DispositionDLQ, disposition)
+
+	received := make(chan *pubsub.Message, 1)
+
+	receiveCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	err := s.client.Subscription(subscriber.DLQTopicID()).Receive(receiveCtx, func(ctx context.Context, m *pubsub.Message) {
+		m.Ack()
+		received <- m
+		stop()
+	})
+
+	s.Require().NoError(err)
+
+	select {
+	case m := <-received:
+		s.assert.Equal("failure", m.Attributes["error"])
+	default:
+		s.Fail("dead letter not retained by the dlq subscription")
+	}
+}
+
+func (s *PubSubSubscriberTestSuite) TestLogFields() {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithResourcePrefix("dev-"),
+		grok.WithTopicID("topic-log-fields"),
+		grok.WithPubSubSubscriberID("subs-log-fields"),
+		grok.WithPublisher(&recordingPublisher{}),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			return errors.New("failure")
+		}),
+	).
+		ProcessMessage(context.Background(), &pubsub.Message{ID: "1", Data: []byte(`{}`)})
+
+	s.Require().NotEmpty(hook.AllEntries())
+
+	for _, entry := range hook.AllEntries() {
+		s.assert.Equal("dev-subs-log-fields", entry.Data["subscription"], entry.Message)
+		s.assert.Equal("dev-topic-log-fields", entry.Data["topic"], entry.Message)
+	}
+}
+
+func (s *PubSubSubscriberTestSuite) TestFallbackSink() {
+	recovered := []grok.DeadLetterMessage{}
+
+	disposition := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-fallback"),
+		grok.WithPubSubSubscriberID("subs-fallback"),
+		grok.WithPublisher(&flakyPublisher{failures: 100}),
+		grok.WithDLQPublishRetries(0),
+		grok.WithFallbackSink(func(m grok.DeadLetterMessage) error {
+			recovered = append(recovered, m)
+			return nil
+		}),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			return errors.New("failure")
+		}),
+	).
+		ProcessMessage(context.Background(), &pubsub.Message{
+			ID:         "1",
+			Data:       []byte(`{"id":1}`),
+			Attributes: map[string]string{},
+		})
+
+	s.assert.Equal(grok.DispositionDrop, disposition)
+	s.assert.Len(recovered, 1)
+	s.assert.Equal([]byte(`{"id":1}`), recovered[0].Data)
+	s.assert.Contains(recovered[0].Error, "failure")
+
+	disposition = grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-fallback"),
+		grok.WithPubSubSubscriberID("subs-fallback"),
+		grok.WithPublisher(&flakyPublisher{failures: 100}),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			return errors.New("failure")
+		}),
+	).
+		ProcessMessage(context.Background(), &pubsub.Message{ID: "2", Data: []byte(`{"id":2}`)})
+
+	s.assert.Equal(grok.DispositionNack, disposition)
+}
+
+func (s *PubSubSubscriberTestSuite) TestDeliveryPublisher() {
+	publisher := &flakyPublisher{failures: 1}
+
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-follow-up"),
+		grok.WithPubSubSubscriberID("subs-follow-up"),
+		grok.WithPublisher(publisher),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			return delivery.Publisher.PublishWihAttribrutes("follow-up", map[string]string{"id": "1"}, nil)
+		}),
+	)
+
+	message := func() *pubsub.Message {
+		return &pubsub.Message{ID: "1", Data: []byte(`{}`), Attributes: map[string]string{}}
+	}
+
+	s.assert.Equal(grok.DispositionRetry, subscriber.ProcessMessage(context.Background(), message()))
+	s.assert.Equal(grok.DispositionAck, subscriber.ProcessMessage(context.Background(), message()))
+	s.assert.Equal(3, publisher.calls)
+}
+
+func (s *PubSubSubscriberTestSuite) TestEventChannel() {
+	ctx := context.Background()
+	events := make(chan grok.SubscriberEvent, 1)
+
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-events"),
+		grok.WithPubSubSubscriberID("subs-events"),
+		grok.WithPublisher(&flakyPublisher{}),
+		grok.WithEventChannel(events),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			return errors.New("failure")
+		}),
+	)
+
+	for _, id := range []string{"1", "2"} {
+		subscriber.ProcessMessage(ctx, &pubsub.Message{
+			ID:         id,
+			Data:       []byte(`{}`),
+			Attributes: map[string]string{"retries": "1"},
+		})
+	}
+
+	event := <-events
+
+	s.assert.Equal("1", event.MessageID)
+	s.assert.Equal(grok.DispositionRetry, event.Outcome)
+	s.assert.Equal(1, event.Retries)
+	s.assert.Equal(int64(1), subscriber.DroppedEvents())
+}
+
+func (s *PubSubSubscriberTestSuite) TestNonDLQErrors() {
+	ctx := context.Background()
+	unavailable := errors.New("resource temporarily unavailable")
+	publisher := &flakyPublisher{}
+
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-non-dlq"),
+		grok.WithPubSubSubscriberID("subs-non-dlq"),
+		grok.WithMaxRetries(2),
+		grok.WithoutDLQ(),
+		grok.WithPublisher(publisher),
+		grok.WithNonDLQErrors(func(err error) bool { return errors.Is(err, unavailable) }),
+		grok.WithNonDLQMaxRetries(4),
+		grok.WithNonDLQBackoff(time.Millisecond),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			return fmt.Errorf("fetching: %w", unavailable)
+		}),
+	)
+
+	s.assert.Equal(grok.DispositionRetry,
+		subscriber.ProcessMessage(ctx, &pubsub.Message{
+			ID:         "1",
+			Data:       []byte(`{}`),
+			Attributes: map[string]string{"retries": "3"},
+		}))
+	s.assert.Equal(1, publisher.calls)
+
+	s.assert.Equal(grok.DispositionDrop,
+		subscriber.ProcessMessage(ctx, &pubsub.Message{
+			ID:         "2",
+			Data:       []byte(`{}`),
+			Attributes: map[string]string{"retries": "4"},
+		}))
+}
+
+func (s *PubSubSubscriberTestSuite) TestSubscribeRecords() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan string, 2)
+
+	topicID := "topic-records"
+	message := map[string]interface{}{}
+
+	go grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID(topicID),
+		grok.WithPubSubSubscriberID("subs-records"),
+		grok.WithType(reflect.TypeOf(message)),
+		grok.WithRecordBatching(),
+		grok.WithHandler(func(data interface{}) error {
+			value, ok := data.(*map[string]interface{})
+			s.assert.True(ok)
+
+			received <- (*value)["ping"].(string)
+
+			return nil
+		}),
+	).
+		Run(ctx)
+
+	err := s.producer.PublishRecords(topicID, []interface{}{
+		map[string]interface{}{"ping": "first"},
+		map[string]interface{}{"ping": "second"},
+	})
+
+	s.assert.NoError(err)
+	s.assert.Equal("first", <-received)
+	s.assert.Equal("second", <-received)
+}
+
+func (s *PubSubSubscriberTestSuite) TestDLQPublishRetries() {
+	ctx := context.Background()
+	message := func() *pubsub.Message {
+		return &pubsub.Message{ID: "1", Data: []byte(`not json`)}
+	}
+
+	publisher := &flakyPublisher{failures: 2}
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-dlq-retries"),
+		grok.WithPubSubSubscriberID("subs-dlq-retries"),
+		grok.WithType(reflect.TypeOf(map[string]interface{}{})),
+		grok.WithPublisher(publisher),
+	)
+
+	s.assert.Equal(grok.DispositionDLQ, subscriber.ProcessMessage(ctx, message()))
+	s.assert.Equal(3, publisher.calls)
+
+	publisher = &flakyPublisher{failures: 2}
+	subscriber = grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-dlq-retries"),
+		grok.WithPubSubSubscriberID("subs-dlq-retries"),
+		grok.WithType(reflect.TypeOf(map[string]interface{}{})),
+		grok.WithPublisher(publisher),
+		grok.WithDLQPublishRetries(1),
+	)
+
+	s.assert.Equal(grok.DispositionNack, subscriber.ProcessMessage(ctx, message()))
+	s.assert.Equal(2, publisher.calls)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	publisher = &flakyPublisher{failures: 2}
+	subscriber = grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-dlq-retries"),
+		grok.WithPubSubSubscriberID("subs-dlq-retries"),
+		grok.WithType(reflect.TypeOf(map[string]interface{}{})),
+		grok.WithPublisher(publisher),
+	)
+
+	s.assert.Equal(grok.DispositionNack, subscriber.ProcessMessage(canceled, message()))
+	s.assert.Equal(1, publisher.calls)
+}
+
+func (s *PubSubSubscriberTestSuite) TestRetryPreservesData() {
+	data := []byte(`{ "pong": "ping",  "ping":"pong" }`)
+	publisher := &recordingPublisher{}
+
+	disposition := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-retry-data"),
+		grok.WithPubSubSubscriberID("subs-retry-data"),
+		grok.WithType(reflect.TypeOf(map[string]interface{}{})),
+		grok.WithPublisher(publisher),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			return errors.New("failure")
+		}),
+	).
+		ProcessMessage(context.Background(), &pubsub.Message{ID: "1", Data: data})
+
+	s.assert.Equal(grok.DispositionRetry, disposition)
+	s.assert.Equal(data, publisher.data)
+	s.assert.Equal("1", publisher.attributes["retries"])
+}
+
+func (s *PubSubSubscriberTestSuite) TestTopicProject() {
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("orders"),
+		grok.WithTopicProject("central-project"),
+		grok.WithPubSubSubscriberID("subs-orders"),
+	)
+
+	s.assert.Equal("projects/central-project/topics/orders", subscriber.TopicName())
+}
+
+func (s *PubSubSubscriberTestSuite) TestTopicProjectRetry() {
+	publisher := &recordingPublisher{}
+
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("orders"),
+		grok.WithTopicProject("central-project"),
+		grok.WithPubSubSubscriberID("subs-orders-retry"),
+		grok.WithType(reflect.TypeOf(map[string]interface{}{})),
+		grok.WithPublisher(publisher),
+		grok.WithMaxRetries(1),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			return errors.New("failure")
+		}),
+	)
+
+	s.assert.Equal(grok.DispositionRetry,
+		subscriber.ProcessMessage(context.Background(), &pubsub.Message{ID: "1", Data: []byte(`{}`)}))
+	s.assert.Equal("projects/central-project/topics/orders", publisher.topicID)
+
+	s.assert.Equal(grok.DispositionDLQ,
+		subscriber.ProcessMessage(context.Background(), &pubsub.Message{
+			ID:         "2",
+			Data:       []byte(`{}`),
+			Attributes: map[string]string{"retries": "1"},
+		}))
+	s.assert.Equal("orders_dlq", publisher.topicID)
+}
+
+func (s *PubSubSubscriberTestSuite) TestResourcePrefix() {
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("orders"),
+		grok.WithPubSubSubscriberID("subs-orders"),
+		grok.WithResourcePrefix("staging-"),
+	)
+
+	s.assert.Equal("projects/fake_client/topics/staging-orders", subscriber.TopicName())
+	s.assert.Equal("staging-subs-orders", subscriber.SubscriptionID())
+	s.assert.Equal("staging-orders_dlq", subscriber.DLQTopicID())
+}
+
+func (s *PubSubSubscriberTestSuite) TestInvalidTopicProject() {
+	err := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("orders"),
+		grok.WithTopicProject("Invalid_Project"),
+		grok.WithPubSubSubscriberID("subs-orders"),
+	).
+		Run(context.Background())
+
+	s.assert.Error(err)
+}
+
+func (s *PubSubSubscriberTestSuite) TestReconcileSubscription() {
+	topicID := fmt.Sprintf("topic-reconcile-%d", time.Now().UnixNano())
+	subscriberID := fmt.Sprintf("subs-reconcile-%d", time.Now().UnixNano())
+
+	s.assert.NoError(grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID(topicID),
+		grok.WithPubSubSubscriberID(subscriberID),
+	).
+		Setup(context.Background()))
+
+	s.assert.NoError(grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID(topicID),
+		grok.WithPubSubSubscriberID(subscriberID),
+		grok.WithAckDeadline(30*time.Second),
+		grok.WithSubscriptionLabels(map[string]string{"team": "orders"}),
+		grok.WithReconcileSubscription(),
+	).
+		Setup(context.Background()))
+
+	config, err := s.client.Subscription(subscriberID).Config(context.Background())
+
+	s.assert.NoError(err)
+	s.assert.Equal(30*time.Second, config.AckDeadline)
+	s.assert.Equal(map[string]string{"team": "orders"}, config.Labels)
+}
+
+func (s *PubSubSubscriberTestSuite) TestClose() {
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-close"),
+		grok.WithPubSubSubscriberID("subs-close"),
+	)
+
+	errs := make(chan error, 1)
+	go func() { errs <- subscriber.Run(context.Background()) }()
+
+	time.Sleep(500 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s.assert.NoError(subscriber.Close(ctx))
+	s.assert.NoError(<-errs)
+	s.assert.NoError(subscriber.Close(ctx))
+	s.assert.Equal(grok.ErrClosed, subscriber.Run(context.Background()))
+
+	_, err := s.client.Topic("topic-close").Exists(ctx)
+	s.assert.NoError(err, "a client given by WithClient stays open")
+
+	client := grok.FakePubSubClient(s.settings.GCP.PubSub.Endpoint)
+	owner := grok.NewPubSubSubscriber(
+		grok.WithOwnedClient(client),
+		grok.WithTopicID("topic-close"),
+		grok.WithPubSubSubscriberID("subs-close"),
+	)
+
+	s.assert.NoError(owner.Close(ctx))
+
+	_, err = client.Topic("topic-close").Exists(ctx)
+	s.assert.Error(err, "an owned client is closed")
+}
+
+func (s *PubSubSubscriberTestSuite) TestConcurrentCreate() {
+	topicID := fmt.Sprintf("topic-race-%d", time.Now().UnixNano())
+	subscriberID := fmt.Sprintf("subs-race-%d", time.Now().UnixNano())
+
+	wg := new(sync.WaitGroup)
+	errs := make(chan error, 10)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- grok.NewPubSubSubscriber(
+				grok.WithClient(s.client),
+				grok.WithTopicID(topicID),
+				grok.WithPubSubSubscriberID(subscriberID),
+			).
+				Setup(context.Background())
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		s.assert.NoError(err)
+	}
+}
+
+func (s *PubSubSubscriberTestSuite) TestSubscribeEncrypted() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan map[string]interface{}, 2)
+
+	topicID := "topic-encrypted"
+	key := byte(42)
+	xor := func(ctx context.Context, data []byte) ([]byte, error) {
+		out := make([]byte, len(data))
+
+		for i, b := range data {
+			out[i] = b ^ key
+		}
+
+		return out, nil
+	}
+
+	go grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID(topicID),
+		grok.WithPubSubSubscriberID("subs-encrypted"),
+		grok.WithType(reflect.TypeOf(map[string]interface{}{})),
+		grok.WithDecryption(xor),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			received <- *delivery.Body.(*map[string]interface{})
+			return nil
+		}),
+	).
+		Run(ctx)
+
+	encrypted := grok.NewPubSubProducer(s.client,
+		grok.WithCompression(grok.CompressionGzip),
+		grok.WithEncryption(xor))
+
+	s.assert.NoError(encrypted.Publish(topicID, map[string]interface{}{"ping": "secret"}))
+	s.assert.NoError(s.producer.Publish(topicID, map[string]interface{}{"ping": "plain"}))
+
+	values := []interface{}{}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case body := <-received:
+			values = append(values, body["ping"])
+		case <-time.After(10 * time.Second):
+			s.Fail("message not received")
+			return
+		}
+	}
+
+	s.assert.ElementsMatch([]interface{}{"secret", "plain"}, values)
+}
+
+func (s *PubSubSubscriberTestSuite) TestDLQRouter() {
+	errValidation := errors.New("validation failed")
+
+	for _, tc := range []struct {
+		err   error
+		topic string
+	}{
+		{errValidation, "topic-dlq-router_validation_dlq"},
+		{errors.New("boom"), "topic-dlq-router_dlq"},
+	} {
+		publisher := &recordingPublisher{}
+
+		disposition := grok.NewPubSubSubscriber(
+			grok.WithClient(s.client),
+			grok.WithTopicID("topic-dlq-router"),
+			grok.WithPubSubSubscriberID("subs-dlq-router"),
+			grok.WithPublisher(publisher),
+			grok.WithMaxRetries(0),
+			grok.WithDLQRouter(func(message *pubsub.Message, err error) string {
+				if errors.Is(err, errValidation) {
+					return "topic-dlq-router_validation_dlq"
+				}
+
+				return ""
+			}),
+			grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+				return tc.err
+			}),
+		).
+			ProcessMessage(context.Background(), &pubsub.Message{ID: "1", Data: []byte(`{}`)})
+
+		s.assert.Equal(grok.DispositionDLQ, disposition)
+		s.assert.Equal(tc.topic, publisher.topicID)
+	}
+}
+
+func (s *PubSubSubscriberTestSuite) TestRetryStripsDLQAttributes() {
+	publisher := &recordingPublisher{}
+
+	disposition := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-retry-clean"),
+		grok.WithPubSubSubscriberID("subs-retry-clean"),
+		grok.WithPublisher(publisher),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			return errors.New("still failing")
+		}),
+	).
+		ProcessMessage(context.Background(), &pubsub.Message{
+			ID:   "1",
+			Data: []byte(`{}`),
+			Attributes: map[string]string{
+				"origin":     "test",
+				"retries":    "2",
+				"error":      "previous failure",
+				"error_json": `[{"message":"previous failure"}]`,
+				"stack":      "goroutine 1",
+			},
+		})
+
+	s.assert.Equal(grok.DispositionRetry, disposition)
+	s.assert.Equal(map[string]string{"origin": "test", "retries": "3"}, publisher.attributes)
+}
+
+func (s *PubSubSubscriberTestSuite) TestIdempotencyKey() {
+	publisher := &recordingPublisher{}
+	keys := []string{}
+
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-idempotency"),
+		grok.WithPubSubSubscriberID("subs-idempotency"),
+		grok.WithPublisher(publisher),
+		grok.WithIdempotencyKey(func(message *pubsub.Message) string {
+			return message.Attributes["order_id"]
+		}),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			keys = append(keys, grok.IdempotencyKey(ctx))
+			return errors.New("failed")
+		}),
+	)
+
+	subscriber.ProcessMessage(context.Background(), &pubsub.Message{
+		ID:         "1",
+		Data:       []byte(`{}`),
+		Attributes: map[string]string{"order_id": "o-1"},
+	})
+
+	s.assert.Equal("o-1", publisher.attributes[grok.IdempotencyKeyAttribute])
+
+	subscriber.ProcessMessage(context.Background(), &pubsub.Message{
+		ID:         "2",
+		Data:       publisher.data,
+		Attributes: map[string]string{grok.IdempotencyKeyAttribute: "o-1", "retries": "1"},
+	})
+
+	subscriber.ProcessMessage(context.Background(), &pubsub.Message{ID: "3", Data: []byte(`{}`)})
+
+	s.assert.Equal([]string{"o-1", "o-1", "3"}, keys)
+}
+
+type countingSetup struct {
+	subscriber *grok.PubSubSubscriber
+	mu         *sync.Mutex
+	running    *int
+	max        *int
+	cancel     context.CancelFunc
+}
+
+func (c *countingSetup) Setup(ctx context.Context) error {
+	c.mu.Lock()
+	*c.running++
+	if *c.running > *c.max {
+		*c.max = *c.running
+	}
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		*c.running--
+		c.mu.Unlock()
+	}()
+
+	return c.subscriber.Setup(ctx)
+}
+
+func (c *countingSetup) Run(ctx context.Context) error {
+	c.cancel()
+	return nil
+}
+
+func (s *PubSubSubscriberTestSuite) TestStartupConcurrency() {
+	mu := new(sync.Mutex)
+	running, max := 0, 0
+	subscribers := []grok.Subscriber{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for i := 0; i < 12; i++ {
+		subscribers = append(subscribers, &countingSetup{
+			subscriber: grok.NewPubSubSubscriber(
+				grok.WithClient(s.client),
+				grok.WithTopicID("topic-startup"),
+				grok.WithPubSubSubscriberID(fmt.Sprintf("subs-startup-%d", i)),
+				grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error { return nil }),
+			),
+			mu:      mu,
+			running: &running,
+			max:     &max,
+			cancel:  cancel,
+		})
+	}
+
+	err := grok.NewService(
+		grok.WithSubscribers(subscribers...),
+		grok.WithStartupConcurrency(3),
+	).Run(ctx)
+
+	s.assert.NoError(err)
+	s.assert.True(max > 1, "setups did not run concurrently")
+	s.assert.True(max <= 3, "setups exceeded the startup concurrency")
+
+	for i := 0; i < 12; i++ {
+		exists, err := s.client.Subscription(fmt.Sprintf("subs-startup-%d", i)).Exists(context.Background())
+		s.assert.NoError(err)
+		s.assert.True(exists)
+	}
+
+	running, max = 0, 0
+
+	err = grok.NewService(
+		grok.WithSubscribers(subscribers...),
+		grok.WithStartupConcurrency(3),
+	).Run(ctx)
+
+	s.assert.Equal(context.Canceled, err)
+	s.assert.Equal(0, max)
+}
+
+func (s *PubSubSubscriberTestSuite) TestMaxMessageAge() {
+	handled := []string{}
+
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-max-age"),
+		grok.WithPubSubSubscriberID("subs-max-age"),
+		grok.WithMaxMessageAge(time.Minute),
+		grok.WithMaxAgeExemption(func(message *pubsub.Message) bool {
+			return message.Attributes["keep"] == "true"
+		}),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			handled = append(handled, delivery.Message.ID)
+			return nil
+		}),
+	)
+
+	old := time.Now().Add(-time.Hour)
+
+	for _, tc := range []struct {
+		message     *pubsub.Message
+		disposition grok.Disposition
+	}{
+		{&pubsub.Message{ID: "fresh", Data: []byte(`{}`), PublishTime: time.Now()}, grok.DispositionAck},
+		{&pubsub.Message{ID: "old", Data: []byte(`{}`), PublishTime: old}, grok.DispositionExpired},
+		{&pubsub.Message{ID: "exempt", Data: []byte(`{}`), PublishTime: old, Attributes: map[string]string{"keep": "true"}}, grok.DispositionAck},
+		{&pubsub.Message{ID: "retried", Data: []byte(`{}`), PublishTime: time.Now(), Attributes: map[string]string{
+			grok.PublishedAtAttribute: strconv.FormatInt(old.UnixNano()/int64(time.Millisecond), 10),
+		}}, grok.DispositionExpired},
+	} {
+		s.assert.Equal(tc.disposition, subscriber.ProcessMessage(context.Background(), tc.message), tc.message.ID)
+	}
+
+	s.assert.Equal([]string{"fresh", "exempt"}, handled)
+}
+
+func (s *PubSubSubscriberTestSuite) TestResultHandler() {
+	handler := grok.WithResultHandler(func(ctx context.Context, delivery *grok.Delivery) ([]grok.OutboundMessage, error) {
+		return []grok.OutboundMessage{
+			{TopicID: "invoices", Body: map[string]string{"id": "i-1"}},
+			{TopicID: "emails", Body: map[string]string{"to": "a@b.c"}, Attributes: map[string]string{"kind": "receipt"}},
+		}, nil
+	})
+
+	for _, tc := range []struct {
+		failures    int
+		disposition grok.Disposition
+		calls       int
+	}{
+		{0, grok.DispositionAck, 2},
+		{1, grok.DispositionRetry, 2},
+	} {
+		publisher := &flakyPublisher{failures: tc.failures}
+
+		disposition := grok.NewPubSubSubscriber(
+			grok.WithClient(s.client),
+			grok.WithTopicID("topic-result-handler"),
+			grok.WithPubSubSubscriberID("subs-result-handler"),
+			grok.WithPublisher(publisher),
+			handler,
+		).
+			ProcessMessage(context.Background(), &pubsub.Message{ID: "1", Data: []byte(`{}`)})
+
+		s.assert.Equal(tc.disposition, disposition)
+		s.assert.Equal(tc.calls, publisher.calls)
+	}
+}
+
+type recordingReporter struct {
+	mu     sync.Mutex
+	errs   []error
+	fields []map[string]interface{}
+}
+
+func (r *recordingReporter) Report(ctx context.Context, err error, fields map[string]interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.errs = append(r.errs, err)
+	r.fields = append(r.fields, fields)
+}
+
+func (s *PubSubSubscriberTestSuite) TestErrorReporter() {
+	reporter := &recordingReporter{}
+
+	disposition := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-reporter"),
+		grok.WithPubSubSubscriberID("subs-reporter"),
+		grok.WithPublisher(&flakyPublisher{}),
+		grok.WithSubscriberErrorReporter(reporter),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			panic("nil map")
+		}),
+	).
+		ProcessMessage(context.Background(), &pubsub.Message{ID: "1", Data: []byte(`{}`)})
+
+	s.assert.Equal(grok.DispositionDLQ, disposition)
+	s.assert.Len(reporter.errs, 1)
+	s.assert.EqualError(reporter.errs[0], "panic: nil map")
+	s.assert.Equal("1", reporter.fields[0]["message_id"])
+	s.assert.NotEmpty(reporter.fields[0]["stack"])
+}
+
+func (s *PubSubSubscriberTestSuite) TestSeek() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan string, 10)
+
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-seek"),
+		grok.WithPubSubSubscriberID("subs-seek"),
+		grok.WithRetainAckedMessages(),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			received <- delivery.Message.ID
+			return nil
+		}),
+	)
+
+	s.assert.NoError(subscriber.Setup(ctx))
+
+	go subscriber.Run(ctx)
+
+	s.assert.NoError(s.producer.Publish("topic-seek", map[string]string{"ping": "pong"}))
+	<-received
+
+	s.assert.Equal(grok.ErrReceiving, subscriber.Seek(ctx, time.Now().Add(-time.Hour)))
+	s.assert.Equal(grok.ErrReceiving, subscriber.SeekToSnapshot(ctx, "snapshot"))
+
+	cancel()
+	s.assert.NoError(subscriber.Close(context.Background()))
+}
+
+func (s *PubSubSubscriberTestSuite) TestPanicPolicy() {
+	for _, tc := range []struct {
+		policy      grok.PanicPolicy
+		retries     string
+		disposition grok.Disposition
+	}{
+		{grok.PanicDeadLetter, "0", grok.DispositionDLQ},
+		{grok.PanicRetry, "0", grok.DispositionRetry},
+		{grok.PanicRetry, "5", grok.DispositionDLQ},
+	} {
+		publisher := &recordingPublisher{}
+
+		disposition := grok.NewPubSubSubscriber(
+			grok.WithClient(s.client),
+			grok.WithTopicID("topic-panic-policy"),
+			grok.WithPubSubSubscriberID("subs-panic-policy"),
+			grok.WithPublisher(publisher),
+			grok.WithMaxRetries(5),
+			grok.WithPanicPolicy(tc.policy),
+			grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+				panic("flaky cache returned nil")
+			}),
+		).
+			ProcessMessage(context.Background(), &pubsub.Message{
+				ID:         "1",
+				Data:       []byte(`{}`),
+				Attributes: map[string]string{"retries": tc.retries},
+			})
+
+		s.assert.Equal(tc.disposition, disposition)
+
+		if tc.disposition == grok.DispositionRetry {
+			s.assert.Equal("topic-panic-policy", publisher.topicID)
+			s.assert.Equal("1", publisher.attributes["retries"])
+		}
+	}
+}
+
+func (s *PubSubSubscriberTestSuite) TestEffectiveReceiveSettings() {
+	settings := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithTopicID("topic-receive-settings"),
+		grok.WithPubSubSubscriberID("subs-receive-settings"),
+		grok.WithMaxOutstandingMessages(10),
+		grok.WithMaxExtension(2*time.Minute),
+	).EffectiveReceiveSettings()
+
+	s.assert.Equal(10, settings.MaxOutstandingMessages)
+	s.assert.Equal(2*time.Minute, settings.MaxExtension)
+	s.assert.Equal(pubsub.DefaultReceiveSettings.MaxOutstandingBytes, settings.MaxOutstandingBytes)
+	s.assert.Equal(pubsub.DefaultReceiveSettings.NumGoroutines, settings.NumGoroutines)
+
+	existing := s.client.Subscription("subs-receive-settings-existing")
+	existing.ReceiveSettings.NumGoroutines = 4
+	existing.ReceiveSettings.MaxOutstandingBytes = 1024
+
+	settings = grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithExistingSubscription(existing),
+		grok.WithMaxOutstandingMessages(0),
+		grok.WithMaxExtension(-1),
+	).EffectiveReceiveSettings()
+
+	s.assert.Equal(pubsub.DefaultReceiveSettings.MaxOutstandingMessages, settings.MaxOutstandingMessages)
+	s.assert.Equal(time.Duration(0), settings.MaxExtension)
+	s.assert.Equal(1024, settings.MaxOutstandingBytes)
+	s.assert.Equal(4, settings.NumGoroutines)
+}
+
+func (s *PubSubSubscriberTestSuite) TestExistingSubscription() {
+	ctx := context.Background()
+	topicID := fmt.Sprintf("topic-existing-%d", time.Now().UnixNano())
+
+	topic, err := s.client.CreateTopic(ctx, topicID)
+	s.Require().NoError(err)
+
+	existing, err := s.client.CreateSubscription(ctx, topicID+"_subs", pubsub.SubscriptionConfig{Topic: topic})
+	s.Require().NoError(err)
+
+	publisher := &recordingPublisher{}
+	subscriber := grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithExistingSubscription(existing),
+		grok.WithType(reflect.TypeOf(map[string]interface{}{})),
+		grok.WithPublisher(publisher),
+		grok.WithMaxRetries(1),
+		grok.WithMessageHandler(func(ctx context.Context, delivery *grok.Delivery) error {
+			return errors.New("failure")
+		}),
+	)
+
+	s.Require().NoError(subscriber.Setup(ctx))
+	s.assert.Equal(topicID+"_subs", subscriber.SubscriptionID())
+	s.assert.Equal(topicID+"_dlq", subscriber.DLQTopicID())
+
+	s.assert.Equal(grok.DispositionRetry,
+		subscriber.ProcessMessage(ctx, &pubsub.Message{ID: "1", Data: []byte(`{}`)}))
+	s.assert.Equal(topicID, publisher.topicID)
+
+	s.assert.Equal(grok.DispositionDLQ,
+		subscriber.ProcessMessage(ctx, &pubsub.Message{
+			ID:         "2",
+			Data:       []byte(`{}`),
+			Attributes: map[string]string{"retries": "1"},
+		}))
+	s.assert.Equal(topicID+"_dlq", publisher.topicID)
+
+	s.assert.Error(grok.NewPubSubSubscriber(
+		grok.WithClient(s.client),
+		grok.WithExistingSubscription(nil),
+	).Run(ctx))
+
+	s.assert.Equal(grok.ErrNoClient, grok.NewPubSubSubscriber(
+		grok.WithExistingSubscription(existing),
+	).Run(ctx))
+}
@@ -0,0 +1,133 @@
+package grok
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const tenantKey = "grok.tenant"
+
+type tenantContextKey struct{}
+
+// TenantAttribute carries the tenant of a published message to its subscribers.
+const TenantAttribute = "X-Tenant-ID"
+
+var (
+	// ErrMissingTenant ...
+	ErrMissingTenant = errors.New("missing tenant")
+	// ErrInvalidTenant ...
+	ErrInvalidTenant = errors.New("invalid tenant")
+)
+
+var tenantPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Tenant requires every request to carry a tenant, responding 400 when extractor fails
+// or the tenant is not made of letters, digits, "-" and "_". The tenant is available to
+// handlers with TenantFromContext, and is propagated by PublishContext to subscribers.
+func Tenant(extractor func(*gin.Context) (string, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant, err := extractor(c)
+
+		if err == nil && !tenantPattern.MatchString(tenant) {
+			err = ErrInvalidTenant
+		}
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		c.Set(tenantKey, tenant)
+		c.Request = c.Request.WithContext(ContextWithTenant(c.Request.Context(), tenant))
+
+		c.Next()
+	}
+}
+
+// TenantFromHeader extracts the tenant from header.
+func TenantFromHeader(header string) func(*gin.Context) (string, error) {
+	return func(c *gin.Context) (string, error) {
+		if tenant := c.GetHeader(header); tenant != "" {
+			return tenant, nil
+		}
+
+		return "", ErrMissingTenant
+	}
+}
+
+// TenantFromSubdomain extracts the tenant from the first label of the host,
+// e.g. acme for acme.example.com.
+func TenantFromSubdomain() func(*gin.Context) (string, error) {
+	return func(c *gin.Context) (string, error) {
+		labels := strings.Split(c.Request.Host, ".")
+
+		if len(labels) < 3 {
+			return "", ErrMissingTenant
+		}
+
+		return labels[0], nil
+	}
+}
+
+// AllowTenants restricts extractor to the given tenants.
+func AllowTenants(extractor func(*gin.Context) (string, error), tenants ...string) func(*gin.Context) (string, error) {
+	allowed := make(map[string]bool, len(tenants))
+
+	for _, tenant := range tenants {
+		allowed[tenant] = true
+	}
+
+	return func(c *gin.Context) (string, error) {
+		tenant, err := extractor(c)
+
+		if err != nil {
+			return "", err
+		}
+
+		if !allowed[tenant] {
+			return "", ErrInvalidTenant
+		}
+
+		return tenant, nil
+	}
+}
+
+// ContextWithTenant ...
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant of a gin context, a request context or a
+// message handler context, or an empty string.
+func TenantFromContext(ctx context.Context) string {
+	if tenant, ok := ctx.Value(tenantKey).(string); ok {
+		return tenant
+	}
+
+	tenant, _ := ctx.Value(tenantContextKey{}).(string)
+
+	return tenant
+}
+
+func injectTenant(ctx context.Context, attributes map[string]string) map[string]string {
+	tenant := TenantFromContext(ctx)
+
+	if tenant == "" {
+		return attributes
+	}
+
+	injected := make(map[string]string, len(attributes)+1)
+
+	for k, v := range attributes {
+		injected[k] = v
+	}
+
+	injected[TenantAttribute] = tenant
+
+	return injected
+}
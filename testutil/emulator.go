@@ -0,0 +1,120 @@
+// Package testutil helps writing integration tests against the PubSub emulator.
+package testutil
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/recoli-tech/grok"
+)
+
+// EmulatorImage is the container image used when gcloud is not installed.
+var EmulatorImage = "google/cloud-sdk:latest"
+
+// EmulatorStartTimeout bounds how long StartEmulator waits for the emulator to listen.
+var EmulatorStartTimeout = 2 * time.Minute
+
+// StartEmulator starts a PubSub emulator on a random port, using the gcloud binary
+// or a container when gcloud is not installed, and returns a client connected to it.
+// The returned func stops the emulator and must be deferred by the test.
+//
+//	client, stop := testutil.StartEmulator(t)
+//	defer stop()
+func StartEmulator(t *testing.T) (*pubsub.Client, func()) {
+	t.Helper()
+
+	port, err := freePort()
+
+	if err != nil {
+		t.Fatalf("cannot pick emulator port: %v", err)
+	}
+
+	endpoint := fmt.Sprintf("localhost:%d", port)
+
+	stop, err := startEmulator(port)
+
+	if err != nil {
+		t.Fatalf("cannot start emulator: %v", err)
+	}
+
+	if err := waitListening(endpoint, EmulatorStartTimeout); err != nil {
+		stop()
+		t.Fatalf("emulator not ready: %v", err)
+	}
+
+	client := grok.FakePubSubClient(endpoint)
+
+	return client, func() {
+		client.Close()
+		stop()
+	}
+}
+
+func startEmulator(port int) (func(), error) {
+	if _, err := exec.LookPath("gcloud"); err == nil {
+		cmd := exec.Command("gcloud", "beta", "emulators", "pubsub", "start",
+			fmt.Sprintf("--host-port=localhost:%d", port))
+
+		setProcessGroup(cmd)
+
+		if err := cmd.Start(); err != nil {
+			return nil, err
+		}
+
+		return func() {
+			killProcessGroup(cmd)
+			cmd.Wait()
+		}, nil
+	}
+
+	name := fmt.Sprintf("grok_pubsub_%d", port)
+
+	out, err := exec.Command("docker", "run", "--rm", "-d",
+		"--name", name,
+		"-p", fmt.Sprintf("%d:8085", port),
+		EmulatorImage,
+		"gcloud", "beta", "emulators", "pubsub", "start", "--host-port=0.0.0.0:8085").
+		CombinedOutput()
+
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, out)
+	}
+
+	return func() {
+		exec.Command("docker", "rm", "-f", name).Run()
+	}, nil
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func waitListening(endpoint string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		conn, err := net.DialTimeout("tcp", endpoint, time.Second)
+
+		if err == nil {
+			return conn.Close()
+		}
+
+		if time.Now().After(deadline) {
+			return err
+		}
+
+		time.Sleep(250 * time.Millisecond)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package testutil
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// gcloud starts the emulator as a child process, so the whole group is killed.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
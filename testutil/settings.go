@@ -0,0 +1,55 @@
+package testutil
+
+import (
+	"os"
+
+	"github.com/recoli-tech/grok"
+)
+
+// DefaultEmulatorHost is the PubSub emulator of NewTestSettings when PUBSUB_EMULATOR_HOST is not set.
+var DefaultEmulatorHost = "localhost:8085"
+
+// NewTestSettings returns settings with every section populated for tests: the API bound
+// to a free port on 127.0.0.1 without swagger nor auth, fake PubSub, storage, user provider
+// and mail, and a local Mongo. The overrides are applied in order.
+//
+//	settings := testutil.NewTestSettings(func(s *grok.Settings) {
+//		s.API.Debug = true
+//	})
+func NewTestSettings(overrides ...func(*grok.Settings)) *grok.Settings {
+	endpoint := os.Getenv("PUBSUB_EMULATOR_HOST")
+
+	if endpoint == "" {
+		endpoint = DefaultEmulatorHost
+	}
+
+	settings := &grok.Settings{
+		API: &grok.APISettings{
+			Host: "127.0.0.1:0",
+		},
+		Mongo: &grok.MongoSettings{
+			ConnectionString: "mongodb://localhost:27017",
+			Database:         "grok_test",
+		},
+		GCP: &grok.GCPSettings{
+			ProjectID: "test-project",
+		},
+		UserProvider: &grok.UserProvider{
+			Kind: "fake",
+		},
+		Mail: &grok.MailSettings{
+			Provider: "fake",
+		},
+	}
+
+	settings.GCP.PubSub.Fake = true
+	settings.GCP.PubSub.Endpoint = endpoint
+	settings.GCP.Storage.Fake = true
+	settings.GCP.Storage.Bucket = "test-bucket"
+
+	for _, override := range overrides {
+		override(settings)
+	}
+
+	return settings
+}
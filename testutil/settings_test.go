@@ -0,0 +1,28 @@
+package testutil_test
+
+import (
+	"testing"
+
+	"github.com/recoli-tech/grok"
+	"github.com/recoli-tech/grok/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTestSettings(t *testing.T) {
+	settings := testutil.NewTestSettings(func(s *grok.Settings) {
+		s.API.Debug = true
+	})
+
+	assert.Equal(t, "127.0.0.1:0", settings.API.Host)
+	assert.Empty(t, settings.API.Swagger)
+	assert.True(t, settings.API.Debug)
+	assert.True(t, settings.GCP.PubSub.Fake)
+	assert.NotEmpty(t, settings.GCP.PubSub.Endpoint)
+	assert.NotNil(t, settings.Mongo)
+	assert.NotNil(t, settings.UserProvider)
+	assert.NotNil(t, settings.Mail)
+
+	assert.NotPanics(t, func() {
+		grok.New(grok.WithSettings(settings))
+	})
+}
@@ -0,0 +1,105 @@
+package grok
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// WithTrustedProxies sets the proxies, as IPs or CIDRs, allowed to set the client IP
+// through X-Forwarded-For and X-Real-Ip. By default no proxy is trusted and ClientIP
+// is the address of the connection, since trusting every proxy lets any client spoof
+// its IP, bypassing rate limits and polluting access logs.
+func WithTrustedProxies(proxies []string) APIOption {
+	return func(server *API) {
+		server.trustedProxies = append(server.trustedProxies, proxies...)
+	}
+}
+
+// trustedProxies rewrites the request remote address with the client IP forwarded by
+// trusted proxies, so c.ClientIP() and the access logs report the real client.
+func trustedProxies(proxies []string) gin.HandlerFunc {
+	networks := parseNetworks(proxies)
+
+	trusted := func(ip net.IP) bool {
+		for _, network := range networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return func(c *gin.Context) {
+		host, port, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr))
+
+		if err != nil || !trusted(net.ParseIP(host)) {
+			c.Next()
+			return
+		}
+
+		c.Set(trustedProxyKey, true)
+
+		if client := forwardedClientIP(c, trusted); client != nil {
+			c.Request.RemoteAddr = net.JoinHostPort(client.String(), port)
+		}
+
+		c.Next()
+	}
+}
+
+// forwardedClientIP walks X-Forwarded-For from the closest hop, returning the first
+// address not trusted, as the ones before it may be forged by the client.
+func forwardedClientIP(c *gin.Context, trusted func(net.IP) bool) net.IP {
+	hops := strings.Split(c.GetHeader("X-Forwarded-For"), ",")
+
+	var client net.IP
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+
+		if ip == nil {
+			break
+		}
+
+		client = ip
+
+		if !trusted(ip) {
+			break
+		}
+	}
+
+	if client == nil {
+		client = net.ParseIP(strings.TrimSpace(c.GetHeader("X-Real-Ip")))
+	}
+
+	return client
+}
+
+func parseNetworks(proxies []string) []*net.IPNet {
+	networks := []*net.IPNet{}
+
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+
+		if err != nil {
+			logrus.WithError(err).Errorf("invalid trusted proxy %s", proxy)
+			continue
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks
+}
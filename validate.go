@@ -1,10 +1,13 @@
 package grok
 
 import (
+	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const validatorKey = "grok.validator"
+
 var (
 	// Validator ...
 	Validator = NewValidator()
@@ -24,3 +27,20 @@ func NewValidator() *validator.Validate {
 
 	return validate
 }
+
+func validatorMiddleware(v *validator.Validate) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(validatorKey, v)
+		c.Next()
+	}
+}
+
+func validatorFromContext(c *gin.Context) *validator.Validate {
+	if v, ok := c.Get(validatorKey); ok {
+		if validate, ok := v.(*validator.Validate); ok && validate != nil {
+			return validate
+		}
+	}
+
+	return Validator
+}